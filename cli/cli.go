@@ -0,0 +1,179 @@
+// Package cli is the admin command line interface for operating the app,
+// for managing subscribers, inspecting and repairing the queue, running jobs by hand, and trying out emails.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ErrUsage is returned from App.Run when the command line is invalid. The usage has already been printed.
+var ErrUsage = errors.New("invalid usage")
+
+// App runs admin commands. Dependencies that are nil make the commands needing them fail with an error.
+type App struct {
+	baseURL         *url.URL
+	deadLetterQueue queue
+	emailer         emailSender
+	queue           queue
+	stderr          io.Writer
+	stdin           io.Reader
+	stdout          io.Writer
+	subscribers     subscriberStore
+}
+
+type Options struct {
+	// BaseURL of the app, used in links in rendered emails.
+	BaseURL *url.URL
+	// DeadLetterQueue that Queue moves messages to after too many failed receives.
+	DeadLetterQueue queue
+	Emailer         emailSender
+	Queue           queue
+	Stderr          io.Writer
+	Stdin           io.Reader
+	Stdout          io.Writer
+	Subscribers     subscriberStore
+}
+
+func New(opts Options) *App {
+	if opts.Stderr == nil {
+		opts.Stderr = io.Discard
+	}
+	if opts.Stdin == nil {
+		opts.Stdin = strings.NewReader("")
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = io.Discard
+	}
+	return &App{
+		baseURL:         opts.BaseURL,
+		deadLetterQueue: opts.DeadLetterQueue,
+		emailer:         opts.Emailer,
+		queue:           opts.Queue,
+		stderr:          opts.Stderr,
+		stdin:           opts.Stdin,
+		stdout:          opts.Stdout,
+		subscribers:     opts.Subscribers,
+	}
+}
+
+// command is a single subcommand, like "subscribers list".
+type command struct {
+	usage       string
+	description string
+	run         func(a *App, ctx context.Context, fs *flag.FlagSet, args []string) error
+}
+
+// commands by group and name.
+var commands = map[string]map[string]command{
+	"subscribers": subscriberCommands,
+	"queue":       queueCommands,
+	"jobs":        jobCommands,
+	"email":       emailCommands,
+}
+
+// Run the command given by args, without the program name, such as ["subscribers", "list", "--json"].
+func (a *App) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.printUsage()
+		if len(args) == 0 {
+			return ErrUsage
+		}
+		return nil
+	}
+
+	group, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(a.stderr, "Unknown command %q.\n\n", args[0])
+		a.printUsage()
+		return ErrUsage
+	}
+	if len(args) < 2 {
+		a.printUsage()
+		return ErrUsage
+	}
+	c, ok := group[args[1]]
+	if !ok {
+		fmt.Fprintf(a.stderr, "Unknown command %q.\n\n", args[0]+" "+args[1])
+		a.printUsage()
+		return ErrUsage
+	}
+	return c.run(a, ctx, a.newFlagSet(args[0]+" "+args[1], c.usage), args[2:])
+}
+
+// printUsage of all commands.
+func (a *App) printUsage() {
+	fmt.Fprintln(a.stderr, "Usage: canvas <command> [flags] [arguments]")
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "Commands:")
+
+	var lines []string
+	for groupName, group := range commands {
+		for name, c := range group {
+			lines = append(lines, fmt.Sprintf("  %v %v %v\t%v", groupName, name, c.usage, c.description))
+		}
+	}
+	sort.Strings(lines)
+
+	w := newTableWriter(a.stderr)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	_ = w.Flush()
+
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, `Flags go before arguments. Run a command with -h to see its flags.`)
+}
+
+// newFlagSet for the command with the given name, printing errors and help to stderr.
+func (a *App) newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: canvas %v %v\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse the flags, and check the number of remaining arguments is between min and max.
+// Returns ErrUsage on errors, and also for -h, so the caller can just return the error.
+func parse(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if fs.NArg() < min || fs.NArg() > max {
+		fs.Usage()
+		return ErrUsage
+	}
+	return nil
+}
+
+// printJSON of v to stdout, indented.
+func (a *App) printJSON(v any) error {
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable with the given header and rows to stdout, with aligned columns.
+func (a *App) printTable(header []string, rows [][]string) error {
+	w := newTableWriter(a.stdout)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func newTableWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
@@ -0,0 +1,194 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/cli"
+	"canvas/messaging"
+	"canvas/model"
+	"canvas/storage"
+)
+
+// subscriberStoreMock keeps subscribers in memory, in insertion order.
+type subscriberStoreMock struct {
+	consents    []model.Consent
+	subscribers []model.Subscriber
+}
+
+func (s *subscriberStoreMock) ListSubscribers(
+	ctx context.Context,
+	filter storage.SubscriberFilter,
+) ([]model.Subscriber, error) {
+	var subscribers []model.Subscriber
+	for _, subscriber := range s.subscribers {
+		if filter.Confirmed != nil && *filter.Confirmed != subscriber.Confirmed {
+			continue
+		}
+		if filter.Active != nil && *filter.Active != subscriber.Active {
+			continue
+		}
+		if filter.Locale != "" && filter.Locale != subscriber.Locale {
+			continue
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	if filter.Limit > 0 && len(subscribers) > filter.Limit {
+		subscribers = subscribers[:filter.Limit]
+	}
+	return subscribers, nil
+}
+
+func (s *subscriberStoreMock) GetSubscriber(ctx context.Context, email model.Email) (*model.Subscriber, error) {
+	return s.update(email, func(*model.Subscriber) {}), nil
+}
+
+func (s *subscriberStoreMock) ConfirmSubscriber(
+	ctx context.Context,
+	email model.Email,
+	consent model.Consent,
+) (*model.Subscriber, error) {
+	s.consents = append(s.consents, consent)
+	return s.update(email, func(subscriber *model.Subscriber) { subscriber.Confirmed = true }), nil
+}
+
+func (s *subscriberStoreMock) DeactivateSubscriber(
+	ctx context.Context,
+	email model.Email,
+	consent model.Consent,
+) (*model.Subscriber, error) {
+	s.consents = append(s.consents, consent)
+	return s.update(email, func(subscriber *model.Subscriber) { subscriber.Active = false }), nil
+}
+
+func (s *subscriberStoreMock) ImportSubscribers(
+	ctx context.Context,
+	subscribers []model.Subscriber,
+	consent model.Consent,
+) (map[model.Email]string, error) {
+	s.consents = append(s.consents, consent)
+	tokens := map[model.Email]string{}
+	for _, subscriber := range subscribers {
+		if s.update(subscriber.Email, func(*model.Subscriber) {}) != nil {
+			continue
+		}
+		s.subscribers = append(s.subscribers, subscriber)
+		tokens[subscriber.Email] = "123"
+	}
+	return tokens, nil
+}
+
+func (s *subscriberStoreMock) ExportSubscribers(
+	ctx context.Context,
+	filter storage.SubscriberFilter,
+	fn func(model.Subscriber) error,
+) error {
+	subscribers, _ := s.ListSubscribers(ctx, filter)
+	for _, subscriber := range subscribers {
+		if err := fn(subscriber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *subscriberStoreMock) update(email model.Email, fn func(*model.Subscriber)) *model.Subscriber {
+	i := slices.IndexFunc(s.subscribers, func(subscriber model.Subscriber) bool {
+		return subscriber.Email == email
+	})
+	if i < 0 {
+		return nil
+	}
+	fn(&s.subscribers[i])
+	subscriber := s.subscribers[i]
+	return &subscriber
+}
+
+// testApp with its dependencies, and the output of the last command.
+type testApp struct {
+	app         *cli.App
+	dlq         *messaging.MemoryQueue
+	queue       *messaging.MemoryQueue
+	recorder    *messaging.EmailRecorder
+	stdin       *bytes.Buffer
+	stdout      *bytes.Buffer
+	subscribers *subscriberStoreMock
+}
+
+func newTestApp() *testApp {
+	baseURL, _ := url.Parse("http://localhost:8080")
+	recorder := messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{})
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	a := &testApp{
+		dlq:      messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{MaxMessages: 2}),
+		queue:    messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{}),
+		recorder: recorder,
+		stdin:    &bytes.Buffer{},
+		stdout:   &bytes.Buffer{},
+		subscribers: &subscriberStoreMock{subscribers: []model.Subscriber{
+			{Email: "me@example.com", Locale: "en", Confirmed: true, Active: true, Created: created, Updated: created},
+			{Email: "you@example.com", Locale: "da", Active: true, Created: created, Updated: created},
+		}},
+	}
+	a.app = cli.New(cli.Options{
+		BaseURL:         baseURL,
+		DeadLetterQueue: a.dlq,
+		Emailer: messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:  baseURL,
+			Recorder: recorder,
+		}),
+		Queue:       a.queue,
+		Stdin:       a.stdin,
+		Stdout:      a.stdout,
+		Subscribers: a.subscribers,
+	})
+	return a
+}
+
+// run the command line and return stdout.
+func (a *testApp) run(args ...string) (string, error) {
+	a.stdout.Reset()
+	err := a.app.Run(context.Background(), args)
+	return a.stdout.String(), err
+}
+
+func TestApp_Run(t *testing.T) {
+	t.Run("returns a usage error for no, unknown, and malformed commands", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		for _, args := range [][]string{
+			{},
+			{"nope"},
+			{"subscribers"},
+			{"subscribers", "nope"},
+			{"subscribers", "find"},
+			{"subscribers", "list", "--nope"},
+		} {
+			_, err := a.run(args...)
+			is.True(errors.Is(err, cli.ErrUsage))
+		}
+	})
+
+	t.Run("fails commands whose dependencies are not configured", func(t *testing.T) {
+		is := is.New(t)
+
+		app := cli.New(cli.Options{})
+		err := app.Run(context.Background(), []string{"queue", "stats"})
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), "no queue configured"))
+
+		err = app.Run(context.Background(), []string{"subscribers", "list"})
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), "no database configured"))
+	})
+}
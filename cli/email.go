@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"canvas/i18n"
+	"canvas/messaging"
+	"canvas/model"
+)
+
+// emailSender is implemented by messaging.Emailer.
+type emailSender interface {
+	SendNewsletterConfirmationEmail(ctx context.Context, to model.Email, token string, locale i18n.Locale) error
+	SendNewsletterWelcomeEmail(ctx context.Context, to model.Email, locale i18n.Locale) error
+}
+
+// testToken in rendered and test confirmation emails. It doesn't confirm anyone.
+const testToken = "test"
+
+var emailCommands = map[string]command{
+	"render": {
+		usage:       "[--locale en] [--html] [--json] <confirmation|welcome>",
+		description: "Render an email to stdout without sending it",
+		run:         (*App).renderEmail,
+	},
+	"send": {
+		usage:       "[--locale en] <confirmation|welcome> <to>",
+		description: "Send a test email, with a confirmation link that doesn't work",
+		run:         (*App).sendEmail,
+	},
+}
+
+func (a *App) renderEmail(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	locale := fs.String("locale", string(i18n.Default), "locale of the email")
+	asHTML := fs.Bool("html", false, "print the HTML body instead of the text body")
+	asJSON := fs.Bool("json", false, "print the whole email as JSON")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	if a.baseURL == nil {
+		return errors.New("no base URL configured")
+	}
+
+	recorder := messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{})
+	emailer := messaging.NewEmailer(messaging.NewEmailerOptions{
+		BaseURL:                   a.baseURL,
+		MarketingEmailAddress:     "marketing@example.com",
+		Recorder:                  recorder,
+		TransactionalEmailAddress: "transactional@example.com",
+	})
+	if err := sendTestEmail(ctx, emailer, fs.Arg(0), "me@example.com", *locale); err != nil {
+		return err
+	}
+	e := recorder.Emails()[0]
+
+	switch {
+	case *asJSON:
+		return a.printJSON(e)
+	case *asHTML:
+		_, err := fmt.Fprintln(a.stdout, e.HtmlBody)
+		return err
+	default:
+		_, err := fmt.Fprintf(a.stdout, "Subject: %v\n\n%v\n", e.Subject, e.TextBody)
+		return err
+	}
+}
+
+func (a *App) sendEmail(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	locale := fs.String("locale", string(i18n.Default), "locale of the email")
+	if err := parse(fs, args, 2, 2); err != nil {
+		return err
+	}
+	if a.emailer == nil {
+		return errors.New("no emailer configured")
+	}
+
+	to := model.Email(fs.Arg(1)).Normalize()
+	if !to.IsValid() {
+		return fmt.Errorf("invalid email address %q", to)
+	}
+	if err := sendTestEmail(ctx, a.emailer, fs.Arg(0), to, *locale); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(a.stdout, "Sent %v email to %v.\n", fs.Arg(0), to)
+	return err
+}
+
+// sendTestEmail of the given kind, either "confirmation" or "welcome".
+func sendTestEmail(ctx context.Context, es emailSender, kind string, to model.Email, localeTag string) error {
+	locale, ok := i18n.Parse(localeTag)
+	if !ok {
+		return fmt.Errorf("unknown locale %q, must be one of %v", localeTag, i18n.Locales)
+	}
+
+	var err error
+	switch kind {
+	case "confirmation":
+		err = es.SendNewsletterConfirmationEmail(ctx, to, testToken, locale)
+	case "welcome":
+		err = es.SendNewsletterWelcomeEmail(ctx, to, locale)
+	default:
+		return fmt.Errorf("unknown email %q, must be confirmation or welcome", kind)
+	}
+	if err != nil {
+		return fmt.Errorf("error sending %v email: %w", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestApp_Email(t *testing.T) {
+	t.Run("renders an email in the given locale without sending it", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("email", "render", "--locale", "da", "confirmation")
+		is.NoErr(err)
+		is.True(strings.HasPrefix(out, "Subject: "))
+		is.True(strings.Contains(out, "http://localhost:8080/newsletter/confirm?token=test"))
+
+		out, err = a.run("email", "render", "--html", "welcome")
+		is.NoErr(err)
+		is.True(strings.Contains(out, "<html"))
+
+		is.Equal(0, len(a.recorder.Emails()))
+	})
+
+	t.Run("sends a test email", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("email", "send", "welcome", "me@example.com")
+		is.NoErr(err)
+		is.Equal("Sent welcome email to me@example.com.\n", out)
+
+		emails := a.recorder.Emails()
+		is.Equal(1, len(emails))
+		is.Equal("me@example.com", emails[0].To)
+	})
+
+	t.Run("rejects unknown emails and locales", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		_, err := a.run("email", "render", "nope")
+		is.True(err != nil)
+
+		_, err = a.run("email", "render", "--locale", "xx", "welcome")
+		is.True(err != nil)
+	})
+}
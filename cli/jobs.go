@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+
+	"canvas/jobs"
+	"canvas/model"
+)
+
+var jobCommands = map[string]command{
+	"list": {
+		usage:       "[--json]",
+		description: "List the jobs the runner can run",
+		run:         (*App).listJobs,
+	},
+	"enqueue": {
+		usage:       "[--force] <name> [payload]",
+		description: `Send a job to the queue, with an optional JSON object payload like '{"email":"me@example.com"}'`,
+		run:         (*App).enqueueJob,
+	},
+}
+
+func (a *App) listJobs(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	names := jobs.Names()
+	if *asJSON {
+		return a.printJSON(names)
+	}
+	var rows [][]string
+	for _, name := range names {
+		rows = append(rows, []string{name})
+	}
+	return a.printTable([]string{"NAME"}, rows)
+}
+
+func (a *App) enqueueJob(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	force := fs.Bool("force", false, "enqueue even if no job with the name is registered")
+	if err := parse(fs, args, 1, 2); err != nil {
+		return err
+	}
+	q, err := a.getQueue(false)
+	if err != nil {
+		return err
+	}
+
+	name := fs.Arg(0)
+	if !*force && !slices.Contains(jobs.Names(), name) {
+		return fmt.Errorf("no job named %q, see canvas jobs list, or pass --force", name)
+	}
+
+	m := model.Message{}
+	if payload := fs.Arg(1); payload != "" {
+		if err := json.Unmarshal([]byte(payload), &m); err != nil {
+			return fmt.Errorf("payload must be a JSON object with string values: %w", err)
+		}
+	}
+	if job, ok := m["job"]; ok && job != name {
+		return errors.New("payload has a different job name than the one given")
+	}
+	m["job"] = name
+
+	if err := q.Send(ctx, m); err != nil {
+		return fmt.Errorf("error sending job to queue: %w", err)
+	}
+	_, err = fmt.Fprintf(a.stdout, "Enqueued job %v.\n", name)
+	return err
+}
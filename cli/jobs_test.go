@@ -0,0 +1,52 @@
+package cli_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/model"
+)
+
+func TestApp_Jobs(t *testing.T) {
+	t.Run("lists registered jobs", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("jobs", "list", "--json")
+		is.NoErr(err)
+		is.Equal("[\n  \"advance_sequence_enrollment\",\n  \"apply_retention_policies\",\n  \"confirmation_email\",\n  \"confirmation_reminder_email\",\n  \"welcome_email\"\n]\n", out)
+	})
+
+	t.Run("enqueues a registered job with a payload", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("jobs", "enqueue", "welcome_email", `{"email":"me@example.com","locale":"da"}`)
+		is.NoErr(err)
+		is.Equal("Enqueued job welcome_email.\n", out)
+
+		m, _, err := a.queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(model.Message{"job": "welcome_email", "email": "me@example.com", "locale": "da"}, *m)
+	})
+
+	t.Run("refuses unknown jobs unless forced, and invalid payloads", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		_, err := a.run("jobs", "enqueue", "nope")
+		is.True(err != nil)
+
+		_, err = a.run("jobs", "enqueue", "welcome_email", `{"count":1}`)
+		is.True(err != nil)
+
+		_, err = a.run("jobs", "enqueue", "--force", "nope")
+		is.NoErr(err)
+
+		m, _, err := a.queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(model.Message{"job": "nope"}, *m)
+	})
+}
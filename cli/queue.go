@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"canvas/messaging"
+	"canvas/model"
+)
+
+// queue is implemented by both messaging.Queue and messaging.MemoryQueue.
+type queue interface {
+	Send(ctx context.Context, m model.Message) error
+	SendBatch(ctx context.Context, ms []model.Message) error
+	ReceiveBatch(ctx context.Context) ([]messaging.ReceivedMessage, error)
+	ChangeVisibility(ctx context.Context, receiptID string, timeout time.Duration) error
+	DeleteBatch(ctx context.Context, receiptIDs []string) error
+	Stats(ctx context.Context) (messaging.QueueStats, error)
+	Purge(ctx context.Context) error
+}
+
+var queueCommands = map[string]command{
+	"stats": {
+		usage:       "[--dlq] [--json]",
+		description: "Show approximate message counts",
+		run:         (*App).queueStats,
+	},
+	"peek": {
+		usage:       "[--dlq] [--json]",
+		description: "Show up to one batch of visible messages, without removing them",
+		run:         (*App).peekQueue,
+	},
+	"purge": {
+		usage:       "[--dlq] --yes",
+		description: "Delete all messages",
+		run:         (*App).purgeQueue,
+	},
+	"redrive": {
+		usage:       "[--max n]",
+		description: "Move messages from the dead-letter queue back to the queue",
+		run:         (*App).redriveQueue,
+	},
+}
+
+func (a *App) queueStats(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	dlq := fs.Bool("dlq", false, "use the dead-letter queue")
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	q, err := a.getQueue(*dlq)
+	if err != nil {
+		return err
+	}
+
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting queue stats: %w", err)
+	}
+
+	if *asJSON {
+		return a.printJSON(stats)
+	}
+	return a.printTable([]string{"VISIBLE", "IN FLIGHT", "DELAYED"}, [][]string{{
+		strconv.Itoa(stats.Visible), strconv.Itoa(stats.InFlight), strconv.Itoa(stats.Delayed),
+	}})
+}
+
+// peekedMessage for printing.
+type peekedMessage struct {
+	Message      model.Message `json:"message"`
+	ReceiveCount int           `json:"receive_count"`
+}
+
+// peekQueue receives a batch of messages and makes them visible again right away.
+// Peeking counts as a receive, so it brings messages closer to the dead-letter queue.
+func (a *App) peekQueue(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	dlq := fs.Bool("dlq", false, "use the dead-letter queue")
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	q, err := a.getQueue(*dlq)
+	if err != nil {
+		return err
+	}
+
+	ms, err := q.ReceiveBatch(ctx)
+	if err != nil {
+		return fmt.Errorf("error receiving messages: %w", err)
+	}
+
+	peeked := []peekedMessage{}
+	var errs []error
+	for _, m := range ms {
+		if err := q.ChangeVisibility(ctx, m.ReceiptID, 0); err != nil {
+			errs = append(errs, fmt.Errorf("error making message visible again: %w", err))
+		}
+		peeked = append(peeked, peekedMessage{Message: m.Message, ReceiveCount: m.ReceiveCount})
+	}
+
+	if *asJSON {
+		errs = append(errs, a.printJSON(peeked))
+		return errors.Join(errs...)
+	}
+	var rows [][]string
+	for _, m := range peeked {
+		messageAsBytes, err := json.Marshal(m.Message)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []string{m.Message["job"], strconv.Itoa(m.ReceiveCount), string(messageAsBytes)})
+	}
+	errs = append(errs, a.printTable([]string{"JOB", "RECEIVES", "MESSAGE"}, rows))
+	return errors.Join(errs...)
+}
+
+func (a *App) purgeQueue(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	dlq := fs.Bool("dlq", false, "use the dead-letter queue")
+	yes := fs.Bool("yes", false, "confirm that all messages should be deleted")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if !*yes {
+		return errors.New("purging deletes all messages and cannot be undone, pass --yes to confirm")
+	}
+	q, err := a.getQueue(*dlq)
+	if err != nil {
+		return err
+	}
+
+	if err := q.Purge(ctx); err != nil {
+		return fmt.Errorf("error purging queue: %w", err)
+	}
+	_, err = fmt.Fprintln(a.stdout, "Purged queue.")
+	return err
+}
+
+// redriveQueue moves messages from the dead-letter queue to the queue, a batch at a time,
+// until the dead-letter queue is empty or the maximum is reached.
+// A message is only deleted from the dead-letter queue after it's been sent to the queue.
+func (a *App) redriveQueue(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	max := fs.Int("max", 0, "maximum number of messages to move, 0 for all")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if _, err := a.getQueue(false); err != nil {
+		return err
+	}
+	if _, err := a.getQueue(true); err != nil {
+		return err
+	}
+
+	var moved int
+	for *max <= 0 || moved < *max {
+		ms, err := a.deadLetterQueue.ReceiveBatch(ctx)
+		if err != nil {
+			return fmt.Errorf("error receiving from dead-letter queue after moving %v messages: %w", moved, err)
+		}
+		if len(ms) == 0 {
+			break
+		}
+		if *max > 0 && moved+len(ms) > *max {
+			// Make the rest visible again for a later redrive
+			for _, m := range ms[*max-moved:] {
+				_ = a.deadLetterQueue.ChangeVisibility(ctx, m.ReceiptID, 0)
+			}
+			ms = ms[:*max-moved]
+		}
+
+		var messages []model.Message
+		for _, m := range ms {
+			messages = append(messages, m.Message)
+		}
+
+		// Only delete the messages that were sent, the rest are received again after their visibility timeout
+		sent := make([]bool, len(ms))
+		for i := range sent {
+			sent[i] = true
+		}
+		sendErr := a.queue.SendBatch(ctx, messages)
+		var batchErr *messaging.BatchError
+		if errors.As(sendErr, &batchErr) {
+			for _, f := range batchErr.Failures {
+				sent[f.Index] = false
+			}
+		} else if sendErr != nil {
+			return fmt.Errorf("error sending to queue after moving %v messages: %w", moved, sendErr)
+		}
+
+		var receiptIDs []string
+		for i, m := range ms {
+			if sent[i] {
+				receiptIDs = append(receiptIDs, m.ReceiptID)
+			}
+		}
+		if err := a.deadLetterQueue.DeleteBatch(ctx, receiptIDs); err != nil {
+			return fmt.Errorf("error deleting from dead-letter queue after moving %v messages: %w", moved, err)
+		}
+		moved += len(receiptIDs)
+
+		if sendErr != nil {
+			return fmt.Errorf("error sending to queue after moving %v messages: %w", moved, sendErr)
+		}
+	}
+
+	_, err := fmt.Fprintf(a.stdout, "Moved %v messages from the dead-letter queue.\n", moved)
+	return err
+}
+
+// getQueue or the dead-letter queue, or an error if it's not configured.
+func (a *App) getQueue(deadLetter bool) (queue, error) {
+	if deadLetter {
+		if a.deadLetterQueue == nil {
+			return nil, errors.New("no dead-letter queue configured, set QUEUE_DEAD_LETTER_NAME")
+		}
+		return a.deadLetterQueue, nil
+	}
+	if a.queue == nil {
+		return nil, errors.New("no queue configured, the memory queue only exists inside the server, so use QUEUE_BACKEND=sqs")
+	}
+	return a.queue, nil
+}
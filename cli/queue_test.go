@@ -0,0 +1,93 @@
+package cli_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/messaging"
+	"canvas/model"
+)
+
+func TestApp_Queue(t *testing.T) {
+	t.Run("shows queue stats", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		err := a.queue.SendBatch(context.Background(), []model.Message{{"job": "a"}, {"job": "b"}})
+		is.NoErr(err)
+
+		out, err := a.run("queue", "stats")
+		is.NoErr(err)
+		is.Equal("VISIBLE  IN FLIGHT  DELAYED\n2        0          0\n", out)
+
+		out, err = a.run("queue", "stats", "--dlq", "--json")
+		is.NoErr(err)
+		is.Equal("{\n  \"visible\": 0,\n  \"in_flight\": 0,\n  \"delayed\": 0\n}\n", out)
+	})
+
+	t.Run("peeks at messages and leaves them on the queue", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		err := a.queue.Send(context.Background(), model.Message{"job": "welcome_email", "email": "me@example.com"})
+		is.NoErr(err)
+
+		out, err := a.run("queue", "peek")
+		is.NoErr(err)
+		is.Equal("JOB            RECEIVES  MESSAGE\n"+
+			`welcome_email  1         {"email":"me@example.com","job":"welcome_email"}`+"\n", out)
+
+		stats, err := a.queue.Stats(context.Background())
+		is.NoErr(err)
+		is.Equal(messaging.QueueStats{Visible: 1}, stats)
+	})
+
+	t.Run("only purges when confirmed", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		err := a.dlq.Send(context.Background(), model.Message{"job": "a"})
+		is.NoErr(err)
+
+		_, err = a.run("queue", "purge", "--dlq")
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), "--yes"))
+
+		_, err = a.run("queue", "purge", "--dlq", "--yes")
+		is.NoErr(err)
+
+		stats, err := a.dlq.Stats(context.Background())
+		is.NoErr(err)
+		is.Equal(messaging.QueueStats{}, stats)
+	})
+
+	t.Run("redrives messages from the dead-letter queue in batches, up to the maximum", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		err := a.dlq.SendBatch(context.Background(),
+			[]model.Message{{"job": "a"}, {"job": "b"}, {"job": "c"}, {"job": "d"}})
+		is.NoErr(err)
+
+		out, err := a.run("queue", "redrive", "--max", "3")
+		is.NoErr(err)
+		is.Equal("Moved 3 messages from the dead-letter queue.\n", out)
+
+		ms, err := a.queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(3, len(ms))
+		is.Equal("a", ms[0].Message["job"])
+		is.Equal("c", ms[2].Message["job"])
+
+		out, err = a.run("queue", "redrive")
+		is.NoErr(err)
+		is.Equal("Moved 1 messages from the dead-letter queue.\n", out)
+
+		stats, err := a.dlq.Stats(context.Background())
+		is.NoErr(err)
+		is.Equal(messaging.QueueStats{}, stats)
+	})
+}
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"canvas/i18n"
+	"canvas/model"
+	"canvas/storage"
+	"canvas/subscribercsv"
+)
+
+// subscriberStore is implemented by storage.Database.
+type subscriberStore interface {
+	ListSubscribers(ctx context.Context, filter storage.SubscriberFilter) ([]model.Subscriber, error)
+	GetSubscriber(ctx context.Context, email model.Email) (*model.Subscriber, error)
+	ConfirmSubscriber(ctx context.Context, email model.Email, consent model.Consent) (*model.Subscriber, error)
+	DeactivateSubscriber(ctx context.Context, email model.Email, consent model.Consent) (*model.Subscriber, error)
+	ImportSubscribers(ctx context.Context, subscribers []model.Subscriber, consent model.Consent) (map[model.Email]string, error)
+	ExportSubscribers(ctx context.Context, filter storage.SubscriberFilter, fn func(model.Subscriber) error) error
+}
+
+var subscriberCommands = map[string]command{
+	"list": {
+		usage:       "[--confirmed=true|false] [--active=true|false] [--limit n] [--json]",
+		description: "List subscribers, oldest first",
+		run:         (*App).listSubscribers,
+	},
+	"find": {
+		usage:       "[--json] <email>",
+		description: "Show a subscriber",
+		run:         (*App).findSubscriber,
+	},
+	"confirm": {
+		usage:       "[--json] <email>",
+		description: "Confirm a subscriber without the confirmation email",
+		run:         (*App).confirmSubscriber,
+	},
+	"deactivate": {
+		usage:       "[--json] <email>",
+		description: "Deactivate a subscriber, so they get no more emails",
+		run:         (*App).deactivateSubscriber,
+	},
+	"import": {
+		usage: "--mode consented|confirm [--email-column email] [--locale-column locale] [--delimiter ,] " +
+			"[--report errors.csv] [--json] <file.csv|->",
+		description: "Import subscribers from CSV, as already consented or by sending confirmation emails",
+		run:         (*App).importSubscribers,
+	},
+	"export": {
+		usage:       "[--confirmed=true|false] [--active=true|false] [--locale en]",
+		description: "Export subscribers as CSV to stdout",
+		run:         (*App).exportSubscribers,
+	},
+}
+
+func (a *App) listSubscribers(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	filter := addSubscriberFilterFlags(fs)
+	limit := fs.Int("limit", 0, "maximum number of subscribers, 0 for all")
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := a.requireSubscribers(); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	f.Limit = *limit
+
+	subscribers, err := a.subscribers.ListSubscribers(ctx, f)
+	if err != nil {
+		return fmt.Errorf("error listing subscribers: %w", err)
+	}
+
+	if *asJSON {
+		return a.printJSON(subscribers)
+	}
+	var rows [][]string
+	for _, s := range subscribers {
+		rows = append(rows, subscribercsv.Row(s))
+	}
+	return a.printTable(upper(subscribercsv.Header), rows)
+}
+
+func (a *App) findSubscriber(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	return a.subscriberAction(ctx, fs, args, subscriberStore.GetSubscriber)
+}
+
+// cliConsent is recorded in the consent log for changes made with the CLI.
+var cliConsent = model.Consent{Source: model.ConsentSourceCLI}
+
+func (a *App) confirmSubscriber(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	return a.subscriberAction(ctx, fs, args,
+		func(s subscriberStore, ctx context.Context, email model.Email) (*model.Subscriber, error) {
+			return s.ConfirmSubscriber(ctx, email, cliConsent)
+		})
+}
+
+func (a *App) deactivateSubscriber(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	return a.subscriberAction(ctx, fs, args,
+		func(s subscriberStore, ctx context.Context, email model.Email) (*model.Subscriber, error) {
+			return s.DeactivateSubscriber(ctx, email, cliConsent)
+		})
+}
+
+// subscriberAction runs an action on the subscriber given by email address, and prints the result.
+func (a *App) subscriberAction(
+	ctx context.Context,
+	fs *flag.FlagSet,
+	args []string,
+	action func(subscriberStore, context.Context, model.Email) (*model.Subscriber, error),
+) error {
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	if err := a.requireSubscribers(); err != nil {
+		return err
+	}
+
+	email := model.Email(fs.Arg(0)).Normalize()
+	s, err := action(a.subscribers, ctx, email)
+	if err != nil {
+		return fmt.Errorf("error with subscriber %v: %w", email, err)
+	}
+	if s == nil {
+		return fmt.Errorf("no subscriber with email %v", email)
+	}
+
+	if *asJSON {
+		return a.printJSON(s)
+	}
+	return a.printTable(upper(subscribercsv.Header), [][]string{subscribercsv.Row(*s)})
+}
+
+func (a *App) importSubscribers(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	mode := fs.String("mode", "", "consented to import subscribers as confirmed, "+
+		"or confirm to send them confirmation emails")
+	emailColumn := fs.String("email-column", "email", "name of the email column in the header")
+	localeColumn := fs.String("locale-column", "locale", "name of the optional locale column in the header")
+	delimiter := fs.String("delimiter", ",", "field delimiter")
+	reportPath := fs.String("report", "", "write every row that isn't imported to this CSV file")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	if *mode == "" {
+		return errors.New("choose an import mode with --mode consented or --mode confirm")
+	}
+	comma := []rune(*delimiter)
+	if len(comma) != 1 {
+		return fmt.Errorf("delimiter must be a single character, got %q", *delimiter)
+	}
+	if err := a.requireSubscribers(); err != nil {
+		return err
+	}
+
+	r := a.stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		r = f
+	}
+
+	opts := subscribercsv.ImportOptions{
+		Columns: subscribercsv.Columns{Email: *emailColumn, Locale: *localeColumn},
+		Comma:   comma[0],
+		Mode:    subscribercsv.Mode(*mode),
+	}
+
+	if *reportPath != "" {
+		f, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w := csv.NewWriter(f)
+		defer w.Flush()
+		_ = w.Write([]string{"line", "email", "reason"})
+		opts.OnError = func(e subscribercsv.RowError) {
+			_ = w.Write([]string{strconv.Itoa(e.Line), e.Email, e.Reason})
+		}
+	}
+
+	importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: a.subscribers})
+	report, err := importer.Import(ctx, r, opts)
+
+	if *asJSON {
+		if printErr := a.printJSON(report); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "Read %v rows: imported %v, skipped %v, invalid %v.\n",
+		report.Rows, report.Imported, report.Skipped, report.Invalid)
+	if len(report.Errors) > 0 {
+		var rows [][]string
+		for _, e := range report.Errors {
+			rows = append(rows, []string{strconv.Itoa(e.Line), e.Email, e.Reason})
+		}
+		if printErr := a.printTable([]string{"LINE", "EMAIL", "REASON"}, rows); printErr != nil {
+			return printErr
+		}
+		if report.ErrorsTruncated {
+			fmt.Fprintln(a.stdout, "More rows were not imported, use --report to get all of them.")
+		}
+	}
+	return err
+}
+
+func (a *App) exportSubscribers(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	filter := addSubscriberFilterFlags(fs)
+	locale := fs.String("locale", "", "only subscribers with this locale")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := a.requireSubscribers(); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	f.Locale = i18n.Locale(*locale)
+
+	return subscribercsv.Export(ctx, a.stdout, a.subscribers, f)
+}
+
+// addSubscriberFilterFlags to fs, returning a function to get the filter after parsing.
+func addSubscriberFilterFlags(fs *flag.FlagSet) func() (storage.SubscriberFilter, error) {
+	confirmed := fs.String("confirmed", "", "only confirmed (true) or unconfirmed (false) subscribers")
+	active := fs.String("active", "", "only active (true) or deactivated (false) subscribers")
+
+	return func() (storage.SubscriberFilter, error) {
+		var f storage.SubscriberFilter
+		var err error
+		if f.Confirmed, err = parseOptionalBool(*confirmed); err != nil {
+			return f, fmt.Errorf("invalid --confirmed value: %w", err)
+		}
+		if f.Active, err = parseOptionalBool(*active); err != nil {
+			return f, fmt.Errorf("invalid --active value: %w", err)
+		}
+		return f, nil
+	}
+}
+
+// parseOptionalBool returns nil for the empty string.
+func parseOptionalBool(v string) (*bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func upper(ss []string) []string {
+	var upper []string
+	for _, s := range ss {
+		upper = append(upper, strings.ToUpper(s))
+	}
+	return upper
+}
+
+func (a *App) requireSubscribers() error {
+	if a.subscribers == nil {
+		return errors.New("no database configured")
+	}
+	return nil
+}
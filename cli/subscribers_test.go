@@ -0,0 +1,135 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/model"
+)
+
+func TestApp_Subscribers(t *testing.T) {
+	t.Run("lists subscribers as a table, filtered", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("subscribers", "list", "--confirmed=false")
+		is.NoErr(err)
+		is.Equal("EMAIL            LOCALE  CONFIRMED  ACTIVE  CREATED               UPDATED\n"+
+			"you@example.com  da      false      true    2026-01-02T03:04:05Z  2026-01-02T03:04:05Z\n", out)
+	})
+
+	t.Run("lists subscribers as JSON", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("subscribers", "list", "--json", "--limit", "1")
+		is.NoErr(err)
+
+		var subscribers []model.Subscriber
+		is.NoErr(json.Unmarshal([]byte(out), &subscribers))
+		is.Equal(1, len(subscribers))
+		is.Equal(model.Email("me@example.com"), subscribers[0].Email)
+		is.True(strings.Contains(out, `"confirmed": true`))
+	})
+
+	t.Run("finds, confirms, and deactivates a subscriber", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("subscribers", "find", "you@example.com")
+		is.NoErr(err)
+		is.True(strings.Contains(out, "you@example.com  da      false      true"))
+
+		_, err = a.run("subscribers", "confirm", "you@example.com")
+		is.NoErr(err)
+		is.True(a.subscribers.subscribers[1].Confirmed)
+
+		out, err = a.run("subscribers", "deactivate", "--json", "you@example.com")
+		is.NoErr(err)
+		is.True(strings.Contains(out, `"active": false`))
+
+		is.Equal([]model.Consent{{Source: "cli"}, {Source: "cli"}}, a.subscribers.consents)
+		is.True(!a.subscribers.subscribers[1].Active)
+
+		_, err = a.run("subscribers", "find", "nobody@example.com")
+		is.True(err != nil)
+		is.Equal("no subscriber with email nobody@example.com", err.Error())
+	})
+
+	t.Run("imports consented subscribers from CSV on stdin, and reports the rows it skips", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		a.stdin.WriteString("E-mail;Language\n" +
+			"me@example.com;de\n" +
+			"Them@example.com;de\n" +
+			"notanemail;\n")
+		out, err := a.run("subscribers", "import", "--mode", "consented", "--email-column", "e-mail",
+			"--locale-column", "language", "--delimiter", ";", "-")
+		is.NoErr(err)
+		is.Equal("Read 3 rows: imported 1, skipped 1, invalid 1.\n"+
+			"LINE  EMAIL           REASON\n"+
+			"4     notanemail      invalid email address\n"+
+			"2     me@example.com  already subscribed\n", out)
+
+		is.Equal(3, len(a.subscribers.subscribers))
+		is.Equal(model.Subscriber{Email: "Them@example.com", Locale: "de", Confirmed: true, Active: true},
+			a.subscribers.subscribers[2])
+	})
+
+	t.Run("imports unconfirmed subscribers in confirm mode", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		a.stdin.WriteString("email\nthem@example.com\n")
+		out, err := a.run("subscribers", "import", "--mode", "confirm", "--json", "-")
+		is.NoErr(err)
+		is.True(strings.Contains(out, `"imported": 1`))
+		is.Equal(model.Subscriber{Email: "them@example.com", Locale: "en", Active: true}, a.subscribers.subscribers[2])
+	})
+
+	t.Run("writes every skipped row to a report file", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		path := filepath.Join(t.TempDir(), "errors.csv")
+		a.stdin.WriteString("email\nnotanemail\nme@example.com\n")
+		_, err := a.run("subscribers", "import", "--mode", "consented", "--report", path, "-")
+		is.NoErr(err)
+
+		report, err := os.ReadFile(path)
+		is.NoErr(err)
+		is.Equal("line,email,reason\n2,notanemail,invalid email address\n3,me@example.com,already subscribed\n",
+			string(report))
+	})
+
+	t.Run("requires an import mode", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		_, err := a.run("subscribers", "import", "-")
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), "--mode"))
+	})
+
+	t.Run("exports subscribers as CSV", func(t *testing.T) {
+		is := is.New(t)
+		a := newTestApp()
+
+		out, err := a.run("subscribers", "export", "--active=true")
+		is.NoErr(err)
+		is.Equal("email,locale,confirmed,active,created,updated\n"+
+			"me@example.com,en,true,true,2026-01-02T03:04:05Z,2026-01-02T03:04:05Z\n"+
+			"you@example.com,da,false,true,2026-01-02T03:04:05Z,2026-01-02T03:04:05Z\n", out)
+
+		out, err = a.run("subscribers", "export", "--locale", "da")
+		is.NoErr(err)
+		is.Equal("email,locale,confirmed,active,created,updated\n"+
+			"you@example.com,da,false,true,2026-01-02T03:04:05Z,2026-01-02T03:04:05Z\n", out)
+	})
+}
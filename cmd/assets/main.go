@@ -0,0 +1,152 @@
+// Package main is a build step that fingerprints the static assets in the public directory.
+// Each asset is copied to a name with a hash of its content, like "css/tailwind.3f2a1b9c.css", and the mapping
+// from asset paths to fingerprinted paths is written to public/manifest.json, for views.Asset to use.
+// Every asset also gets precompressed gzip and brotli variants next to it, like "css/tailwind.3f2a1b9c.css.br",
+// for handlers.Public to serve. Old fingerprinted copies and compressed variants are removed.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"canvas/util"
+)
+
+const manifestName = "manifest.json"
+
+// fingerprintedMatcher for file names with a fingerprint, like "tailwind.3f2a1b9c.css".
+var fingerprintedMatcher = regexp.MustCompile(`\.[0-9a-f]{8}(\.[^.]+)?$`)
+
+// compressedMatcher for precompressed variants of assets, like "tailwind.css.gz".
+var compressedMatcher = regexp.MustCompile(`\.(br|gz)$`)
+
+func main() {
+	os.Exit(start())
+}
+
+func start() int {
+	util.InitializeSlog("development", "", util.RedactingHandlerOptions{})
+
+	dir := "public"
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	manifest, err := fingerprint(dir)
+	if err != nil {
+		slog.Error("Error fingerprinting assets", util.ErrAttr(err))
+		return 1
+	}
+
+	manifestAsBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		slog.Error("Error marshalling manifest", util.ErrAttr(err))
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestName), append(manifestAsBytes, '\n'), 0644); err != nil {
+		slog.Error("Error writing manifest", util.ErrAttr(err))
+		return 1
+	}
+
+	slog.Info("Fingerprinted assets", slog.Int("count", len(manifest)))
+	return 0
+}
+
+// fingerprint all assets in dir, returning the manifest.
+func fingerprint(dir string) (map[string]string, error) {
+	fsys := os.DirFS(dir)
+	manifest := map[string]string{}
+	var stale []string
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || name == manifestName {
+			return err
+		}
+		if fingerprintedMatcher.MatchString(name) || compressedMatcher.MatchString(name) {
+			stale = append(stale, name)
+			return nil
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(content)
+		ext := path.Ext(name)
+		fingerprinted := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(hash[:4]) + ext
+
+		manifest[name] = fingerprinted
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(fingerprinted)), content, 0644); err != nil {
+			return err
+		}
+		if err := compress(dir, name, content); err != nil {
+			return err
+		}
+		return compress(dir, fingerprinted, content)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]bool{}
+	for name, fingerprinted := range manifest {
+		for _, name := range []string{name, fingerprinted} {
+			current[name] = true
+			current[name+".gz"] = true
+			current[name+".br"] = true
+		}
+	}
+	for _, name := range stale {
+		if current[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// compress content of the asset with the given name to gzip and brotli variants next to it.
+func compress(dir, name string, content []byte) error {
+	var gz bytes.Buffer
+	gzw, err := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if err := writeAndClose(gzw, content); err != nil {
+		return err
+	}
+
+	var br bytes.Buffer
+	if err := writeAndClose(brotli.NewWriterLevel(&br, brotli.BestCompression), content); err != nil {
+		return err
+	}
+
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.WriteFile(p+".gz", gz.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(p+".br", br.Bytes(), 0644)
+}
+
+func writeAndClose(w io.WriteCloser, content []byte) error {
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	return w.Close()
+}
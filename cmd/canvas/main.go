@@ -0,0 +1,152 @@
+// Package main is the admin command line interface. It reads the same configuration as the server,
+// sets up only what the given command needs, and runs it. Run it without arguments to see the commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"canvas/cli"
+	"canvas/config"
+	"canvas/messaging"
+	"canvas/model"
+	"canvas/storage"
+	"canvas/util"
+)
+
+func main() {
+	os.Exit(start())
+}
+
+func start() int {
+	c, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config:\n%v\n", err)
+		return 1
+	}
+
+	util.InitializeSlog(c.LogEnv, "", util.RedactingHandlerOptions{Redactors: []util.Redactor{model.EmailRedactor{}}})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	opts := cli.Options{
+		BaseURL: &c.BaseURL,
+		Stderr:  os.Stderr,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+	}
+
+	// Set up only the dependencies of the command group, so for example rendering emails doesn't need a database
+	var group string
+	if len(os.Args) > 1 {
+		group = os.Args[1]
+	}
+	switch group {
+	case "subscribers":
+		if err := c.ValidateDatabase(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid config:\n%v\n", err)
+			return 1
+		}
+		db := storage.NewDatabase(storage.NewDatabaseOptions{
+			Host:     c.DBHost,
+			Port:     c.DBPort,
+			User:     c.DBUser,
+			Password: c.DBPassword,
+			Name:     c.DBName,
+		})
+		if err := db.Connect(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to database: %v\n", err)
+			return 1
+		}
+		opts.Subscribers = db
+
+		// Importing subscribers can send confirmation emails through the queue
+		if err := addQueues(ctx, c, &opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating queue: %v\n", err)
+			return 1
+		}
+
+	case "queue", "jobs":
+		if err := addQueues(ctx, c, &opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating queue: %v\n", err)
+			return 1
+		}
+
+	case "email":
+		var recorder *messaging.EmailRecorder
+		if c.EmailBackend == "fake" {
+			recorder = messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{Log: true})
+		}
+		opts.Emailer = messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:                   &c.BaseURL,
+			MarketingEmailName:        c.MarketingEmailName,
+			MarketingEmailAddress:     c.MarketingEmailAddress,
+			Recorder:                  recorder,
+			Token:                     c.PostmarkToken,
+			TransactionalEmailName:    c.TransactionalEmailName,
+			TransactionalEmailAddress: c.TransactionalEmailAddress,
+		})
+	}
+
+	app := cli.New(opts)
+	if err := app.Run(ctx, os.Args[1:]); err != nil {
+		if errors.Is(err, cli.ErrUsage) {
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// addQueues to the options if the queue backend is SQS.
+// The memory queue only exists inside the server process, so it can't be reached from here.
+func addQueues(ctx context.Context, c config.Config, opts *cli.Options) error {
+	if c.QueueBackend != "sqs" {
+		return nil
+	}
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithEndpointResolverWithOptions(createAWSEndpointResolver(c.SQSEndpointURL)),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating AWS config: %w", err)
+	}
+	opts.Queue = createQueue(c, awsConfig, c.QueueName)
+	if c.QueueDeadLetterName != "" {
+		opts.DeadLetterQueue = createQueue(c, awsConfig, c.QueueDeadLetterName)
+	}
+	return nil
+}
+
+// createQueue with the given name. Receives don't wait long, so commands return quickly on an empty queue.
+func createQueue(c config.Config, awsConfig aws.Config, name string) *messaging.Queue {
+	return messaging.NewQueue(messaging.NewQueueOptions{
+		Config:               awsConfig,
+		DeduplicationIDField: c.QueueDeduplicationIDField,
+		GroupIDField:         c.QueueGroupIDField,
+		Name:                 name,
+		WaitTime:             time.Second,
+	})
+}
+
+// createAWSEndpointResolver used for local development endpoints.
+func createAWSEndpointResolver(sqsEndpointURL string) aws.EndpointResolverWithOptionsFunc {
+	return func(service, region string, opts ...any) (aws.Endpoint, error) {
+		if sqsEndpointURL != "" && service == sqs.ServiceID {
+			return aws.Endpoint{
+				URL: sqsEndpointURL,
+			}, nil
+		}
+		return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+	}
+}
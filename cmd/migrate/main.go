@@ -1,43 +1,86 @@
+// Package main is the migration tool. It migrates with the migrations embedded in the binary,
+// the same ones the server uses, and refuses to migrate if applied migrations have been edited.
 package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/maragudk/env"
-	"github.com/maragudk/migrate"
-
+	"canvas/config"
+	"canvas/model"
 	"canvas/storage"
 	"canvas/util"
 )
 
+const usage = `Usage:
+  migrate status [--json]           show the current version and pending migrations
+  migrate up [--dry-run]            migrate to the latest version
+  migrate down [--dry-run]          migrate all the way down
+  migrate to [--dry-run] <version>  migrate up or down to the version
+  migrate create <name>             create empty up and down files in storage/migrations`
+
 func main() {
 	os.Exit(start())
 }
 
 func start() int {
-	_ = env.Load()
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 1
+	}
+	command := os.Args[1]
 
-	logEnv := env.GetStringOrDefault("LOG_ENV", "development")
-	util.InitializeSlog(logEnv, "")
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the SQL that would run, without running it")
+	asJSON := fs.Bool("json", false, "print as JSON")
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		return 1
+	}
 
-	if len(os.Args) < 2 {
-		slog.Warn("Usage: migrate up|down|to")
+	// Creating migrations works on the source tree, and doesn't need a database
+	if command == "create" {
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, usage)
+			return 1
+		}
+		up, down, err := storage.CreateMigration("storage/migrations", fs.Arg(0), time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating migration: %v\n", err)
+			return 1
+		}
+		fmt.Println(up)
+		fmt.Println(down)
+		return 0
+	}
+
+	c, err := config.Load()
+	if err == nil {
+		err = c.ValidateDatabase()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config:\n%v\n", err)
 		return 1
 	}
 
-	if os.Args[1] == "to" && len(os.Args) < 3 {
-		slog.Info("Usage: migrate to <version>")
+	util.InitializeSlog(c.LogEnv, "", util.RedactingHandlerOptions{Redactors: []util.Redactor{model.EmailRedactor{}}})
+
+	if command == "to" && fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
 		return 1
 	}
 
 	db := storage.NewDatabase(storage.NewDatabaseOptions{
-		Host:     env.GetStringOrDefault("DB_HOST", "localhost"),
-		Port:     env.GetIntOrDefault("DB_PORT", 5432),
-		User:     env.GetStringOrDefault("DB_USER", ""),
-		Password: env.GetStringOrDefault("DB_PASSWORD", ""),
-		Name:     env.GetStringOrDefault("DB_NAME", ""),
+		Host:     c.DBHost,
+		Port:     c.DBPort,
+		User:     c.DBUser,
+		Password: c.DBPassword,
+		Name:     c.DBName,
 	})
 
 	if err := db.Connect(); err != nil {
@@ -45,17 +88,47 @@ func start() int {
 		return 1
 	}
 
-	fsys := os.DirFS("storage/migrations")
-	var err error
-	switch os.Args[1] {
+	ctx := context.Background()
+
+	if command == "status" {
+		return printStatus(ctx, db, *asJSON)
+	}
+
+	if *dryRun {
+		var steps []storage.MigrationStep
+		switch command {
+		case "up":
+			steps, err = db.PlanMigrateUp(ctx)
+		case "down":
+			steps, err = db.PlanMigrateTo(ctx, "")
+		case "to":
+			steps, err = db.PlanMigrateTo(ctx, fs.Arg(0))
+		default:
+			slog.Error("Unknown command", slog.String("name", command))
+			return 1
+		}
+		if err != nil {
+			slog.Error("Error planning migration", util.ErrAttr(err))
+			return 1
+		}
+		if len(steps) == 0 {
+			fmt.Println("-- Nothing to migrate")
+		}
+		for _, step := range steps {
+			fmt.Printf("-- %v\n%v\n", step.Name, strings.TrimSpace(step.SQL))
+		}
+		return 0
+	}
+
+	switch command {
 	case "up":
-		err = migrate.Up(context.Background(), db.DB.DB, fsys)
+		err = db.MigrateUp(ctx)
 	case "down":
-		err = migrate.Down(context.Background(), db.DB.DB, fsys)
+		err = db.MigrateTo(ctx, "")
 	case "to":
-		err = migrate.To(context.Background(), db.DB.DB, fsys, os.Args[2])
+		err = db.MigrateTo(ctx, fs.Arg(0))
 	default:
-		slog.Error("Unknown command", slog.String("name", os.Args[1]))
+		slog.Error("Unknown command", slog.String("name", command))
 		return 1
 	}
 	if err != nil {
@@ -66,3 +139,40 @@ func start() int {
 	slog.Info("Migration completed")
 	return 0
 }
+
+func printStatus(ctx context.Context, db *storage.Database, asJSON bool) int {
+	status, err := db.MigrationStatus(ctx)
+	if err != nil {
+		slog.Error("Error getting migration status", util.ErrAttr(err))
+		return 1
+	}
+
+	if asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(status); err != nil {
+			return 1
+		}
+	} else {
+		current := status.Current
+		if current == "" {
+			current = "(none)"
+		}
+		fmt.Printf("Current version: %v\n", current)
+		fmt.Printf("Latest version:  %v\n", status.Latest)
+		fmt.Printf("Pending:         %v\n", len(status.Pending))
+		for _, v := range status.Pending {
+			fmt.Printf("  %v\n", v)
+		}
+		if len(status.Modified) > 0 {
+			fmt.Printf("Modified since applied: %v\n", len(status.Modified))
+			for _, v := range status.Modified {
+				fmt.Printf("  %v\n", v)
+			}
+		}
+	}
+
+	// Fail on modified migrations, so status can be used as a check in CI and deploys
+	if len(status.Modified) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,15 +1,21 @@
 // Package main is the entry point to the server. It reads configuration, sets up logging and error handling,
 // handles signals from the OS, and starts and stops the server.
+// Run it as "server config print" to print the effective configuration with secrets masked.
 package main
 
 import (
+	"canvas"
+	"canvas/config"
 	"canvas/jobs"
 	"canvas/messaging"
+	"canvas/model"
+	"canvas/ratelimit"
 	"canvas/server"
 	"canvas/storage"
-	"canvas/types"
 	"canvas/util"
+	"canvas/views"
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -17,10 +23,9 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/smithy-go/logging"
-	"github.com/maragudk/env"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"golang.org/x/sync/errgroup"
@@ -30,13 +35,36 @@ import (
 // Used for logging and error reporting.
 var release string
 
-var envConfig types.Config
+var envConfig config.Config
 
 func main() {
-	if err := util.LoadConfig(&envConfig); err != nil {
-		panic(err)
+	var err error
+	envConfig, err = config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	// Print the config before validating it, so it's possible to see what's wrong
+	printConfig := len(os.Args) == 3 && os.Args[1] == "config" && os.Args[2] == "print"
+	if printConfig {
+		if err := envConfig.Print(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+	}
+
+	if err := envConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config:\n%v\n", err)
+		os.Exit(1)
 	}
-	util.InitializeSlog(envConfig.LogEnv, release)
+	if printConfig {
+		os.Exit(0)
+	}
+
+	util.InitializeSlog(envConfig.LogEnv, release, util.RedactingHandlerOptions{
+		Allow:     envConfig.LogAllowKeys,
+		Redactors: []util.Redactor{model.EmailRedactor{}},
+	})
 	os.Exit(start())
 }
 
@@ -46,24 +74,54 @@ func start() int {
 	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	registry.MustRegister(collectors.NewGoCollector())
 
-	awsConfig, err := config.LoadDefaultConfig(context.Background(),
-		config.WithLogger(createAWSLogAdapter()),
-		config.WithEndpointResolverWithOptions(createAWSEndpointResolver()),
-	)
+	// Serve the embedded assets, unless a directory is given for development
+	publicFS := canvas.PublicFS()
+	if envConfig.PublicDir != "" {
+		publicFS = os.DirFS(envConfig.PublicDir)
+	}
 
-	if err != nil {
-		slog.Error("Error creating AWS config", util.ErrAttr(err))
-		return 1
+	// Without the manifest, assets are linked without their fingerprint
+	if err := views.LoadAssetManifest(publicFS); err != nil {
+		slog.Warn("Error loading asset manifest", util.ErrAttr(err))
 	}
 
 	// create a new queue
-	queue := createQueue(awsConfig)
+	queue, err := createQueue()
+	if err != nil {
+		slog.Error("Error creating queue", util.ErrAttr(err))
+		return 1
+	}
 	db := createDatabase(registry)
 	if err := db.Connect(); err != nil {
 		slog.Info("Error connecting to database", util.ErrAttr(err))
 		return 1
 	}
 
+	// Migrate before serving, so new code never runs against the old schema.
+	// Other instances starting at the same time wait for the migration to finish.
+	if envConfig.DBMigrateOnStart {
+		slog.Info("Migrating database")
+		ctx, cancel := context.WithTimeout(context.Background(), envConfig.DBMigrateTimeout)
+		err := db.MigrateUp(ctx)
+		cancel()
+		if err != nil {
+			slog.Error("Error migrating database", util.ErrAttr(err))
+			return 1
+		}
+	}
+
+	// Refuse to serve a schema from a newer release, which this code may not work with
+	if err := db.CheckSchema(context.Background()); err != nil {
+		slog.Error("Error checking database schema", util.ErrAttr(err))
+		return 1
+	}
+
+	// Share rate limits between app instances through the database if configured
+	var rateLimitStore ratelimit.Store
+	if envConfig.RateLimitStore == "postgres" {
+		rateLimitStore = db
+	}
+
 	// create the server
 	s := server.New(server.Options{
 		Database:        db,
@@ -71,15 +129,50 @@ func start() int {
 		Port:            envConfig.Port,
 		Queue:           queue,
 		AdminPassword:   envConfig.AdminPassword,
-		MetricsPassword: env.GetStringOrDefault("METRICS_PASSWORD", "12345678"),
+		SigningKey:      envConfig.SigningKey,
+		MetricsPassword: envConfig.MetricsPassword,
 		Metrics:         registry,
+		PublicFS:        publicFS,
+		RateLimitStore:  rateLimitStore,
+		SecureCookies:   envConfig.BaseURL.Scheme == "https",
+		TrustedProxies:  envConfig.TrustedProxies,
 	})
 
+	emailer, err := createEmailer()
+	if err != nil {
+		slog.Error("Error creating emailer", util.ErrAttr(err))
+		return 1
+	}
+
 	// create the jobs runner
 	r := jobs.NewRunner(jobs.NewRunnerOptions{
-		Emailer: createEmailer(),
-		Queue:   queue,
-		Metrics: registry,
+		Database:      db,
+		Emailer:       emailer,
+		Queue:         queue,
+		Metrics:       registry,
+		ReminderDelay: envConfig.ConfirmationReminderDelay,
+		Retention: jobs.RetentionPolicies{
+			DryRun:                   envConfig.RetentionDryRun,
+			Interval:                 envConfig.RetentionInterval,
+			UnconfirmedDays:          envConfig.RetentionUnconfirmedDays,
+			InactiveMonths:           envConfig.RetentionInactiveMonths,
+			ConsentEventsMonths:      envConfig.RetentionConsentEventsMonths,
+			SequenceDeliveriesMonths: envConfig.RetentionSequenceDeliveriesMonths,
+		},
+	})
+
+	// Start the retention schedule, unless another instance already has.
+	// The retention job keeps it going from there.
+	if err := jobs.ScheduleRetention(context.Background(), db); err != nil {
+		slog.Error("Error scheduling retention job", util.ErrAttr(err))
+		return 1
+	}
+	// create the scheduler for moving scheduled messages to the queue
+	scheduler := jobs.NewScheduler(jobs.NewSchedulerOptions{
+		Database: db,
+		Interval: envConfig.SchedulerInterval,
+		Metrics:  registry,
+		Queue:    queue,
 	})
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
@@ -100,6 +193,12 @@ func start() int {
 		return nil
 	})
 
+	// spawn the scheduler in a another goroutine
+	eg.Go(func() error {
+		scheduler.Start(ctx)
+		return nil
+	})
+
 	<-ctx.Done()
 
 	// gracefully shutdown the server
@@ -149,7 +248,7 @@ func createAWSLogAdapter() logging.LoggerFunc {
 // createAWSEndpointResolver used for local development endpoints.
 // See https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk/endpoints/
 func createAWSEndpointResolver() aws.EndpointResolverWithOptionsFunc {
-	sqsEndpointURL := env.GetStringOrDefault("SQS_ENDPOINT_URL", "")
+	sqsEndpointURL := envConfig.SQSEndpointURL
 
 	return func(service, region string, opts ...any) (aws.Endpoint, error) {
 		if sqsEndpointURL != "" && service == sqs.ServiceID {
@@ -162,25 +261,66 @@ func createAWSEndpointResolver() aws.EndpointResolverWithOptionsFunc {
 	}
 }
 
-// …
+// queue is implemented by both messaging.Queue and messaging.MemoryQueue.
+type queue interface {
+	Send(ctx context.Context, m model.Message) error
+	SendWithOptions(ctx context.Context, m model.Message, opts messaging.SendOptions) error
+	SendBatch(ctx context.Context, ms []model.Message) error
+	ReceiveBatch(ctx context.Context) ([]messaging.ReceivedMessage, error)
+	ChangeVisibility(ctx context.Context, receiptID string, timeout time.Duration) error
+	DeleteBatch(ctx context.Context, receiptIDs []string) error
+}
+
+// createQueue from the QUEUE_BACKEND config, either "sqs" or "memory".
+// The memory queue makes it possible to run the app with only a database, but loses messages on restarts.
+func createQueue() (queue, error) {
+	switch envConfig.QueueBackend {
+	case "sqs":
+	case "memory":
+		return messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{
+			VisibilityTimeout: time.Minute,
+			WaitTime:          envConfig.QueueWaitTime,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown queue backend %v", envConfig.QueueBackend)
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithLogger(createAWSLogAdapter()),
+		awsconfig.WithEndpointResolverWithOptions(createAWSEndpointResolver()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS config: %w", err)
+	}
 
-func createQueue(awsConfig aws.Config) *messaging.Queue {
 	return messaging.NewQueue(messaging.NewQueueOptions{
-		Config:   awsConfig,
-		Name:     env.GetStringOrDefault("QUEUE_NAME", "jobs"),
-		WaitTime: env.GetDurationOrDefault("QUEUE_WAIT_TIME", 20*time.Second),
-	})
+		Config:               awsConfig,
+		DeduplicationIDField: envConfig.QueueDeduplicationIDField,
+		GroupIDField:         envConfig.QueueGroupIDField,
+		Name:                 envConfig.QueueName,
+		WaitTime:             envConfig.QueueWaitTime,
+	}), nil
 }
 
-func createEmailer() *messaging.Emailer {
+// createEmailer from the EMAIL_BACKEND config, either "postmark" or "fake".
+// The fake emailer logs emails instead of sending them.
+func createEmailer() (*messaging.Emailer, error) {
+	var recorder *messaging.EmailRecorder
+	switch envConfig.EmailBackend {
+	case "postmark":
+	case "fake":
+		recorder = messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{Log: true})
+	default:
+		return nil, fmt.Errorf("unknown email backend %v", envConfig.EmailBackend)
+	}
+
 	return messaging.NewEmailer(messaging.NewEmailerOptions{
-		BaseURL:            &envConfig.BaseURL,
-		MarketingEmailName: env.GetStringOrDefault("MARKETING_EMAIL_NAME", "Canvas bot"),
-		MarketingEmailAddress: env.GetStringOrDefault("MARKETING_EMAIL_ADDRESS",
-			"bot@marketing.example.com"),
-		Token:                  env.GetStringOrDefault("POSTMARK_TOKEN", ""),
-		TransactionalEmailName: env.GetStringOrDefault("TRANSACTIONAL_EMAIL_NAME", "Canvas bot"),
-		TransactionalEmailAddress: env.GetStringOrDefault("TRANSACTIONAL_EMAIL_ADDRESS",
-			"bot@transactional.example.com"),
-	})
+		BaseURL:                   &envConfig.BaseURL,
+		MarketingEmailName:        envConfig.MarketingEmailName,
+		MarketingEmailAddress:     envConfig.MarketingEmailAddress,
+		Recorder:                  recorder,
+		Token:                     envConfig.PostmarkToken,
+		TransactionalEmailName:    envConfig.TransactionalEmailName,
+		TransactionalEmailAddress: envConfig.TransactionalEmailAddress,
+	}), nil
 }
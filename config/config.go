@@ -0,0 +1,338 @@
+// Package config loads and validates the configuration for all binaries from environment variables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	dotenv "github.com/maragudk/env"
+
+	"canvas/model"
+)
+
+// Config from environment variables. Fields tagged secret can also be read from a file, see Load.
+type Config struct {
+	LogEnv       string   `env:"LOG_ENV"        envDefault:"development"`
+	LogAllowKeys []string `env:"LOG_ALLOW_KEYS" envDefault:""`
+
+	Host            string         `env:"HOST"             envDefault:""`
+	Port            int            `env:"PORT"             envDefault:"8080"`
+	BaseURL         url.URL        `env:"BASE_URL"         envDefault:"http://localhost:8080"`
+	AdminPassword   string         `env:"ADMIN_PASSWORD"   secret:"true"`
+	MetricsPassword string         `env:"METRICS_PASSWORD" secret:"true"`
+	SigningKey      string         `env:"SIGNING_KEY"      secret:"true"`
+	PublicDir       string         `env:"PUBLIC_DIR"       envDefault:""`
+	TrustedProxies  []netip.Prefix `env:"TRUSTED_PROXIES"  envDefault:""`
+	RateLimitStore  string         `env:"RATE_LIMIT_STORE" envDefault:"memory"`
+
+	DBUser                  string        `env:"DB_USER"`
+	DBPassword              string        `env:"DB_PASSWORD"                secret:"true"`
+	DBHost                  string        `env:"DB_HOST"                    envDefault:"localhost"`
+	DBPort                  int           `env:"DB_PORT"                    envDefault:"5432"`
+	DBName                  string        `env:"DB_NAME"`
+	DBMaxOpenConnections    int           `env:"DB_MAX_OPEN_CONNECTIONS"    envDefault:"10"`
+	DBMaxIdleConnections    int           `env:"DB_MAX_IDLE_CONNECTIONS"    envDefault:"10"`
+	DBConnectionMaxLifetime time.Duration `env:"DB_CONNECTION_MAX_LIFETIME" envDefault:"1h"`
+	DBMigrateOnStart        bool          `env:"DB_MIGRATE_ON_START"        envDefault:"false"`
+	DBMigrateTimeout        time.Duration `env:"DB_MIGRATE_TIMEOUT"         envDefault:"5m"`
+
+	EmailBackend              string `env:"EMAIL_BACKEND"               envDefault:"postmark"`
+	PostmarkToken             string `env:"POSTMARK_TOKEN"              secret:"true"`
+	MarketingEmailName        string `env:"MARKETING_EMAIL_NAME"        envDefault:"Canvas bot"`
+	MarketingEmailAddress     string `env:"MARKETING_EMAIL_ADDRESS"`
+	TransactionalEmailName    string `env:"TRANSACTIONAL_EMAIL_NAME"    envDefault:"Canvas bot"`
+	TransactionalEmailAddress string `env:"TRANSACTIONAL_EMAIL_ADDRESS"`
+
+	QueueBackend              string        `env:"QUEUE_BACKEND"                envDefault:"sqs"`
+	QueueName                 string        `env:"QUEUE_NAME"                   envDefault:"jobs"`
+	QueueWaitTime             time.Duration `env:"QUEUE_WAIT_TIME"              envDefault:"20s"`
+	QueueDeduplicationIDField string        `env:"QUEUE_DEDUPLICATION_ID_FIELD" envDefault:"idempotency_key"`
+	QueueGroupIDField         string        `env:"QUEUE_GROUP_ID_FIELD"         envDefault:"email"`
+	QueueDeadLetterName       string        `env:"QUEUE_DEAD_LETTER_NAME"       envDefault:""`
+	SQSEndpointURL            string        `env:"SQS_ENDPOINT_URL"             envDefault:""`
+	SchedulerInterval         time.Duration `env:"SCHEDULER_INTERVAL"           envDefault:"10s"`
+
+	// ConfirmationReminderDelay after the confirmation email before an unconfirmed subscriber gets a reminder.
+	// Zero disables reminders.
+	ConfirmationReminderDelay time.Duration `env:"CONFIRMATION_REMINDER_DELAY" envDefault:"0"`
+
+	// Retention policies for personal data, see jobs.RetentionPolicies. Zero disables a policy.
+	RetentionInterval                 time.Duration `env:"RETENTION_INTERVAL"                   envDefault:"24h"`
+	RetentionDryRun                   bool          `env:"RETENTION_DRY_RUN"                    envDefault:"false"`
+	RetentionUnconfirmedDays          int           `env:"RETENTION_UNCONFIRMED_DAYS"           envDefault:"0"`
+	RetentionInactiveMonths           int           `env:"RETENTION_INACTIVE_MONTHS"            envDefault:"0"`
+	RetentionConsentEventsMonths      int           `env:"RETENTION_CONSENT_EVENTS_MONTHS"      envDefault:"0"`
+	RetentionSequenceDeliveriesMonths int           `env:"RETENTION_SEQUENCE_DELIVERIES_MONTHS" envDefault:"0"`
+
+	AWSAccessKeyID     string `env:"AWS_ACCESS_KEY_ID"     envDefault:""`
+	AWSSecretAccessKey string `env:"AWS_SECRET_ACCESS_KEY" envDefault:"" secret:"true"`
+}
+
+// Load the config from environment variables, and from a .env file in the working directory if there is one.
+// Secrets can instead be read from a file named by the variable with a _FILE suffix,
+// such as DB_PASSWORD_FILE=/run/secrets/db_password for Docker and Kubernetes secrets.
+// All parse errors are returned together. Load doesn't validate the config, see Config.Validate.
+func Load() (Config, error) {
+	// Ignore the error, because on the server the environment variables come from the OS
+	_ = dotenv.Load()
+
+	environment := env.ToMap(os.Environ())
+
+	var errs []error
+	for _, name := range secretNames() {
+		path := environment[name+"_FILE"]
+		if path == "" {
+			continue
+		}
+		if environment[name] != "" {
+			errs = append(errs, fmt.Errorf("only one of %v and %v_FILE can be set", name, name))
+			continue
+		}
+		value, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error reading %v_FILE: %w", name, err))
+			continue
+		}
+		environment[name] = strings.TrimRight(string(value), "\r\n")
+	}
+
+	var c Config
+	err := env.ParseWithOptions(&c, env.Options{
+		Environment: environment,
+		FuncMap: map[reflect.Type]env.ParserFunc{
+			reflect.TypeOf(url.URL{}):        parseURL,
+			reflect.TypeOf([]netip.Prefix{}): parsePrefixes,
+		},
+	})
+	var aggregateErr env.AggregateError
+	if errors.As(err, &aggregateErr) {
+		for _, err := range aggregateErr.Errors {
+			errs = append(errs, nameParseError(err))
+		}
+	} else if err != nil {
+		errs = append(errs, err)
+	}
+
+	return c, errors.Join(errs...)
+}
+
+// Validate the config for running the server, returning all problems together.
+func (c Config) Validate() error {
+	errs := c.validateDatabase()
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be between 1 and 65535, got %v", c.Port))
+	}
+	if (c.BaseURL.Scheme != "http" && c.BaseURL.Scheme != "https") || c.BaseURL.Host == "" {
+		errs = append(errs, fmt.Errorf("BASE_URL must be an absolute http or https URL, got %q", c.BaseURL.String()))
+	}
+	errs = appendIfEmpty(errs, "ADMIN_PASSWORD", c.AdminPassword)
+	errs = appendIfEmpty(errs, "METRICS_PASSWORD", c.MetricsPassword)
+	// The signing key must be long enough to not be guessable
+	if len(c.SigningKey) < 32 {
+		errs = append(errs, fmt.Errorf("SIGNING_KEY must be at least 32 characters, got %v", len(c.SigningKey)))
+	}
+	errs = appendIfNotOneOf(errs, "RATE_LIMIT_STORE", c.RateLimitStore, "memory", "postgres")
+
+	errs = appendIfNotOneOf(errs, "EMAIL_BACKEND", c.EmailBackend, "postmark", "fake")
+	if c.EmailBackend == "postmark" && c.PostmarkToken == "" {
+		errs = append(errs, errors.New("POSTMARK_TOKEN is required when EMAIL_BACKEND is postmark"))
+	}
+	errs = appendIfInvalidEmail(errs, "MARKETING_EMAIL_ADDRESS", c.MarketingEmailAddress)
+	errs = appendIfInvalidEmail(errs, "TRANSACTIONAL_EMAIL_ADDRESS", c.TransactionalEmailAddress)
+
+	errs = appendIfNotOneOf(errs, "QUEUE_BACKEND", c.QueueBackend, "sqs", "memory")
+	if c.QueueBackend == "sqs" {
+		errs = appendIfEmpty(errs, "QUEUE_NAME", c.QueueName)
+		// SQS long polling waits at most 20 seconds
+		if c.QueueWaitTime < 0 || c.QueueWaitTime > 20*time.Second {
+			errs = append(errs, fmt.Errorf("QUEUE_WAIT_TIME must be between 0s and 20s when QUEUE_BACKEND is sqs, got %v",
+				c.QueueWaitTime))
+		}
+	}
+	if c.SchedulerInterval <= 0 {
+		errs = append(errs, fmt.Errorf("SCHEDULER_INTERVAL must be positive, got %v", c.SchedulerInterval))
+	}
+	if c.DBMigrateOnStart && c.DBMigrateTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("DB_MIGRATE_TIMEOUT must be positive, got %v", c.DBMigrateTimeout))
+	}
+	// Migrating holds the migration lock on one connection while migrating on another
+	if c.DBMaxOpenConnections == 1 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNECTIONS must be at least 2"))
+	}
+	if c.ConfirmationReminderDelay < 0 {
+		errs = append(errs, fmt.Errorf("CONFIRMATION_REMINDER_DELAY can't be negative, got %v", c.ConfirmationReminderDelay))
+	}
+	if c.ConfirmationReminderDelay > 0 && c.RetentionUnconfirmedDays > 0 &&
+		c.ConfirmationReminderDelay >= time.Duration(c.RetentionUnconfirmedDays)*24*time.Hour {
+		errs = append(errs, fmt.Errorf("CONFIRMATION_REMINDER_DELAY must be shorter than RETENTION_UNCONFIRMED_DAYS, got %v",
+			c.ConfirmationReminderDelay))
+	}
+	if c.RetentionInterval <= 0 {
+		errs = append(errs, fmt.Errorf("RETENTION_INTERVAL must be positive, got %v", c.RetentionInterval))
+	}
+	errs = appendIfNegative(errs, "RETENTION_UNCONFIRMED_DAYS", c.RetentionUnconfirmedDays)
+	errs = appendIfNegative(errs, "RETENTION_INACTIVE_MONTHS", c.RetentionInactiveMonths)
+	errs = appendIfNegative(errs, "RETENTION_CONSENT_EVENTS_MONTHS", c.RetentionConsentEventsMonths)
+	errs = appendIfNegative(errs, "RETENTION_SEQUENCE_DELIVERIES_MONTHS", c.RetentionSequenceDeliveriesMonths)
+
+	return errors.Join(errs...)
+}
+
+// ValidateDatabase config only, for binaries that just need the database, returning all problems together.
+func (c Config) ValidateDatabase() error {
+	return errors.Join(c.validateDatabase()...)
+}
+
+func (c Config) validateDatabase() []error {
+	var errs []error
+	errs = appendIfEmpty(errs, "DB_USER", c.DBUser)
+	errs = appendIfEmpty(errs, "DB_PASSWORD", c.DBPassword)
+	errs = appendIfEmpty(errs, "DB_NAME", c.DBName)
+	if c.DBPort < 1 || c.DBPort > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT must be between 1 and 65535, got %v", c.DBPort))
+	}
+	if c.DBMaxIdleConnections > c.DBMaxOpenConnections {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNECTIONS (%v) can't be more than DB_MAX_OPEN_CONNECTIONS (%v)",
+			c.DBMaxIdleConnections, c.DBMaxOpenConnections))
+	}
+	return errs
+}
+
+// Print the config as environment variables, one per line, with the values of secrets masked.
+func (c Config) Print(w io.Writer) error {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		value := formatValue(v.Field(i))
+		if t.Field(i).Tag.Get("secret") == "true" && value != "" {
+			value = "********"
+		}
+		if _, err := fmt.Fprintf(w, "%v=%v\n", envName(t.Field(i)), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatValue of a config field, in the format it's parsed from, with passwords in URLs redacted.
+func formatValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case url.URL:
+		return value.Redacted()
+	case []string:
+		return strings.Join(value, ",")
+	case []netip.Prefix:
+		var prefixes []string
+		for _, p := range value {
+			prefixes = append(prefixes, p.String())
+		}
+		return strings.Join(prefixes, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// nameParseError with the environment variable name instead of the config field name.
+func nameParseError(err error) error {
+	var parseErr env.ParseError
+	if !errors.As(err, &parseErr) {
+		return err
+	}
+	if f, ok := reflect.TypeOf(Config{}).FieldByName(parseErr.Name); ok {
+		return fmt.Errorf("%v is invalid: %w", envName(f), parseErr.Err)
+	}
+	return err
+}
+
+// secretNames are the environment variable names of the config fields tagged secret.
+func secretNames() []string {
+	var names []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") == "true" {
+			names = append(names, envName(t.Field(i)))
+		}
+	}
+	return names
+}
+
+func envName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+	return name
+}
+
+func appendIfEmpty(errs []error, name, value string) []error {
+	if value == "" {
+		return append(errs, fmt.Errorf("%v is required", name))
+	}
+	return errs
+}
+
+func appendIfNotOneOf(errs []error, name, value string, allowed ...string) []error {
+	for _, a := range allowed {
+		if value == a {
+			return errs
+		}
+	}
+	return append(errs, fmt.Errorf("%v must be one of %v, got %q", name, strings.Join(allowed, ", "), value))
+}
+
+func appendIfInvalidEmail(errs []error, name, value string) []error {
+	if value == "" {
+		return append(errs, fmt.Errorf("%v is required", name))
+	}
+	if !model.Email(value).IsValid() {
+		return append(errs, fmt.Errorf("%v must be an email address, got %q", name, value))
+	}
+	return errs
+}
+
+// parseURL for env.ParserFunc.
+func parseURL(value string) (any, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+	return *u, nil
+}
+
+// parsePrefixes for env.ParserFunc, from a comma-separated list of IP addresses or CIDR ranges like "10.0.0.0/8".
+func parsePrefixes(value string) (any, error) {
+	var prefixes []netip.Prefix
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func appendIfNegative(errs []error, name string, value int) []error {
+	if value < 0 {
+		return append(errs, fmt.Errorf("%v can't be negative, got %v", name, value))
+	}
+	return errs
+}
@@ -4,14 +4,13 @@ go 1.22.2
 
 require (
 	github.com/go-chi/chi/v5 v5.0.12
-	github.com/maragudk/gomponents v0.20.2
-	github.com/maragudk/gomponents-heroicons v0.5.0
 	github.com/matryer/is v1.4.1
 	golang.org/x/sync v0.7.0
 )
 
 require (
 	github.com/a-h/templ v0.2.663
+	github.com/andybalholm/brotli v1.2.6
 	github.com/aws/aws-sdk-go-v2 v1.26.1
 	github.com/aws/aws-sdk-go-v2/config v1.27.11
 	github.com/aws/aws-sdk-go-v2/service/sqs v1.31.4
@@ -22,6 +21,7 @@ require (
 	github.com/maragudk/env v0.1.2
 	github.com/maragudk/migrate v0.4.3
 	github.com/prometheus/client_golang v1.20.5
+	golang.org/x/net v0.27.0
 )
 
 require (
@@ -49,7 +49,7 @@ require (
 	github.com/prometheus/client_model v0.6.1 // indirect
 	github.com/prometheus/common v0.55.0 // indirect
 	github.com/prometheus/procfs v0.15.1 // indirect
-	golang.org/x/crypto v0.20.0 // indirect
+	golang.org/x/crypto v0.25.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"canvas/model"
+	"canvas/util"
+	"canvas/views"
+)
+
+type consentEventLister interface {
+	GetSubscriber(ctx context.Context, email model.Email) (*model.Subscriber, error)
+	ListConsentEvents(ctx context.Context, email model.Email) ([]model.ConsentEvent, error)
+}
+
+// SubscriberTimeline of consent events for the email address in the query, with the subscriber's current state.
+// The timeline is shown even if the subscriber is gone, since the events are kept.
+func SubscriberTimeline(mux chi.Router, s consentEventLister) {
+	mux.Get("/admin/subscribers/timeline", func(w http.ResponseWriter, r *http.Request) {
+		email := model.Email(r.URL.Query().Get("email")).Normalize()
+		if !email.IsValid() {
+			render(w, r, http.StatusBadRequest, views.SubscribersPage("Enter a valid email address to see its timeline."))
+			return
+		}
+
+		subscriber, err := s.GetSubscriber(r.Context(), email)
+		if err != nil {
+			util.Logger(r.Context()).Error("Error getting subscriber", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+
+		events, err := s.ListConsentEvents(r.Context(), email)
+		if err != nil {
+			util.Logger(r.Context()).Error("Error listing consent events", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+
+		render(w, r, http.StatusOK, views.SubscriberTimelinePage(email, subscriber, events))
+	})
+}
+
+// consentFromRequest with the given source, and the client IP and user agent of the request.
+func consentFromRequest(r *http.Request, source string) model.Consent {
+	return model.Consent{
+		Source:    source,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"canvas/views"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+type csrfContextKey struct{}
+
+// CSRFOptions for CSRF and RejectCrossOrigin.
+type CSRFOptions struct {
+	// Secure sets the Secure attribute on the CSRF cookie, so it's only sent over HTTPS.
+	Secure bool
+	// TrustedOrigins that may send unsafe requests cross-origin, such as "https://example.com".
+	TrustedOrigins []string
+}
+
+// CSRF constructs middleware that protects form posts against cross-site request forgery.
+// Unsafe requests must pass the same checks as in RejectCrossOrigin, and must also carry the token
+// from the CSRF cookie in the form field from views.CSRFField or the X-CSRF-Token header.
+// This is the double-submit cookie pattern.
+// The token for the current request is available through CSRFToken.
+func CSRF(opts CSRFOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+				token = cookie.Value
+			} else {
+				var err error
+				token, err = createCSRFToken()
+				if err != nil {
+					renderError(w, r, http.StatusInternalServerError, "")
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     csrfCookieName,
+					Value:    token,
+					Path:     "/",
+					Secure:   opts.Secure,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			if !isSafeMethod(r.Method) {
+				if isCrossOrigin(r, opts.TrustedOrigins) || !isValidCSRFToken(r, token) {
+					renderCSRFError(w, r)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), csrfContextKey{}, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RejectCrossOrigin constructs middleware that rejects unsafe requests from other origins, based on the
+// Sec-Fetch-Site and Origin headers that browsers send.
+// Requests with neither header don't come from a browser, and are let through. Use this for routes that
+// are used by API clients, where CSRF with its cookie isn't an option.
+func RejectCrossOrigin(opts CSRFOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isSafeMethod(r.Method) && isCrossOrigin(r, opts.TrustedOrigins) {
+				renderCSRFError(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSRFToken for the request, set by the CSRF middleware. Pass it to views.CSRFField in forms.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+func createCSRFToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// isCrossOrigin checks whether the request comes from another origin that isn't trusted.
+// Sec-Fetch-Site is preferred, with a fallback to comparing Origin to the Host header for older browsers.
+// See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Sec-Fetch-Site
+func isCrossOrigin(r *http.Request, trustedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if slices.Contains(trustedOrigins, origin) {
+		return false
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return false
+	case "":
+	default:
+		return true
+	}
+
+	if origin == "" {
+		return false
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return true
+	}
+	return originURL.Host != r.Host
+}
+
+// isValidCSRFToken checks that the token in the form field or header matches the token from the cookie,
+// in constant time.
+func isValidCSRFToken(r *http.Request, token string) bool {
+	requestToken := r.Header.Get(csrfHeaderName)
+	if requestToken == "" {
+		requestToken = r.PostFormValue(views.CSRFFieldName)
+	}
+	return requestToken != "" && subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) == 1
+}
+
+func renderCSRFError(w http.ResponseWriter, r *http.Request) {
+	renderError(w, r, http.StatusForbidden, "error.message.csrf")
+}
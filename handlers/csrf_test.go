@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+)
+
+func TestCSRF(t *testing.T) {
+	mux := chi.NewMux()
+	mux.Use(handlers.CSRF(handlers.CSRFOptions{TrustedOrigins: []string{"https://trusted.example.com"}}))
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(handlers.CSRFToken(r)))
+	})
+	mux.Post("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	// getToken from a GET request, which sets the CSRF cookie.
+	getToken := func(is *is.I) (string, *http.Cookie) {
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+		cookies := res.Result().Cookies()
+		is.Equal(1, len(cookies))
+		is.Equal("csrf_token", cookies[0].Name)
+		is.True(cookies[0].HttpOnly)
+		is.Equal(cookies[0].Value, res.Body.String())
+		return res.Body.String(), cookies[0]
+	}
+
+	// post the form with the given token and cookie, returning the status code and body.
+	post := func(token string, cookie *http.Cookie, header http.Header) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+		req.Header = createFormHeader()
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		return res.Code, res.Body.String()
+	}
+
+	t.Run("accepts a form post with the token from the cookie", func(t *testing.T) {
+		is := is.New(t)
+
+		token, cookie := getToken(is)
+		code, _ := post(token, cookie, http.Header{"Sec-Fetch-Site": {"same-origin"}})
+		is.Equal(http.StatusOK, code)
+	})
+
+	t.Run("keeps the token from an existing cookie", func(t *testing.T) {
+		is := is.New(t)
+
+		_, cookie := getToken(is)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		is.Equal(cookie.Value, res.Body.String())
+		is.Equal(0, len(res.Result().Cookies()))
+	})
+
+	t.Run("rejects a form post without a cookie", func(t *testing.T) {
+		is := is.New(t)
+
+		token, _ := getToken(is)
+		code, body := post(token, nil, nil)
+		is.Equal(http.StatusForbidden, code)
+		is.True(strings.Contains(body, "Your request could not be verified"))
+	})
+
+	t.Run("rejects a form post with a token that doesn't match the cookie", func(t *testing.T) {
+		is := is.New(t)
+
+		_, cookie := getToken(is)
+		code, _ := post("notthetoken", cookie, nil)
+		is.Equal(http.StatusForbidden, code)
+	})
+
+	t.Run("rejects a cross-site form post, even with a valid token", func(t *testing.T) {
+		is := is.New(t)
+
+		token, cookie := getToken(is)
+		code, _ := post(token, cookie, http.Header{"Sec-Fetch-Site": {"cross-site"}})
+		is.Equal(http.StatusForbidden, code)
+
+		code, _ = post(token, cookie, http.Header{"Origin": {"https://evil.example.com"}})
+		is.Equal(http.StatusForbidden, code)
+	})
+
+	t.Run("accepts a form post from a trusted origin", func(t *testing.T) {
+		is := is.New(t)
+
+		token, cookie := getToken(is)
+		code, _ := post(token, cookie, http.Header{
+			"Origin":         {"https://trusted.example.com"},
+			"Sec-Fetch-Site": {"cross-site"},
+		})
+		is.Equal(http.StatusOK, code)
+	})
+
+	t.Run("accepts the token in a header", func(t *testing.T) {
+		is := is.New(t)
+
+		token, cookie := getToken(is)
+		code, _ := post("", cookie, http.Header{"X-Csrf-Token": {token}, "Origin": {"http://example.com"}})
+		is.Equal(http.StatusOK, code)
+	})
+}
+
+func TestRejectCrossOrigin(t *testing.T) {
+	mux := chi.NewMux()
+	mux.Use(handlers.RejectCrossOrigin(handlers.CSRFOptions{}))
+	mux.Post("/migrate/up", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name   string
+		header http.Header
+		code   int
+	}{
+		{"allows requests without browser headers", http.Header{}, http.StatusOK},
+		{"allows same-origin requests", http.Header{"Sec-Fetch-Site": {"same-origin"}}, http.StatusOK},
+		{"allows requests from the same host", http.Header{"Origin": {"http://example.com"}}, http.StatusOK},
+		{"rejects same-site requests", http.Header{"Sec-Fetch-Site": {"same-site"}}, http.StatusForbidden},
+		{"rejects cross-site requests", http.Header{"Sec-Fetch-Site": {"cross-site"}}, http.StatusForbidden},
+		{"rejects requests from other origins", http.Header{"Origin": {"https://evil.example.com"}},
+			http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			code, _, _ := makePostRequest(mux, "/migrate/up", test.header, nil)
+			is.Equal(test.code, code)
+		})
+	}
+}
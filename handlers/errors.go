@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"canvas/i18n"
+	"canvas/util"
+	"canvas/views"
+)
+
+// errorTitles are catalog keys for error page titles by status code. Other server errors get the title for 500.
+var errorTitles = map[int]string{
+	http.StatusBadRequest:          "error.title.400",
+	http.StatusForbidden:           "error.title.403",
+	http.StatusNotFound:            "error.title.404",
+	http.StatusMethodNotAllowed:    "error.title.405",
+	http.StatusTooManyRequests:     "error.title.429",
+	http.StatusInternalServerError: "error.title.500",
+}
+
+const notFoundMessage = "error.message.not_found"
+
+// errorResponse is the body of JSON errors.
+type errorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+	Status    int    `json:"status"`
+}
+
+// Errors sets handlers for unknown routes and methods that render error pages.
+func Errors(mux chi.Router) {
+	mux.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		renderError(w, r, http.StatusNotFound, notFoundMessage)
+	})
+
+	mux.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		renderError(w, r, http.StatusMethodNotAllowed, "error.message.method_not_allowed")
+	})
+}
+
+// Recoverer constructs middleware that recovers from panics in handlers, logs them with a stack trace,
+// and renders a 500 error.
+func Recoverer() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// ErrAbortHandler is used to abort a response on purpose, so let the HTTP server handle it
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				util.Logger(r.Context()).Error("Recovered from panic",
+					slog.Any("panic", rec), slog.String("stack", string(debug.Stack())))
+				renderError(w, r, http.StatusInternalServerError, "")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// renderError with the status code, as JSON if the client prefers it, otherwise as an HTML error page,
+// or just the error message for htmx requests, swapped in below the form so it can be submitted again.
+// The title and the message are translated to the request locale, with the message given as a catalog key.
+// Server errors get a generic message if messageKey is empty, and include the request ID for reference.
+func renderError(w http.ResponseWriter, r *http.Request, status int, messageKey string) {
+	titleKey, ok := errorTitles[status]
+	if !ok && status >= 500 {
+		titleKey = errorTitles[http.StatusInternalServerError]
+	}
+	if messageKey == "" && status >= 500 {
+		messageKey = "error.message.server"
+	}
+	title := i18n.T(r.Context(), titleKey)
+	message := i18n.T(r.Context(), messageKey)
+
+	var requestID string
+	if status >= 500 {
+		requestID = RequestID(r)
+	}
+
+	if prefersJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(errorResponse{Error: message, RequestID: requestID, Status: status})
+		return
+	}
+
+	if isHTMX(r) {
+		w.Header().Set("HX-Retarget", "#"+views.FormErrorID)
+		w.Header().Set("HX-Reswap", "innerHTML")
+	}
+	renderPageOrFragment(w, r, status, views.ErrorPage(r.URL.Path, title, message, requestID),
+		views.ErrorMessage(message, requestID))
+}
+
+// prefersJSON is true if the first media type in the Accept header is JSON.
+func prefersJSON(r *http.Request) bool {
+	accept, _, _ := strings.Cut(r.Header.Get("Accept"), ",")
+	mediaType, _, err := mime.ParseMediaType(accept)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
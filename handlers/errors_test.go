@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+)
+
+func TestErrors(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.Errors(mux)
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("renders an HTML page for unknown routes", func(t *testing.T) {
+		is := is.New(t)
+
+		code, header, body := makeGetRequest(mux, "/doesnotexist")
+		is.Equal(http.StatusNotFound, code)
+		is.Equal("text/html; charset=utf-8", header.Get("Content-Type"))
+		is.True(strings.Contains(body, "<h1>Page not found</h1>"))
+	})
+
+	t.Run("renders an HTML page for unknown methods", func(t *testing.T) {
+		is := is.New(t)
+
+		code, _, body := makePostRequest(mux, "/", http.Header{}, nil)
+		is.Equal(http.StatusMethodNotAllowed, code)
+		is.True(strings.Contains(body, "<h1>Method not allowed</h1>"))
+	})
+
+	t.Run("swaps just the message in below the form for htmx requests", func(t *testing.T) {
+		is := is.New(t)
+
+		header := http.Header{}
+		header.Set("HX-Request", "true")
+		code, header, body := makePostRequest(mux, "/", header, nil)
+		is.Equal(http.StatusMethodNotAllowed, code)
+		is.Equal("#form-error", header.Get("HX-Retarget"))
+		is.Equal("innerHTML", header.Get("HX-Reswap"))
+		is.True(strings.HasPrefix(body, `<div role="alert">`))
+		is.True(!strings.Contains(body, "<html"))
+	})
+
+	t.Run("renders JSON if the client prefers it", func(t *testing.T) {
+		is := is.New(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/doesnotexist", nil)
+		req.Header.Set("Accept", "application/json, text/plain, */*")
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		is.Equal(http.StatusNotFound, res.Code)
+		is.Equal("application/json", res.Header().Get("Content-Type"))
+		var body map[string]any
+		is.NoErr(json.Unmarshal(res.Body.Bytes(), &body))
+		is.Equal(float64(http.StatusNotFound), body["status"])
+		is.True(body["error"] != "")
+	})
+}
+
+func TestRecoverer(t *testing.T) {
+	t.Run("recovers from panics with a 500 page and logs the stack trace", func(t *testing.T) {
+		is := is.New(t)
+
+		var buf bytes.Buffer
+		mux := chi.NewMux()
+		mux.Use(handlers.AddRequestID(slog.New(slog.NewJSONHandler(&buf, nil))))
+		mux.Use(handlers.Recoverer())
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			panic("oh no")
+		})
+
+		code, header, body := makeGetRequest(mux, "/")
+		is.Equal(http.StatusInternalServerError, code)
+		is.True(strings.Contains(body, "<h1>Something went wrong</h1>"))
+		is.True(strings.Contains(body, header.Get("X-Request-ID")))
+
+		entry := decodeLogEntry(is, buf.String())
+		is.Equal("Recovered from panic", entry["msg"])
+		is.Equal("oh no", entry["panic"])
+		is.True(strings.Contains(entry["stack"].(string), "errors_test.go"))
+	})
+}
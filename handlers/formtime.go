@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormTimer signs the time a form is rendered, so the time it took to submit the form can be trusted.
+// Without the signature, a bot could send any old time and never be too fast.
+type FormTimer struct {
+	key []byte
+}
+
+// NewFormTimer with the key for signing, which must be the same on all instances of the app.
+func NewFormTimer(key string) *FormTimer {
+	return &FormTimer{key: []byte(key)}
+}
+
+// Sign the time as its Unix time in milliseconds and an HMAC of it, like "1700000000000.3f2a…".
+func (f *FormTimer) Sign(t time.Time) string {
+	millis := strconv.FormatInt(t.UnixMilli(), 10)
+	return millis + "." + f.mac(millis)
+}
+
+// Verify a time from Sign, returning false if it's missing, malformed, or has been tampered with.
+func (f *FormTimer) Verify(signed string) (time.Time, bool) {
+	millis, mac, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(f.mac(millis))) {
+		return time.Time{}, false
+	}
+	v, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(v), true
+}
+
+func (f *FormTimer) mac(millis string) string {
+	h := hmac.New(sha256.New, f.key)
+	h.Write([]byte(millis))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package handlers_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+)
+
+func TestFormTimer(t *testing.T) {
+	t.Run("verifies signed times", func(t *testing.T) {
+		is := is.New(t)
+
+		f := handlers.NewFormTimer("secret")
+		now := time.UnixMilli(1700000000000)
+
+		v, ok := f.Verify(f.Sign(now))
+		is.True(ok)
+		is.True(v.Equal(now))
+	})
+
+	t.Run("rejects missing, unsigned, tampered, and foreign times", func(t *testing.T) {
+		is := is.New(t)
+
+		f := handlers.NewFormTimer("secret")
+		signed := f.Sign(time.UnixMilli(1700000000000))
+		_, mac, _ := strings.Cut(signed, ".")
+
+		for _, v := range []string{
+			"",
+			"0",
+			"1700000000000",
+			"0." + mac,
+			signed + "0",
+			handlers.NewFormTimer("other").Sign(time.UnixMilli(1700000000000)),
+		} {
+			_, ok := f.Verify(v)
+			is.True(!ok) // verified a bad value
+		}
+	})
+}
@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"canvas/views"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func Home(mux chi.Router) {
+// Home page with the signup form, with the time it's rendered signed by the form timer.
+func Home(mux chi.Router, ft *FormTimer) {
 	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		_ = views.FrontPage().Render(w)
+		props := views.SignupFormProps{CSRFToken: CSRFToken(r), FormTime: ft.Sign(time.Now())}
+		render(w, r, http.StatusOK, views.FrontPage(props))
 	})
 }
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/a-h/templ"
+)
+
+// isHTMX is true for requests from htmx that want a fragment of a page.
+// Boosted requests want the whole page, so they don't count.
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true"
+}
+
+// renderPageOrFragment renders the fragment for htmx requests, and the full page otherwise, with the status code.
+func renderPageOrFragment(w http.ResponseWriter, r *http.Request, status int, page, fragment templ.Component) {
+	w.Header().Add("Vary", "HX-Request")
+	if isHTMX(r) {
+		render(w, r, status, fragment)
+		return
+	}
+	render(w, r, status, page)
+}
+
+// redirectOrRender redirects to url, so that refreshing the resulting page doesn't post the form again.
+// htmx requests get the fragment instead, to swap in place of the form.
+func redirectOrRender(w http.ResponseWriter, r *http.Request, url string, fragment templ.Component) {
+	w.Header().Add("Vary", "HX-Request")
+	if isHTMX(r) {
+		render(w, r, http.StatusOK, fragment)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPContextKey struct{}
+
+// ClientIP constructs middleware that finds the client IP of the request, for rate limiting and logging.
+// If the request comes from one of the trusted proxies, the X-Forwarded-For header is walked from the right,
+// and the first address that isn't a trusted proxy is the client IP.
+// Otherwise, the header is ignored, because anyone can set it.
+func ClientIP(trustedProxies []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedIP(r, trustedProxies)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip)))
+		})
+	}
+}
+
+// forwardedIP from the X-Forwarded-For header, if the remote address and the forwarding addresses are trusted.
+func forwardedIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	ip := remoteIP(r)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !isTrusted(addr, trustedProxies) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.Unmap().String()
+		if !isTrusted(addr, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP of the request, as found by ClientIP, or from the remote address.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// remoteIP of the request, without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,55 @@
+package handlers_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Run("uses X-Forwarded-For only from trusted proxies", func(t *testing.T) {
+		is := is.New(t)
+
+		tests := []struct {
+			name       string
+			remoteAddr string
+			forwarded  string
+			expected   string
+		}{
+			{"no proxy", "203.0.113.1:1234", "", "203.0.113.1"},
+			{"untrusted proxy", "203.0.113.1:1234", "198.51.100.1", "203.0.113.1"},
+			{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+			{"spoofed header through trusted proxies", "10.0.0.1:1234", "1.2.3.4, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+			{"only trusted proxies", "10.0.0.1:1234", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+			{"invalid header", "10.0.0.1:1234", "nope", "10.0.0.1"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				mux := chi.NewMux()
+				mux.Use(handlers.ClientIP([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}))
+				mux.Use(handlers.AddRequestID(slog.New(slog.NewJSONHandler(&buf, nil))))
+				mux.Use(handlers.AccessLog())
+				mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = test.remoteAddr
+				if test.forwarded != "" {
+					req.Header.Set("X-Forwarded-For", test.forwarded)
+				}
+				mux.ServeHTTP(httptest.NewRecorder(), req)
+
+				is.Equal(test.expected, decodeLogEntry(is, buf.String())["client_ip"])
+			})
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"canvas/i18n"
+)
+
+const localeCookieName = "locale"
+
+// LocalizeOptions for Localize.
+type LocalizeOptions struct {
+	// Secure sets the Secure attribute on the locale cookie, so it's only sent over HTTPS.
+	Secure bool
+}
+
+// Localize constructs middleware that negotiates the locale for the request, and puts it in the request context
+// for i18n.FromContext. In order of precedence, the locale comes from a prefix in the URL path such as /da/,
+// the locale cookie, the Accept-Language header, and finally i18n.Default.
+// A locale prefix is removed from the path before routing, and remembered in the cookie for the following requests,
+// so links between pages don't need the prefix.
+func Localize(opts LocalizeOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale, path, ok := cutLocalePrefix(r.URL.Path)
+			if ok {
+				http.SetCookie(w, &http.Cookie{
+					Name:     localeCookieName,
+					Value:    string(locale),
+					Path:     "/",
+					MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+					Secure:   opts.Secure,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+
+				r = r.Clone(r.Context())
+				r.URL.Path = path
+				r.URL.RawPath = ""
+			} else {
+				locale = negotiateLocale(r)
+			}
+
+			w.Header().Set("Content-Language", string(locale))
+			w.Header().Add("Vary", "Accept-Language")
+			w.Header().Add("Vary", "Cookie")
+
+			r = r.WithContext(i18n.ContextWithLocale(r.Context(), locale))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// cutLocalePrefix from the path if it starts with a supported locale, like "/da/newsletter/thanks" or "/da".
+// Returns the locale and the rest of the path.
+func cutLocalePrefix(path string) (i18n.Locale, string, bool) {
+	prefix, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	locale, ok := i18n.Parse(prefix)
+	if !ok || prefix != string(locale) {
+		return "", path, false
+	}
+	return locale, "/" + rest, true
+}
+
+// negotiateLocale from the locale cookie or the Accept-Language header.
+func negotiateLocale(r *http.Request) i18n.Locale {
+	if cookie, err := r.Cookie(localeCookieName); err == nil {
+		if locale, ok := i18n.Parse(cookie.Value); ok {
+			return locale
+		}
+	}
+	if locale, ok := i18n.Match(r.Header.Get("Accept-Language")); ok {
+		return locale
+	}
+	return i18n.Default
+}
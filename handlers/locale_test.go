@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+	"canvas/i18n"
+)
+
+func TestLocalize(t *testing.T) {
+	// newLocaleMux responds with the path and the locale from the request context.
+	newLocaleMux := func() *chi.Mux {
+		mux := chi.NewMux()
+		mux.Use(handlers.Localize(handlers.LocalizeOptions{}))
+		handlers.Errors(mux)
+		mux.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.URL.Path + " " + string(i18n.FromContext(r.Context()))))
+		})
+		return mux
+	}
+
+	tests := []struct {
+		name           string
+		target         string
+		cookie         string
+		acceptLanguage string
+		expectedPath   string
+		expectedLocale string
+	}{
+		{"uses the default locale", "/newsletter/thanks", "", "", "/newsletter/thanks", "en"},
+		{"uses the Accept-Language header", "/", "", "fr,da-DK;q=0.8", "/", "da"},
+		{"prefers the cookie over the header", "/", "de", "da", "/", "de"},
+		{"ignores unsupported cookies", "/", "fr", "da", "/", "da"},
+		{"prefers the URL prefix over the cookie, and removes it", "/da/newsletter/thanks", "de", "", "/newsletter/thanks", "da"},
+		{"handles a URL prefix without a trailing slash", "/de", "", "", "/", "de"},
+		{"only removes whole path segments", "/dark", "", "", "/dark", "en"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, test.target, nil)
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "locale", Value: test.cookie})
+			}
+			if test.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", test.acceptLanguage)
+			}
+			res := httptest.NewRecorder()
+			newLocaleMux().ServeHTTP(res, req)
+
+			is.Equal(test.expectedPath+" "+test.expectedLocale, res.Body.String())
+			is.Equal(test.expectedLocale, res.Header().Get("Content-Language"))
+		})
+	}
+
+	t.Run("remembers the locale from the URL prefix in a cookie", func(t *testing.T) {
+		is := is.New(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/da/", nil)
+		res := httptest.NewRecorder()
+		newLocaleMux().ServeHTTP(res, req)
+
+		cookies := res.Result().Cookies()
+		is.Equal(1, len(cookies))
+		is.Equal("locale", cookies[0].Name)
+		is.Equal("da", cookies[0].Value)
+	})
+
+	t.Run("translates error pages", func(t *testing.T) {
+		is := is.New(t)
+
+		mux := chi.NewMux()
+		mux.Use(handlers.Localize(handlers.LocalizeOptions{}))
+		handlers.Errors(mux)
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+		code, _, body := makeGetRequest(mux, "/da/nope")
+		is.Equal(http.StatusNotFound, code)
+		is.True(strings.Contains(body, "<h1>Siden blev ikke fundet</h1>"))
+	})
+}
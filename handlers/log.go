@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"canvas/util"
+)
+
+const requestIDHeaderName = "X-Request-ID"
+
+// requestIDMatcher for request IDs accepted from clients and proxies.
+var requestIDMatcher = regexp.MustCompile(`^[\w.:-]{1,128}$`)
+
+type requestIDContextKey struct{}
+
+// AddRequestID constructs middleware that gives each request an ID, from the X-Request-ID header if it's set
+// and looks sane, or a new random one. The ID is sent back in the X-Request-ID response header.
+// A logger with the request ID is stored in the request context, for util.Logger to fetch.
+// If log is nil, the default logger is used.
+func AddRequestID(log *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := log
+			if l == nil {
+				l = slog.Default()
+			}
+
+			id := r.Header.Get(requestIDHeaderName)
+			if !requestIDMatcher.MatchString(id) {
+				var err error
+				id, err = createRequestID()
+				if err != nil {
+					renderError(w, r, http.StatusInternalServerError, "")
+					return
+				}
+			}
+			w.Header().Set(requestIDHeaderName, id)
+
+			ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+			ctx = util.ContextWithLogger(ctx, l.With(slog.String("request_id", id)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestID of the request, as set by AddRequestID.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey{}).(string)
+	return id
+}
+
+func createRequestID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// AccessLog constructs middleware that logs one line per request to the logger from util.Logger,
+// with the method, route, path, status, duration, response size, and client IP.
+// Email addresses and tokens in the query string are redacted.
+func AccessLog() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			before := time.Now()
+			next.ServeHTTP(ww, r)
+			duration := time.Since(before)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			var route string
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+
+			util.Logger(r.Context()).Info("HTTP request",
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.String("path", redactURL(r.URL)),
+				slog.Int("status", status),
+				slog.Duration("duration", duration),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.String("client_ip", clientIP(r)))
+		})
+	}
+}
+
+const redacted = "REDACTED"
+
+// redactURL returns the path and query of u, with values of email and token parameters redacted,
+// as well as anything that looks like an email address.
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return u.Path + "?" + redacted
+	}
+	for key, values := range query {
+		lowerKey := strings.ToLower(key)
+		sensitive := strings.Contains(lowerKey, "email") || strings.Contains(lowerKey, "token")
+		for i, v := range values {
+			if sensitive || strings.Contains(v, "@") {
+				values[i] = redacted
+			}
+		}
+	}
+	return u.Path + "?" + query.Encode()
+}
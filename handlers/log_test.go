@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+	"canvas/util"
+)
+
+func TestAddRequestID(t *testing.T) {
+	t.Run("creates a request ID and logs it with the request-scoped logger", func(t *testing.T) {
+		is := is.New(t)
+
+		var buf bytes.Buffer
+		mux := chi.NewMux()
+		mux.Use(handlers.AddRequestID(slog.New(slog.NewJSONHandler(&buf, nil))))
+		var id string
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			id = handlers.RequestID(r)
+			util.Logger(r.Context()).Info("Hi")
+		})
+
+		_, header, _ := makeGetRequest(mux, "/")
+		is.Equal(32, len(id))
+		is.Equal(id, header.Get("X-Request-ID"))
+
+		entry := decodeLogEntry(is, buf.String())
+		is.Equal(id, entry["request_id"])
+	})
+
+	t.Run("propagates a request ID from the header", func(t *testing.T) {
+		is := is.New(t)
+
+		mux := chi.NewMux()
+		mux.Use(handlers.AddRequestID(nil))
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		is.Equal("abc-123", res.Header().Get("X-Request-ID"))
+
+		req.Header.Set("X-Request-ID", "<script>")
+		res = httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		is.Equal(32, len(res.Header().Get("X-Request-ID")))
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Run("logs the request with a redacted query string", func(t *testing.T) {
+		is := is.New(t)
+
+		var buf bytes.Buffer
+		mux := chi.NewMux()
+		mux.Use(handlers.AddRequestID(slog.New(slog.NewJSONHandler(&buf, nil))))
+		mux.Use(handlers.AccessLog())
+		mux.Get("/newsletter/{page}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = w.Write([]byte("hi"))
+		})
+
+		makeGetRequest(mux, "/newsletter/confirm?token=secret&email=me@example.com&ref=me@example.com&page=2")
+
+		entry := decodeLogEntry(is, buf.String())
+		is.Equal("HTTP request", entry["msg"])
+		is.Equal("GET", entry["method"])
+		is.Equal("/newsletter/{page}", entry["route"])
+		is.Equal("/newsletter/confirm?email=REDACTED&page=2&ref=REDACTED&token=REDACTED", entry["path"])
+		is.Equal(float64(http.StatusTeapot), entry["status"])
+		is.Equal(float64(2), entry["bytes"])
+		is.Equal("192.0.2.1", entry["client_ip"])
+		is.True(entry["request_id"] != "")
+		is.True(!strings.Contains(buf.String(), "secret"))
+	})
+}
+
+func decodeLogEntry(is *is.I, line string) map[string]any {
+	var entry map[string]any
+	is.NoErr(json.Unmarshal([]byte(line), &entry))
+	return entry
+}
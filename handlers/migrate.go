@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+
+	"canvas/storage"
 )
 
 type migrator interface {
@@ -34,3 +37,21 @@ func MigrateUp(mux chi.Router, m migrator) {
 		}
 	})
 }
+
+type migrationStatuser interface {
+	MigrationStatus(ctx context.Context) (storage.MigrationStatus, error)
+}
+
+// MigrateStatus shows the current and latest migration versions, pending migrations,
+// and applied migrations that have been modified since, as JSON.
+func MigrateStatus(mux chi.Router, m migrationStatuser) {
+	mux.Get("/migrate/status", func(w http.ResponseWriter, r *http.Request) {
+		status, err := m.MigrationStatus(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
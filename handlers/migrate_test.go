@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+	"canvas/storage"
+)
+
+type migrationStatuserMock struct{}
+
+func (m *migrationStatuserMock) MigrationStatus(ctx context.Context) (storage.MigrationStatus, error) {
+	return storage.MigrationStatus{
+		Current:  "1",
+		Latest:   "2",
+		Pending:  []string{"2"},
+		Modified: []string{},
+	}, nil
+}
+
+func TestMigrateStatus(t *testing.T) {
+	t.Run("returns the migration status as JSON", func(t *testing.T) {
+		is := is.New(t)
+
+		mux := chi.NewMux()
+		handlers.MigrateStatus(mux, &migrationStatuserMock{})
+
+		req := httptest.NewRequest(http.MethodGet, "/migrate/status", nil)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		is.Equal(http.StatusOK, res.Code)
+		is.Equal("application/json", res.Header().Get("Content-Type"))
+		body, err := io.ReadAll(res.Body)
+		is.NoErr(err)
+		is.Equal(`{"current":"1","latest":"2","pending":["2"],"modified":[]}`+"\n", string(body))
+	})
+}
@@ -2,17 +2,30 @@ package handlers
 
 import (
 	"context"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 
+	"canvas/i18n"
 	"canvas/model"
+	"canvas/util"
 	"canvas/views"
 )
 
+const (
+	// minSignupFormTime is the shortest time it takes a person to fill out and submit the signup form.
+	minSignupFormTime = 2 * time.Second
+)
+
 // signupper interface
 type signupper interface {
-	SignupForNewsletter(ctx context.Context, email model.Email) (string, error)
+	SignupForNewsletter(ctx context.Context, email model.Email, locale i18n.Locale, consent model.Consent) (string, error)
 }
 
 // sender interface
@@ -20,90 +33,213 @@ type sender interface {
 	Send(ctx context.Context, m model.Message) error
 }
 
-func NewsletterSignup(mux chi.Router, s signupper, q sender) {
+// limiter interface
+type limiter interface {
+	Allow(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+// NewsletterSignup with bot protection: signups are rate limited per client IP and per email address,
+// and the form has a honeypot field and a check for being submitted too fast, with the time the form was
+// rendered signed by the form timer. Missing and tampered form times are rejected.
+// Addresses are normalized, disposable ones are rejected, and typos in common domains get a suggested fix.
+// Blocked signups are counted in the given metrics registry.
+func NewsletterSignup(
+	mux chi.Router,
+	s signupper,
+	q sender,
+	ft *FormTimer,
+	ipLimiter, emailLimiter limiter,
+	registry *prometheus.Registry,
+) {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+	blocked := promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_newsletter_signups_blocked_total",
+		Help: "The total number of blocked newsletter signups.",
+	}, []string{"reason"})
+
 	mux.Post("/newsletter/signup", func(w http.ResponseWriter, r *http.Request) {
-		email := model.Email(r.FormValue("email"))
+		// Only bots fill out the honeypot field. Pretend the signup worked, so they don't adapt.
+		if r.FormValue(views.HoneypotFieldName) != "" {
+			blocked.WithLabelValues("honeypot").Inc()
+			redirectOrRender(w, r, "/newsletter/thanks", views.NewsletterThanks())
+			return
+		}
+
+		signedFormTime := r.FormValue(views.FormTimeFieldName)
+		formTime, ok := ft.Verify(signedFormTime)
+		if !ok {
+			blocked.WithLabelValues("invalid_form_time").Inc()
+			renderSignupFormError(w, r, ft, r.FormValue("email"), "signup.error.too_fast")
+			return
+		}
+		if time.Since(formTime) < minSignupFormTime {
+			blocked.WithLabelValues("too_fast").Inc()
+			renderSignupFormError(w, r, ft, r.FormValue("email"), "signup.error.too_fast")
+			return
+		}
+
+		if !allow(w, r, ipLimiter, clientIP(r), blocked.WithLabelValues("ip_rate_limit")) {
+			return
+		}
+
+		email := model.Email(r.FormValue("email")).Normalize()
+		if suggestion := r.FormValue(views.SuggestionFieldName); suggestion != "" {
+			email = model.Email(suggestion).Normalize()
+		}
 
 		if !email.IsValid() {
-			http.Error(w, "email is invalid", http.StatusBadRequest)
+			renderSignupFormError(w, r, ft, email.String(), "signup.error.invalid_email")
+			return
+		}
+
+		if email.IsDisposable() {
+			blocked.WithLabelValues("disposable").Inc()
+			renderSignupFormError(w, r, ft, email.String(), "signup.error.disposable_email")
 			return
 		}
 
-		token, err := s.SignupForNewsletter(r.Context(), email)
+		// Suggest a fix for a typo in the domain once. Submitting the same address again signs it up as typed.
+		if !prefersJSON(r) && r.FormValue(views.CheckedEmailFieldName) != email.String() {
+			if suggestion, ok := email.Suggest(); ok {
+				props := views.SignupFormProps{
+					CSRFToken:  CSRFToken(r),
+					Email:      email.String(),
+					FormTime:   signedFormTime,
+					Suggestion: suggestion.String(),
+				}
+				renderPageOrFragment(w, r, http.StatusOK, views.FrontPage(props), views.SignupForm(props))
+				return
+			}
+		}
+
+		emailKey := strings.ToLower(email.String())
+		if !allow(w, r, emailLimiter, emailKey, blocked.WithLabelValues("email_rate_limit")) {
+			return
+		}
+
+		locale := i18n.FromContext(r.Context())
+		source := model.ConsentSourceSignupForm
+		if prefersJSON(r) {
+			source = model.ConsentSourceAPI
+		}
+		consent := consentFromRequest(r, source)
+		consent.WordingVersion = r.FormValue(views.WordingVersionFieldName)
+		token, err := s.SignupForNewsletter(r.Context(), email, locale, consent)
 		if err != nil {
-			http.Error(w, "error signing up, refresh to try again", http.StatusBadGateway)
+			util.Logger(r.Context()).Error("Error signing up for newsletter", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
 			return
 		}
 
 		// send the message to the job queue.
 		err = q.Send(r.Context(), model.Message{
-			"job":   "confirmation_email",
-			"email": email.String(),
-			"token": token,
+			"job":    model.JobConfirmationEmail,
+			"email":  email.String(),
+			"locale": string(locale),
+			"token":  token,
 		})
 
 		if err != nil {
-			http.Error(w, "error signing up, refresh to try again", http.StatusBadGateway)
+			util.Logger(r.Context()).Error("Error sending confirmation email message", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
 			return
 		}
 
-		http.Redirect(w, r, "/newsletter/thanks", http.StatusFound)
+		redirectOrRender(w, r, "/newsletter/thanks", views.NewsletterThanks())
 	})
 }
 
+// allow the request if the limiter allows the key.
+// Otherwise, responds with 429 Too Many Requests and a Retry-After header, and counts it as blocked.
+func allow(w http.ResponseWriter, r *http.Request, l limiter, key string, blocked prometheus.Counter) bool {
+	allowed, retryAfter, err := l.Allow(r.Context(), key)
+	if err != nil {
+		util.Logger(r.Context()).Error("Error checking rate limit", util.ErrAttr(err))
+		renderError(w, r, http.StatusBadGateway, "")
+		return false
+	}
+	if !allowed {
+		blocked.Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		renderError(w, r, http.StatusTooManyRequests, "error.message.too_many_signups")
+		return false
+	}
+	return true
+}
+
+// renderSignupFormError by rendering the front page again with the submitted email and the translated error,
+// just the form for htmx requests, or a JSON error if the client prefers it.
+// The form time starts over, signed by the form timer.
+func renderSignupFormError(w http.ResponseWriter, r *http.Request, ft *FormTimer, email, messageKey string) {
+	if prefersJSON(r) {
+		renderError(w, r, http.StatusBadRequest, messageKey)
+		return
+	}
+
+	props := views.SignupFormProps{
+		CSRFToken: CSRFToken(r),
+		Email:     email,
+		Error:     i18n.T(r.Context(), messageKey),
+		FormTime:  ft.Sign(time.Now()),
+	}
+	renderPageOrFragment(w, r, http.StatusBadRequest, views.FrontPage(props), views.SignupForm(props))
+}
+
 func NewsletterThanks(mux chi.Router) {
 	mux.Get("/newsletter/thanks", func(w http.ResponseWriter, r *http.Request) {
-		_ = views.NewsletterThanksPage("/newsletter/thanks").Render(w)
+		render(w, r, http.StatusOK, views.NewsletterThanksPage("/newsletter/thanks"))
 	})
 }
 
 type confirmer interface {
-	ConfirmNewsletterSignup(ctx context.Context, token string) (*model.Email, error)
+	ConfirmNewsletterSignup(ctx context.Context, token string, consent model.Consent) (*model.Subscriber, bool, error)
 }
 
-func NewsletterConfirm(mux chi.Router, s confirmer, q sender) {
+// NewsletterConfirm signups with the token from the confirmation email.
+// The store schedules the welcome email when it confirms the subscriber, so repeat clicks don't send it again.
+// New confirmations are counted in the given metrics registry, labelled with whether the subscriber
+// got a confirmation reminder before confirming.
+func NewsletterConfirm(mux chi.Router, s confirmer, registry *prometheus.Registry) {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+	confirmations := promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_newsletter_confirmations_total",
+		Help: "The total number of confirmed newsletter signups.",
+	}, []string{"reminded"})
+
 	mux.Get("/newsletter/confirm", func(w http.ResponseWriter, r *http.Request) {
 		token := r.FormValue("token")
 
-		_ = views.NewsletterConfirmPage("/newsletter/confirm", token).Render(w)
+		render(w, r, http.StatusOK, views.NewsletterConfirmPage("/newsletter/confirm", token, CSRFToken(r)))
 	})
 
 	mux.Post("/newsletter/confirm", func(w http.ResponseWriter, r *http.Request) {
 		token := r.FormValue("token")
 
-		email, err := s.ConfirmNewsletterSignup(r.Context(), token)
+		subscriber, confirmed, err := s.ConfirmNewsletterSignup(r.Context(), token,
+			consentFromRequest(r, model.ConsentSourceConfirmLink))
 		if err != nil {
-			http.Error(
-				w,
-				"error saving email address confirmation, refresh to try again",
-				http.StatusBadGateway,
-			)
+			util.Logger(r.Context()).Error("Error confirming newsletter signup", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
 			return
 		}
-		if email == nil {
-			http.Error(w, "bad token", http.StatusBadRequest)
+		if subscriber == nil {
+			renderError(w, r, http.StatusBadRequest, "error.message.invalid_token")
 			return
 		}
-
-		err = q.Send(r.Context(), model.Message{
-			"job":   "welcome_email",
-			"email": email.String(),
-		})
-		if err != nil {
-			http.Error(
-				w,
-				"error saving email address confirmation, refresh to try again",
-				http.StatusBadGateway,
-			)
-			return
+		if confirmed {
+			confirmations.WithLabelValues(strconv.FormatBool(subscriber.Reminded != nil)).Inc()
 		}
 
-		http.Redirect(w, r, "/newsletter/confirmed", http.StatusFound)
+		redirectOrRender(w, r, "/newsletter/confirmed", views.NewsletterConfirmed())
 	})
 }
 
 func NewsletterConfirmed(mux chi.Router) {
 	mux.Get("/newsletter/confirmed", func(w http.ResponseWriter, r *http.Request) {
-		_ = views.NewsletterConfirmedPage("/newsletter/confirmed").Render(w)
+		render(w, r, http.StatusOK, views.NewsletterConfirmedPage("/newsletter/confirmed"))
 	})
 }
@@ -5,95 +5,383 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"canvas/handlers"
+	"canvas/i18n"
+	"canvas/messaging"
 	"canvas/model"
+	"canvas/ratelimit"
 )
 
 type signupperMock struct {
-	email model.Email
+	consent model.Consent
+	email   model.Email
+	locale  i18n.Locale
 }
 
 func (s *signupperMock) SignupForNewsletter(
 	ctx context.Context,
 	email model.Email,
+	locale i18n.Locale,
+	consent model.Consent,
 ) (string, error) {
+	s.consent = consent
 	s.email = email
+	s.locale = locale
 	return "123", nil
 }
 
-type senderMock struct {
-	m model.Message
-}
-
-func (s *senderMock) Send(ctx context.Context, m model.Message) error {
-	s.m = m
-	return nil
-}
-
 func TestNewsletterSignup(t *testing.T) {
-	mux := chi.NewMux()
+	// newSignupMux with generous rate limits, and a metrics registry.
+	newSignupMux := func(s *signupperMock, q *messaging.MemoryQueue) (*chi.Mux, *prometheus.Registry) {
+		mux := chi.NewMux()
+		registry := prometheus.NewRegistry()
+		handlers.NewsletterSignup(mux, s, q, formTimer,
+			ratelimit.NewLimiter(ratelimit.NewLimiterOptions{Limit: 3, Window: time.Hour}),
+			ratelimit.NewLimiter(ratelimit.NewLimiterOptions{Limit: 2, Window: time.Hour}),
+			registry)
+		return mux, registry
+	}
+
 	s := &signupperMock{}
-	q := &senderMock{}
-	handlers.NewsletterSignup(mux, s, q)
+	q := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{})
+	mux, _ := newSignupMux(s, q)
 
 	t.Run("signs up a valid email address and send message", func(t *testing.T) {
 		is := is.New(t)
-		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
-			strings.NewReader("email=me%40example.com"))
+		header := createFormHeader()
+		header.Set("User-Agent", "Firefox")
+		code, _, _ := makePostRequest(mux, "/newsletter/signup", header, createSignupForm("me@example.com", ""))
 		is.Equal(http.StatusFound, code)
 		is.Equal(model.Email("me@example.com"), s.email)
+		is.Equal(model.Consent{
+			Source:         "signup_form",
+			IP:             "192.0.2.1",
+			UserAgent:      "Firefox",
+			WordingVersion: "2026-10-19/en",
+		}, s.consent)
 
-		is.Equal(q.m, model.Message{
-			"job":   "confirmation_email",
-			"email": "me@example.com",
-			"token": "123",
+		m, _, err := q.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(*m, model.Message{
+			"job":    "confirmation_email",
+			"email":  "me@example.com",
+			"locale": "en",
+			"token":  "123",
 		})
 	})
 
-	t.Run("rejects an invalid email address", func(t *testing.T) {
+	t.Run("rejects an invalid email address and shows the form again with an error", func(t *testing.T) {
 		is := is.New(t)
+		code, _, body := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			createSignupForm("notanemail", ""))
+		is.Equal(http.StatusBadRequest, code)
+		is.True(strings.Contains(body, `value="notanemail"`))
+		is.True(strings.Contains(body, `id="email-error"`))
+	})
+
+	t.Run("returns fragments to swap in place of the form for htmx requests", func(t *testing.T) {
+		is := is.New(t)
+
+		mux, _ := newSignupMux(&signupperMock{}, q)
+
+		header := createFormHeader()
+		header.Set("HX-Request", "true")
+		code, _, body := makePostRequest(mux, "/newsletter/signup", header, createSignupForm("notanemail", ""))
+		is.Equal(http.StatusBadRequest, code)
+		is.True(strings.HasPrefix(body, `<div id="signup">`))
+		is.True(strings.Contains(body, `value="notanemail"`))
+		is.True(!strings.Contains(body, "<html"))
+
+		code, _, body = makePostRequest(mux, "/newsletter/signup", header, createSignupForm("you@example.com", ""))
+		is.Equal(http.StatusOK, code)
+		is.True(strings.HasPrefix(body, `<div id="signup">`))
+		is.True(strings.Contains(body, "Thanks for signing up!"))
+	})
+
+	t.Run("signs up in the request locale, and shows errors in it", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &signupperMock{}
+		q := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{})
+		mux := chi.NewMux()
+		mux.Use(handlers.Localize(handlers.LocalizeOptions{}))
+		handlers.NewsletterSignup(mux, s, q, formTimer,
+			ratelimit.NewLimiter(ratelimit.NewLimiterOptions{Limit: 3, Window: time.Hour}),
+			ratelimit.NewLimiter(ratelimit.NewLimiterOptions{Limit: 2, Window: time.Hour}),
+			nil)
+
+		code, _, body := makePostRequest(mux, "/da/newsletter/signup", createFormHeader(),
+			createSignupForm("notanemail", ""))
+		is.Equal(http.StatusBadRequest, code)
+		is.True(strings.Contains(body, "Det ligner ikke en e-mailadresse."))
+
+		code, _, _ = makePostRequest(mux, "/da/newsletter/signup", createFormHeader(),
+			createSignupForm("me@example.com", ""))
+		is.Equal(http.StatusFound, code)
+		is.Equal(i18n.Locale("da"), s.locale)
+
+		m, _, err := q.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal("da", (*m)["locale"])
+	})
+
+	t.Run("rejects an invalid email address with a JSON error if the client prefers it", func(t *testing.T) {
+		is := is.New(t)
+		header := createFormHeader()
+		header.Set("Accept", "application/json")
+		code, header, body := makePostRequest(mux, "/newsletter/signup", header,
+			createSignupForm("notanemail", ""))
+		is.Equal(http.StatusBadRequest, code)
+		is.Equal("application/json", header.Get("Content-Type"))
+		is.True(strings.Contains(body, `"status":400`))
+	})
+
+	t.Run("pretends to sign up if the honeypot field is filled out", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &signupperMock{}
+		mux, registry := newSignupMux(s, q)
+
+		code, header, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			createSignupForm("me@example.com", "https://spam.example.com"))
+		is.Equal(http.StatusFound, code)
+		is.Equal("/newsletter/thanks", header.Get("Location"))
+		is.Equal(model.Email(""), s.email)
+		is.Equal(float64(1), getBlockedCount(is, registry, "honeypot"))
+	})
+
+	t.Run("rejects a form that was sent too fast", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &signupperMock{}
+		mux, registry := newSignupMux(s, q)
+
+		form := url.Values{
+			"email":     {"me@example.com"},
+			"form_time": {formTimer.Sign(time.Now())},
+		}
 		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
-			strings.NewReader("email=notanemail"))
+			strings.NewReader(form.Encode()))
 		is.Equal(http.StatusBadRequest, code)
+		is.Equal(model.Email(""), s.email)
+		is.Equal(float64(1), getBlockedCount(is, registry, "too_fast"))
+	})
+
+	t.Run("rejects a form with a missing or forged form time", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &signupperMock{}
+		mux, registry := newSignupMux(s, q)
+
+		for _, formTime := range []string{"", "0", handlers.NewFormTimer("forged").Sign(time.Now().Add(-time.Minute))} {
+			form := url.Values{
+				"email":     {"me@example.com"},
+				"form_time": {formTime},
+			}
+			code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+				strings.NewReader(form.Encode()))
+			is.Equal(http.StatusBadRequest, code)
+		}
+		is.Equal(model.Email(""), s.email)
+		is.Equal(float64(3), getBlockedCount(is, registry, "invalid_form_time"))
+	})
+
+	t.Run("normalizes the email address before signing up", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &signupperMock{}
+		mux, _ := newSignupMux(s, messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{}))
+
+		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			createSignupForm(" Me@Bücher.Example ", ""))
+		is.Equal(http.StatusFound, code)
+		is.Equal(model.Email("Me@xn--bcher-kva.example"), s.email)
 	})
+
+	t.Run("rejects a disposable email address", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &signupperMock{}
+		mux, registry := newSignupMux(s, q)
+
+		code, _, body := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			createSignupForm("me@mailinator.com", ""))
+		is.Equal(http.StatusBadRequest, code)
+		is.True(strings.Contains(body, "disposable email services"))
+		is.Equal(model.Email(""), s.email)
+		is.Equal(float64(1), getBlockedCount(is, registry, "disposable"))
+	})
+
+	t.Run("suggests a fix for a typo in the domain, and signs up with it or as typed", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &signupperMock{}
+		mux, _ := newSignupMux(s, messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{}))
+
+		code, _, body := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			createSignupForm("me@gmial.com", ""))
+		is.Equal(http.StatusOK, code)
+		is.True(strings.Contains(body, "Did you mean me@gmail.com?"))
+		is.True(strings.Contains(body, `name="checked_email" value="me@gmial.com"`))
+		is.Equal(model.Email(""), s.email)
+
+		form := url.Values{
+			"email":         {"me@gmial.com"},
+			"checked_email": {"me@gmial.com"},
+			"suggestion":    {"me@gmail.com"},
+			"form_time":     {formTimer.Sign(time.Now().Add(-time.Minute))},
+		}
+		code, _, _ = makePostRequest(mux, "/newsletter/signup", createFormHeader(), strings.NewReader(form.Encode()))
+		is.Equal(http.StatusFound, code)
+		is.Equal(model.Email("me@gmail.com"), s.email)
+
+		form.Del("suggestion")
+		code, _, _ = makePostRequest(mux, "/newsletter/signup", createFormHeader(), strings.NewReader(form.Encode()))
+		is.Equal(http.StatusFound, code)
+		is.Equal(model.Email("me@gmial.com"), s.email)
+	})
+
+	t.Run("rate limits signups per email address and per client IP", func(t *testing.T) {
+		is := is.New(t)
+
+		mux, registry := newSignupMux(&signupperMock{}, q)
+
+		for i := 0; i < 2; i++ {
+			code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+				createSignupForm("Me@example.com", ""))
+			is.Equal(http.StatusFound, code)
+		}
+
+		code, header, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			createSignupForm("me@example.com", ""))
+		is.Equal(http.StatusTooManyRequests, code)
+		is.Equal("3600", header.Get("Retry-After"))
+		is.Equal(float64(1), getBlockedCount(is, registry, "email_rate_limit"))
+
+		code, _, _ = makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			createSignupForm("you@example.com", ""))
+		is.Equal(http.StatusTooManyRequests, code)
+		is.Equal(float64(1), getBlockedCount(is, registry, "ip_rate_limit"))
+	})
+}
+
+// formTimer signs form times in signup forms from createSignupForm.
+var formTimer = handlers.NewFormTimer("abcdefghijklmnopqrstuvwxyzabcdef")
+
+// createSignupForm body with the email and honeypot fields, rendered long enough ago to look human.
+func createSignupForm(email, honeypot string) io.Reader {
+	form := url.Values{
+		"email":           {email},
+		"form_time":       {formTimer.Sign(time.Now().Add(-time.Minute))},
+		"website":         {honeypot},
+		"wording_version": {"2026-10-19/en"},
+	}
+	return strings.NewReader(form.Encode())
+}
+
+// getBlockedCount of signups for the given reason from the metrics registry.
+func getBlockedCount(is *is.I, registry *prometheus.Registry, reason string) float64 {
+	return getCounterValue(is, registry, "app_newsletter_signups_blocked_total", reason)
+}
+
+// getCounterValue of the counter with the given name and single label value from the metrics registry.
+func getCounterValue(is *is.I, registry *prometheus.Registry, name, labelValue string) float64 {
+	metrics, err := registry.Gather()
+	is.NoErr(err)
+	for _, metric := range metrics {
+		if metric.GetName() != name {
+			continue
+		}
+		for _, m := range metric.Metric {
+			if m.Label[0].GetValue() == labelValue {
+				return m.Counter.GetValue()
+			}
+		}
+	}
+	return 0
 }
 
 type confirmerMock struct {
-	token string
+	consent          model.Consent
+	alreadyConfirmed bool
+	reminded         *time.Time
+	token            string
 }
 
 func (c *confirmerMock) ConfirmNewsletterSignup(
 	ctx context.Context,
 	token string,
-) (*model.Email, error) {
+	consent model.Consent,
+) (*model.Subscriber, bool, error) {
+	c.consent = consent
 	c.token = token
-	email := model.Email("me@example.com")
-	return &email, nil
+	return &model.Subscriber{Email: "me@example.com", Locale: "da", Reminded: c.reminded}, !c.alreadyConfirmed, nil
 }
 
 func TestNewsletterConfirm(t *testing.T) {
-	t.Run("confirms the newsletter signup and sends a message", func(t *testing.T) {
+	t.Run("confirms the newsletter signup with the token and consent", func(t *testing.T) {
 		is := is.New(t)
 		mux := chi.NewMux()
 		c := &confirmerMock{}
-		q := &senderMock{}
-		handlers.NewsletterConfirm(mux, c, q)
+		handlers.NewsletterConfirm(mux, c, nil)
 
-		code, _, _ := makePostRequest(mux, "/newsletter/confirm", createFormHeader(),
+		code, header, _ := makePostRequest(mux, "/newsletter/confirm", createFormHeader(),
 			strings.NewReader("token=123"))
 		is.Equal(http.StatusFound, code)
+		is.Equal("/newsletter/confirmed", header.Get("Location"))
 		is.Equal("123", c.token)
+		is.Equal(model.Consent{Source: "confirm_link", IP: "192.0.2.1"}, c.consent)
+	})
 
-		is.Equal(q.m, model.Message{
-			"job":   "welcome_email",
-			"email": "me@example.com",
-		})
+	t.Run("returns a confirmation fragment for htmx requests", func(t *testing.T) {
+		is := is.New(t)
+		mux := chi.NewMux()
+		handlers.NewsletterConfirm(mux, &confirmerMock{}, nil)
+
+		header := createFormHeader()
+		header.Set("HX-Request", "true")
+		code, _, body := makePostRequest(mux, "/newsletter/confirm", header, strings.NewReader("token=123"))
+		is.Equal(http.StatusOK, code)
+		is.True(strings.HasPrefix(body, `<div id="confirm">`))
+	})
+
+	t.Run("counts new confirmations by whether the subscriber was reminded", func(t *testing.T) {
+		is := is.New(t)
+		registry := prometheus.NewRegistry()
+		c := &confirmerMock{}
+		mux := chi.NewMux()
+		handlers.NewsletterConfirm(mux, c, registry)
+
+		code, _, _ := makePostRequest(mux, "/newsletter/confirm", createFormHeader(), strings.NewReader("token=123"))
+		is.Equal(http.StatusFound, code)
+
+		reminded := time.Now()
+		c.reminded = &reminded
+		code, _, _ = makePostRequest(mux, "/newsletter/confirm", createFormHeader(), strings.NewReader("token=123"))
+		is.Equal(http.StatusFound, code)
+
+		is.Equal(float64(1), getCounterValue(is, registry, "app_newsletter_confirmations_total", "false"))
+		is.Equal(float64(1), getCounterValue(is, registry, "app_newsletter_confirmations_total", "true"))
+	})
+
+	t.Run("doesn't count confirmations of subscribers who were confirmed already", func(t *testing.T) {
+		is := is.New(t)
+		registry := prometheus.NewRegistry()
+		mux := chi.NewMux()
+		handlers.NewsletterConfirm(mux, &confirmerMock{alreadyConfirmed: true}, registry)
+
+		code, _, _ := makePostRequest(mux, "/newsletter/confirm", createFormHeader(), strings.NewReader("token=123"))
+		is.Equal(http.StatusFound, code)
+		is.Equal(float64(0), getCounterValue(is, registry, "app_newsletter_confirmations_total", "false"))
 	})
 }
 
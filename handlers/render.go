@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/a-h/templ"
+
+	"canvas/util"
+)
+
+// render the component as HTML with the status code.
+// The response is already under way if rendering fails, so the error is only logged.
+func render(w http.ResponseWriter, r *http.Request, status int, c templ.Component) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := c.Render(r.Context(), w); err != nil {
+		util.Logger(r.Context()).Error("Error rendering component", util.ErrAttr(err))
+	}
+}
@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	t.Run("sets strict security headers by default", func(t *testing.T) {
+		is := is.New(t)
+
+		mux := chi.NewMux()
+		mux.Use(handlers.SecurityHeaders(handlers.SecurityHeadersOptions{}))
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+		_, header, _ := makeGetRequest(mux, "/")
+		is.Equal(handlers.DefaultContentSecurityPolicy, header.Get("Content-Security-Policy"))
+		is.Equal(handlers.DefaultPermissionsPolicy, header.Get("Permissions-Policy"))
+		is.Equal(handlers.DefaultReferrerPolicy, header.Get("Referrer-Policy"))
+		is.Equal("nosniff", header.Get("X-Content-Type-Options"))
+		is.Equal("DENY", header.Get("X-Frame-Options"))
+		is.Equal("", header.Get("Strict-Transport-Security"))
+	})
+
+	t.Run("sets HSTS if enabled", func(t *testing.T) {
+		is := is.New(t)
+
+		mux := chi.NewMux()
+		mux.Use(handlers.SecurityHeaders(handlers.SecurityHeadersOptions{HSTS: true}))
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+		_, header, _ := makeGetRequest(mux, "/")
+		is.Equal("max-age=31536000; includeSubDomains", header.Get("Strict-Transport-Security"))
+	})
+
+	t.Run("can be overridden per route", func(t *testing.T) {
+		is := is.New(t)
+
+		mux := chi.NewMux()
+		mux.Use(handlers.SecurityHeaders(handlers.SecurityHeadersOptions{}))
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+		mux.With(handlers.SecurityHeaders(handlers.SecurityHeadersOptions{
+			ContentSecurityPolicy: "default-src 'none'",
+		})).Get("/strict", func(w http.ResponseWriter, r *http.Request) {})
+
+		_, header, _ := makeGetRequest(mux, "/strict")
+		is.Equal("default-src 'none'", header.Get("Content-Security-Policy"))
+
+		_, header, _ = makeGetRequest(mux, "/")
+		is.Equal(handlers.DefaultContentSecurityPolicy, header.Get("Content-Security-Policy"))
+	})
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"canvas/i18n"
+	"canvas/model"
+	"canvas/util"
+	"canvas/views"
+)
+
+// maxSequenceStepDelayHours is a year, which is longer than any sequence should wait between steps.
+const maxSequenceStepDelayHours = 365 * 24
+
+// transparentGIF of one by one pixel, for tracking opens.
+var transparentGIF, _ = base64.StdEncoding.DecodeString("R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")
+
+type sequenceEditor interface {
+	ListSequences(ctx context.Context) ([]model.SequenceSummary, error)
+	GetSequence(ctx context.Context, id int64) (*model.Sequence, error)
+	CreateSequence(ctx context.Context, s model.Sequence) (*model.Sequence, error)
+	UpdateSequence(ctx context.Context, s model.Sequence) (*model.Sequence, error)
+	DeleteSequence(ctx context.Context, id int64) (bool, error)
+	ListSequenceStepStats(ctx context.Context, sequenceID int64) ([]model.SequenceStepStats, error)
+	AddSequenceStep(ctx context.Context, s model.SequenceStep) (*model.SequenceStep, error)
+	UpdateSequenceStep(ctx context.Context, s model.SequenceStep) (*model.SequenceStep, error)
+	MoveSequenceStep(ctx context.Context, sequenceID, stepID int64, up bool) (bool, error)
+	DeleteSequenceStep(ctx context.Context, sequenceID, stepID int64) (bool, error)
+}
+
+// Sequences page with the sequences and their enrollments, and the form for creating one.
+func Sequences(mux chi.Router, s sequenceEditor) {
+	mux.Get("/admin/sequences", func(w http.ResponseWriter, r *http.Request) {
+		renderSequencesPage(w, r, s, http.StatusOK, "")
+	})
+
+	mux.Post("/admin/sequences", func(w http.ResponseWriter, r *http.Request) {
+		sequence, message := parseSequenceForm(r)
+		if message != "" {
+			renderSequencesPage(w, r, s, http.StatusBadRequest, message)
+			return
+		}
+
+		created, err := s.CreateSequence(r.Context(), sequence)
+		if err != nil {
+			util.Logger(r.Context()).Error("Error creating sequence", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+		if created == nil {
+			renderSequencesPage(w, r, s, http.StatusBadRequest, "There is already a sequence with that name.")
+			return
+		}
+
+		http.Redirect(w, r, sequencePath(created.ID), http.StatusFound)
+	})
+}
+
+// Sequence page with the funnel of its steps and forms for editing it, and the routes for saving and deleting it.
+func Sequence(mux chi.Router, s sequenceEditor) {
+	mux.Get("/admin/sequences/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sequence, ok := getSequenceFromPath(w, r, s)
+		if !ok {
+			return
+		}
+		renderSequencePage(w, r, s, *sequence, http.StatusOK, "")
+	})
+
+	mux.Post("/admin/sequences/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sequence, ok := getSequenceFromPath(w, r, s)
+		if !ok {
+			return
+		}
+
+		changed, message := parseSequenceForm(r)
+		if message != "" {
+			renderSequencePage(w, r, s, *sequence, http.StatusBadRequest, message)
+			return
+		}
+		changed.ID = sequence.ID
+
+		updated, err := s.UpdateSequence(r.Context(), changed)
+		if err != nil {
+			util.Logger(r.Context()).Error("Error updating sequence", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+		if updated == nil {
+			renderSequencePage(w, r, s, *sequence, http.StatusBadRequest, "There is already a sequence with that name.")
+			return
+		}
+
+		http.Redirect(w, r, sequencePath(sequence.ID), http.StatusFound)
+	})
+
+	mux.Post("/admin/sequences/{id}/delete", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := parseIDParam(w, r, "id")
+		if !ok {
+			return
+		}
+
+		if _, err := s.DeleteSequence(r.Context(), id); err != nil {
+			util.Logger(r.Context()).Error("Error deleting sequence", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+
+		http.Redirect(w, r, "/admin/sequences", http.StatusFound)
+	})
+}
+
+// SequenceSteps routes for adding, saving, moving, and deleting the steps of a sequence.
+// Each redirects back to the sequence page.
+func SequenceSteps(mux chi.Router, s sequenceEditor) {
+	mux.Post("/admin/sequences/{id}/steps", func(w http.ResponseWriter, r *http.Request) {
+		sequence, ok := getSequenceFromPath(w, r, s)
+		if !ok {
+			return
+		}
+
+		step, message := parseSequenceStepForm(r)
+		if message != "" {
+			renderSequencePage(w, r, s, *sequence, http.StatusBadRequest, message)
+			return
+		}
+		step.SequenceID = sequence.ID
+
+		if _, err := s.AddSequenceStep(r.Context(), step); err != nil {
+			util.Logger(r.Context()).Error("Error adding sequence step", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+
+		http.Redirect(w, r, sequencePath(sequence.ID), http.StatusFound)
+	})
+
+	mux.Post("/admin/sequences/{id}/steps/{stepID}", func(w http.ResponseWriter, r *http.Request) {
+		sequence, ok := getSequenceFromPath(w, r, s)
+		if !ok {
+			return
+		}
+		stepID, ok := parseIDParam(w, r, "stepID")
+		if !ok {
+			return
+		}
+
+		step, message := parseSequenceStepForm(r)
+		if message != "" {
+			renderSequencePage(w, r, s, *sequence, http.StatusBadRequest, message)
+			return
+		}
+		step.ID = stepID
+		step.SequenceID = sequence.ID
+
+		updated, err := s.UpdateSequenceStep(r.Context(), step)
+		if err != nil {
+			util.Logger(r.Context()).Error("Error updating sequence step", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+		if updated == nil {
+			renderError(w, r, http.StatusNotFound, notFoundMessage)
+			return
+		}
+
+		http.Redirect(w, r, sequencePath(sequence.ID), http.StatusFound)
+	})
+
+	mux.Post("/admin/sequences/{id}/steps/{stepID}/move", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := parseIDParam(w, r, "id")
+		if !ok {
+			return
+		}
+		stepID, ok := parseIDParam(w, r, "stepID")
+		if !ok {
+			return
+		}
+
+		found, err := s.MoveSequenceStep(r.Context(), id, stepID, r.FormValue("direction") == "up")
+		if err != nil {
+			util.Logger(r.Context()).Error("Error moving sequence step", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+		if !found {
+			renderError(w, r, http.StatusNotFound, notFoundMessage)
+			return
+		}
+
+		http.Redirect(w, r, sequencePath(id), http.StatusFound)
+	})
+
+	mux.Post("/admin/sequences/{id}/steps/{stepID}/delete", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := parseIDParam(w, r, "id")
+		if !ok {
+			return
+		}
+		stepID, ok := parseIDParam(w, r, "stepID")
+		if !ok {
+			return
+		}
+
+		if _, err := s.DeleteSequenceStep(r.Context(), id, stepID); err != nil {
+			util.Logger(r.Context()).Error("Error deleting sequence step", util.ErrAttr(err))
+			renderError(w, r, http.StatusBadGateway, "")
+			return
+		}
+
+		http.Redirect(w, r, sequencePath(id), http.StatusFound)
+	})
+}
+
+type sequenceOpenRecorder interface {
+	RecordSequenceOpen(ctx context.Context, token string) (bool, error)
+}
+
+// SequenceOpen records opens of sequence emails, from the tracking image in them.
+// The image is served whether or not the token matches, and isn't cached, so every open reaches the server.
+func SequenceOpen(mux chi.Router, s sequenceOpenRecorder) {
+	mux.Get("/newsletter/open", func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" {
+			if _, err := s.RecordSequenceOpen(r.Context(), token); err != nil {
+				util.Logger(r.Context()).Error("Error recording sequence open", util.ErrAttr(err))
+			}
+		}
+
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(transparentGIF)
+	})
+}
+
+// getSequenceFromPath by the id URL parameter. Responds with an error and returns false if it can't.
+func getSequenceFromPath(w http.ResponseWriter, r *http.Request, s sequenceEditor) (*model.Sequence, bool) {
+	id, ok := parseIDParam(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+
+	sequence, err := s.GetSequence(r.Context(), id)
+	if err != nil {
+		util.Logger(r.Context()).Error("Error getting sequence", util.ErrAttr(err))
+		renderError(w, r, http.StatusBadGateway, "")
+		return nil, false
+	}
+	if sequence == nil {
+		renderError(w, r, http.StatusNotFound, notFoundMessage)
+		return nil, false
+	}
+	return sequence, true
+}
+
+// parseIDParam from the URL. Responds with 404 Not Found and returns false if it isn't an ID.
+func parseIDParam(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id <= 0 {
+		renderError(w, r, http.StatusNotFound, notFoundMessage)
+		return 0, false
+	}
+	return id, true
+}
+
+// parseSequenceForm into a sequence without an ID. Returns a message for the user if the form is invalid.
+func parseSequenceForm(r *http.Request) (model.Sequence, string) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return model.Sequence{}, "Enter a name for the sequence."
+	}
+	locale, ok := i18n.Parse(r.FormValue("locale"))
+	if !ok {
+		return model.Sequence{}, "Choose a language for the sequence."
+	}
+	return model.Sequence{Name: name, Locale: locale, Active: r.FormValue("active") == "true"}, ""
+}
+
+// parseSequenceStepForm into a step without IDs. Returns a message for the user if the form is invalid.
+func parseSequenceStepForm(r *http.Request) (model.SequenceStep, string) {
+	delayHours, err := strconv.Atoi(r.FormValue("delay_hours"))
+	if err != nil || delayHours < 0 || delayHours > maxSequenceStepDelayHours {
+		return model.SequenceStep{}, "Enter the hours after the previous step as a number from 0 to " +
+			strconv.Itoa(maxSequenceStepDelayHours) + "."
+	}
+	condition := model.SequenceStepCondition(r.FormValue("condition"))
+	if !condition.IsValid() {
+		return model.SequenceStep{}, "Choose when to send the step."
+	}
+	subject := strings.TrimSpace(r.FormValue("subject"))
+	body := strings.TrimSpace(strings.ReplaceAll(r.FormValue("body"), "\r\n", "\n"))
+	if subject == "" || body == "" {
+		return model.SequenceStep{}, "Enter both a subject and a body for the step."
+	}
+	return model.SequenceStep{DelayHours: delayHours, Condition: condition, Subject: subject, Body: body}, ""
+}
+
+func renderSequencesPage(w http.ResponseWriter, r *http.Request, s sequenceEditor, status int, message string) {
+	sequences, err := s.ListSequences(r.Context())
+	if err != nil {
+		util.Logger(r.Context()).Error("Error listing sequences", util.ErrAttr(err))
+		renderError(w, r, http.StatusBadGateway, "")
+		return
+	}
+	render(w, r, status, views.SequencesPage(sequences, message))
+}
+
+func renderSequencePage(
+	w http.ResponseWriter,
+	r *http.Request,
+	s sequenceEditor,
+	sequence model.Sequence,
+	status int,
+	message string,
+) {
+	steps, err := s.ListSequenceStepStats(r.Context(), sequence.ID)
+	if err != nil {
+		util.Logger(r.Context()).Error("Error listing sequence steps", util.ErrAttr(err))
+		renderError(w, r, http.StatusBadGateway, "")
+		return
+	}
+	render(w, r, status, views.SequencePage(sequence, steps, message))
+}
+
+func sequencePath(id int64) string {
+	return "/admin/sequences/" + strconv.FormatInt(id, 10)
+}
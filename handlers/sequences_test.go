@@ -0,0 +1,264 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+	"canvas/model"
+)
+
+type sequenceStoreMock struct {
+	sequences []model.Sequence
+	steps     []model.SequenceStep
+	moved     bool
+	up        bool
+	opened    string
+}
+
+func (s *sequenceStoreMock) ListSequences(ctx context.Context) ([]model.SequenceSummary, error) {
+	var summaries []model.SequenceSummary
+	for _, sequence := range s.sequences {
+		summaries = append(summaries, model.SequenceSummary{Sequence: sequence})
+	}
+	return summaries, nil
+}
+
+func (s *sequenceStoreMock) GetSequence(ctx context.Context, id int64) (*model.Sequence, error) {
+	for _, sequence := range s.sequences {
+		if sequence.ID == id {
+			return &sequence, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *sequenceStoreMock) CreateSequence(ctx context.Context, sequence model.Sequence) (*model.Sequence, error) {
+	for _, existing := range s.sequences {
+		if existing.Name == sequence.Name {
+			return nil, nil
+		}
+	}
+	sequence.ID = int64(len(s.sequences) + 1)
+	s.sequences = append(s.sequences, sequence)
+	return &sequence, nil
+}
+
+func (s *sequenceStoreMock) UpdateSequence(ctx context.Context, sequence model.Sequence) (*model.Sequence, error) {
+	for i := range s.sequences {
+		if s.sequences[i].ID == sequence.ID {
+			s.sequences[i] = sequence
+			return &sequence, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *sequenceStoreMock) DeleteSequence(ctx context.Context, id int64) (bool, error) {
+	return true, nil
+}
+
+func (s *sequenceStoreMock) ListSequenceStepStats(ctx context.Context, sequenceID int64) ([]model.SequenceStepStats, error) {
+	var stats []model.SequenceStepStats
+	for _, step := range s.steps {
+		stats = append(stats, model.SequenceStepStats{SequenceStep: step})
+	}
+	return stats, nil
+}
+
+func (s *sequenceStoreMock) AddSequenceStep(ctx context.Context, step model.SequenceStep) (*model.SequenceStep, error) {
+	step.ID = int64(len(s.steps) + 1)
+	s.steps = append(s.steps, step)
+	return &step, nil
+}
+
+func (s *sequenceStoreMock) UpdateSequenceStep(ctx context.Context, step model.SequenceStep) (*model.SequenceStep, error) {
+	for i := range s.steps {
+		if s.steps[i].ID == step.ID {
+			s.steps[i] = step
+			return &step, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *sequenceStoreMock) MoveSequenceStep(ctx context.Context, sequenceID, stepID int64, up bool) (bool, error) {
+	s.moved = true
+	s.up = up
+	return true, nil
+}
+
+func (s *sequenceStoreMock) DeleteSequenceStep(ctx context.Context, sequenceID, stepID int64) (bool, error) {
+	return true, nil
+}
+
+func (s *sequenceStoreMock) RecordSequenceOpen(ctx context.Context, token string) (bool, error) {
+	s.opened = token
+	return true, nil
+}
+
+func newSequencesMux(s *sequenceStoreMock) *chi.Mux {
+	mux := chi.NewMux()
+	handlers.Sequences(mux, s)
+	handlers.Sequence(mux, s)
+	handlers.SequenceSteps(mux, s)
+	return mux
+}
+
+func TestSequences(t *testing.T) {
+	t.Run("lists sequences", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{sequences: []model.Sequence{{ID: 1, Name: "Welcome", Locale: "en"}}}
+		mux := newSequencesMux(s)
+
+		code, _, body := makeGetRequest(mux, "/admin/sequences")
+		is.Equal(http.StatusOK, code)
+		is.True(strings.Contains(body, `<a href="/admin/sequences/1">Welcome</a>`))
+	})
+
+	t.Run("creates an inactive sequence and redirects to it", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{}
+		mux := newSequencesMux(s)
+
+		form := url.Values{"name": {" Welcome "}, "locale": {"da"}}
+		code, header, _ := makePostRequest(mux, "/admin/sequences", createFormHeader(), strings.NewReader(form.Encode()))
+		is.Equal(http.StatusFound, code)
+		is.Equal("/admin/sequences/1", header.Get("Location"))
+		is.Equal([]model.Sequence{{ID: 1, Name: "Welcome", Locale: "da"}}, s.sequences)
+	})
+
+	t.Run("errors on a taken name or an invalid form", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{sequences: []model.Sequence{{ID: 1, Name: "Welcome", Locale: "en"}}}
+		mux := newSequencesMux(s)
+
+		form := url.Values{"name": {"Welcome"}, "locale": {"en"}}
+		code, _, body := makePostRequest(mux, "/admin/sequences", createFormHeader(), strings.NewReader(form.Encode()))
+		is.Equal(http.StatusBadRequest, code)
+		is.True(strings.Contains(body, "There is already a sequence with that name."))
+
+		form = url.Values{"name": {"Other"}, "locale": {"xx"}}
+		code, _, body = makePostRequest(mux, "/admin/sequences", createFormHeader(), strings.NewReader(form.Encode()))
+		is.Equal(http.StatusBadRequest, code)
+		is.True(strings.Contains(body, "Choose a language for the sequence."))
+	})
+}
+
+func TestSequence(t *testing.T) {
+	t.Run("shows the sequence with its steps", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{
+			sequences: []model.Sequence{{ID: 1, Name: "Welcome", Locale: "en"}},
+			steps:     []model.SequenceStep{{ID: 1, SequenceID: 1, Subject: "Hello", Body: "Hi!"}},
+		}
+		mux := newSequencesMux(s)
+
+		code, _, body := makeGetRequest(mux, "/admin/sequences/1")
+		is.Equal(http.StatusOK, code)
+		is.True(strings.Contains(body, "<h1>Welcome</h1>"))
+		is.True(strings.Contains(body, "<td>Hello</td>"))
+	})
+
+	t.Run("responds with not found for unknown sequences", func(t *testing.T) {
+		is := is.New(t)
+		mux := newSequencesMux(&sequenceStoreMock{})
+
+		code, _, _ := makeGetRequest(mux, "/admin/sequences/2")
+		is.Equal(http.StatusNotFound, code)
+
+		code, _, _ = makeGetRequest(mux, "/admin/sequences/notanid")
+		is.Equal(http.StatusNotFound, code)
+	})
+
+	t.Run("saves the sequence and activates it", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{sequences: []model.Sequence{{ID: 1, Name: "Welcome", Locale: "en"}}}
+		mux := newSequencesMux(s)
+
+		form := url.Values{"name": {"Welcome"}, "locale": {"de"}, "active": {"true"}}
+		code, header, _ := makePostRequest(mux, "/admin/sequences/1", createFormHeader(), strings.NewReader(form.Encode()))
+		is.Equal(http.StatusFound, code)
+		is.Equal("/admin/sequences/1", header.Get("Location"))
+		is.Equal(model.Sequence{ID: 1, Name: "Welcome", Locale: "de", Active: true}, s.sequences[0])
+	})
+}
+
+func TestSequenceSteps(t *testing.T) {
+	t.Run("adds and saves steps", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{sequences: []model.Sequence{{ID: 1, Name: "Welcome", Locale: "en"}}}
+		mux := newSequencesMux(s)
+
+		form := url.Values{
+			"delay_hours": {"24"},
+			"condition":   {"always"},
+			"subject":     {"Hello"},
+			"body":        {"Hi!\r\n\r\nWelcome.\r\n"},
+		}
+		code, header, _ := makePostRequest(mux, "/admin/sequences/1/steps", createFormHeader(),
+			strings.NewReader(form.Encode()))
+		is.Equal(http.StatusFound, code)
+		is.Equal("/admin/sequences/1", header.Get("Location"))
+		is.Equal([]model.SequenceStep{{ID: 1, SequenceID: 1, DelayHours: 24, Condition: "always", Subject: "Hello",
+			Body: "Hi!\n\nWelcome."}}, s.steps)
+
+		form.Set("condition", "opened_previous")
+		code, _, _ = makePostRequest(mux, "/admin/sequences/1/steps/1", createFormHeader(),
+			strings.NewReader(form.Encode()))
+		is.Equal(http.StatusFound, code)
+		is.Equal(model.SequenceStepIfOpened, s.steps[0].Condition)
+	})
+
+	t.Run("errors on invalid steps", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{sequences: []model.Sequence{{ID: 1, Name: "Welcome", Locale: "en"}}}
+		mux := newSequencesMux(s)
+
+		for _, form := range []url.Values{
+			{"delay_hours": {"-1"}, "condition": {"always"}, "subject": {"Hello"}, "body": {"Hi!"}},
+			{"delay_hours": {"1"}, "condition": {"sometimes"}, "subject": {"Hello"}, "body": {"Hi!"}},
+			{"delay_hours": {"1"}, "condition": {"always"}, "subject": {" "}, "body": {"Hi!"}},
+		} {
+			code, _, _ := makePostRequest(mux, "/admin/sequences/1/steps", createFormHeader(),
+				strings.NewReader(form.Encode()))
+			is.Equal(http.StatusBadRequest, code)
+		}
+		is.Equal(0, len(s.steps))
+	})
+
+	t.Run("moves steps", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{}
+		mux := newSequencesMux(s)
+
+		code, header, _ := makePostRequest(mux, "/admin/sequences/1/steps/2/move", createFormHeader(),
+			strings.NewReader("direction=up"))
+		is.Equal(http.StatusFound, code)
+		is.Equal("/admin/sequences/1", header.Get("Location"))
+		is.True(s.moved)
+		is.True(s.up)
+	})
+}
+
+func TestSequenceOpen(t *testing.T) {
+	t.Run("records the open and responds with an uncached image", func(t *testing.T) {
+		is := is.New(t)
+		s := &sequenceStoreMock{}
+		mux := chi.NewMux()
+		handlers.SequenceOpen(mux, s)
+
+		code, header, body := makeGetRequest(mux, "/newsletter/open?token=abc")
+		is.Equal(http.StatusOK, code)
+		is.Equal("image/gif", header.Get("Content-Type"))
+		is.Equal("no-store", header.Get("Cache-Control"))
+		is.True(strings.HasPrefix(body, "GIF89a"))
+		is.Equal("abc", s.opened)
+	})
+}
@@ -1,12 +1,137 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
 	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func Public(mux chi.Router) {
-	fs := http.FileServer(http.Dir("./public"))
-	mux.Handle("/public/*", http.StripPrefix("/public/", fs))
+// fingerprintedMatcher for asset names with a content hash, like "css/tailwind.3f2a1b9c.css".
+var fingerprintedMatcher = regexp.MustCompile(`\.[0-9a-f]{8}(\.[^./]+)?$`)
+
+// encodings of precompressed asset variants, in order of preference.
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{name: "br", ext: ".br"},
+	{name: "gzip", ext: ".gz"},
+}
+
+// Public assets from fsys under /public/.
+// Fingerprinted assets are cached forever, and other assets are revalidated with their ETag.
+// Precompressed brotli and gzip variants next to an asset (like "app.css.br") are served
+// if the client accepts them.
+func Public(mux chi.Router, fsys fs.FS) {
+	etags := &etagCache{etags: map[string]etag{}}
+
+	mux.Get("/public/*", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+chi.URLParam(r, "*")), "/")
+		if !fs.ValidPath(name) || name == "." {
+			renderError(w, r, http.StatusNotFound, notFoundMessage)
+			return
+		}
+
+		content, tag, err := readAsset(fsys, etags, name)
+		if err != nil {
+			renderError(w, r, http.StatusNotFound, notFoundMessage)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Vary", "Accept-Encoding")
+		if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+			h.Set("Content-Type", contentType)
+		}
+		if fingerprintedMatcher.MatchString(name) {
+			h.Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			h.Set("Cache-Control", "no-cache")
+		}
+
+		for _, e := range encodings {
+			if !acceptsEncoding(r, e.name) {
+				continue
+			}
+			compressed, compressedTag, err := readAsset(fsys, etags, name+e.ext)
+			if err != nil {
+				continue
+			}
+			content, tag = compressed, compressedTag
+			h.Set("Content-Encoding", e.name)
+			break
+		}
+
+		h.Set("ETag", tag)
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+	})
+}
+
+// readAsset content and its ETag from fsys. Directories are not assets.
+func readAsset(fsys fs.FS, etags *etagCache, name string) ([]byte, string, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.IsDir() {
+		return nil, "", fs.ErrNotExist
+	}
+
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, etags.get(name, info, content), nil
+}
+
+// etag of an asset, with the size and modification time it was computed for.
+type etag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// etagCache remembers asset ETags, so the content is only hashed again if the asset changes on disk.
+type etagCache struct {
+	etags map[string]etag
+	mutex sync.Mutex
+}
+
+func (c *etagCache) get(name string, info fs.FileInfo, content []byte) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.etags[name]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.value
+	}
+
+	hash := sha256.Sum256(content)
+	value := `"` + hex.EncodeToString(hash[:16]) + `"`
+	c.etags[name] = etag{modTime: info.ModTime(), size: info.Size(), value: value}
+	return value
+}
+
+// acceptsEncoding is true if the request's Accept-Encoding header includes the encoding and doesn't refuse it.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+				continue
+			}
+			q := strings.ReplaceAll(params, " ", "")
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
+	}
+	return false
 }
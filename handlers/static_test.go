@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+)
+
+func TestPublic(t *testing.T) {
+	fsys := fstest.MapFS{
+		"css/app.css":             {Data: []byte("body{}")},
+		"css/app.3f2a1b9c.css":    {Data: []byte("body{}")},
+		"css/app.3f2a1b9c.css.br": {Data: []byte("brotli")},
+		"css/app.3f2a1b9c.css.gz": {Data: []byte("gzip")},
+	}
+
+	mux := chi.NewMux()
+	handlers.Public(mux, fsys)
+
+	t.Run("serves an asset with revalidation caching", func(t *testing.T) {
+		is := is.New(t)
+
+		code, header, body := makeGetRequest(mux, "/public/css/app.css")
+		is.Equal(http.StatusOK, code)
+		is.Equal("body{}", body)
+		is.Equal("text/css; charset=utf-8", header.Get("Content-Type"))
+		is.Equal("no-cache", header.Get("Cache-Control"))
+		is.True(header.Get("ETag") != "")
+	})
+
+	t.Run("serves a fingerprinted asset with immutable caching", func(t *testing.T) {
+		is := is.New(t)
+
+		code, header, _ := makeGetRequest(mux, "/public/css/app.3f2a1b9c.css")
+		is.Equal(http.StatusOK, code)
+		is.Equal("public, max-age=31536000, immutable", header.Get("Cache-Control"))
+	})
+
+	t.Run("returns 304 if the ETag matches", func(t *testing.T) {
+		is := is.New(t)
+
+		_, header, _ := makeGetRequest(mux, "/public/css/app.css")
+
+		req := httptest.NewRequest(http.MethodGet, "/public/css/app.css", nil)
+		req.Header.Set("If-None-Match", header.Get("ETag"))
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		is.Equal(http.StatusNotModified, res.Code)
+	})
+
+	t.Run("serves a precompressed variant if accepted", func(t *testing.T) {
+		is := is.New(t)
+
+		tests := []struct {
+			acceptEncoding  string
+			contentEncoding string
+			body            string
+		}{
+			{"gzip, deflate, br", "br", "brotli"},
+			{"gzip", "gzip", "gzip"},
+			{"gzip, br;q=0", "gzip", "gzip"},
+			{"", "", "body{}"},
+		}
+		for _, test := range tests {
+			req := httptest.NewRequest(http.MethodGet, "/public/css/app.3f2a1b9c.css", nil)
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			is.Equal(http.StatusOK, res.Code)
+			is.Equal(test.contentEncoding, res.Header().Get("Content-Encoding"))
+			is.Equal("text/css; charset=utf-8", res.Header().Get("Content-Type"))
+			is.Equal("Accept-Encoding", res.Header().Get("Vary"))
+			is.Equal(test.body, res.Body.String())
+		}
+	})
+
+	t.Run("returns 404 for missing assets and directories", func(t *testing.T) {
+		is := is.New(t)
+
+		for _, target := range []string{"/public/css/nope.css", "/public/css", "/public/", "/public/../go.mod"} {
+			code, _, _ := makeGetRequest(mux, target)
+			is.Equal(http.StatusNotFound, code)
+		}
+	})
+}
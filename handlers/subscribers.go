@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"canvas/i18n"
+	"canvas/model"
+	"canvas/storage"
+	"canvas/subscribercsv"
+	"canvas/util"
+	"canvas/views"
+)
+
+const (
+	// maxImportSize of uploaded CSV files. Hundreds of thousands of rows fit comfortably.
+	maxImportSize = 100 << 20
+
+	// maxImportMemory of an upload kept in memory, the rest is buffered in a temporary file.
+	maxImportMemory = 10 << 20
+
+	// importTimeout for reading, importing, and responding, instead of the short server timeouts.
+	importTimeout = 10 * time.Minute
+)
+
+type subscriberImporter interface {
+	ImportSubscribers(ctx context.Context, subscribers []model.Subscriber, consent model.Consent) (map[model.Email]string, error)
+}
+
+type subscriberExporter interface {
+	ExportSubscribers(ctx context.Context, filter storage.SubscriberFilter, fn func(model.Subscriber) error) error
+}
+
+// Subscribers page with the import and export forms.
+func Subscribers(mux chi.Router) {
+	mux.Get("/admin/subscribers", func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, http.StatusOK, views.SubscribersPage(""))
+	})
+}
+
+// SubscriberImport from an uploaded CSV file, in the mode and with the column mapping from the form.
+// Confirmation emails are scheduled by the store. Responds with a report of the rows that weren't imported.
+func SubscriberImport(mux chi.Router, s subscriberImporter) {
+	importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: s})
+
+	mux.Post("/admin/subscribers/import", func(w http.ResponseWriter, r *http.Request) {
+		extendDeadlines(w, importTimeout)
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+		if err := r.ParseMultipartForm(maxImportMemory); err != nil {
+			message := "Could not read the upload."
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				message = fmt.Sprintf("The file is too large, the limit is %v MB.", maxImportSize>>20)
+			}
+			render(w, r, http.StatusBadRequest, views.SubscribersPage(message))
+			return
+		}
+		defer func() {
+			_ = r.MultipartForm.RemoveAll()
+		}()
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			render(w, r, http.StatusBadRequest, views.SubscribersPage("Choose a CSV file to import."))
+			return
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		comma := ','
+		switch r.FormValue("delimiter") {
+		case ";":
+			comma = ';'
+		case "tab":
+			comma = '\t'
+		}
+
+		report, err := importer.Import(r.Context(), file, subscribercsv.ImportOptions{
+			Columns: subscribercsv.Columns{Email: r.FormValue("email_column"), Locale: r.FormValue("locale_column")},
+			Comma:   comma,
+			Consent: consentFromRequest(r, model.ConsentSourceImport),
+			Mode:    subscribercsv.Mode(r.FormValue("mode")),
+		})
+		util.Logger(r.Context()).Info("Imported subscribers", slog.Int("rows", report.Rows),
+			slog.Int("imported", report.Imported), slog.Int("skipped", report.Skipped),
+			slog.Int("invalid", report.Invalid))
+
+		if errors.Is(err, subscribercsv.ErrStore) {
+			util.Logger(r.Context()).Error("Error importing subscribers", util.ErrAttr(err))
+			render(w, r, http.StatusBadGateway, views.SubscriberImportReportPage(report,
+				"the subscribers couldn't be saved. Importing the file again skips the ones that were."))
+			return
+		}
+		if err != nil {
+			util.Logger(r.Context()).Info("Error importing subscribers", util.ErrAttr(err))
+			render(w, r, http.StatusBadRequest, views.SubscriberImportReportPage(report, err.Error()))
+			return
+		}
+		render(w, r, http.StatusOK, views.SubscriberImportReportPage(report, ""))
+	})
+}
+
+// SubscriberExport as a CSV download, filtered by the confirmed, active, and locale query parameters.
+// Rows are written as they are read from the database.
+func SubscriberExport(mux chi.Router, s subscriberExporter) {
+	mux.Get("/admin/subscribers/export", func(w http.ResponseWriter, r *http.Request) {
+		var filter storage.SubscriberFilter
+		var err error
+		if filter.Confirmed, err = parseOptionalBool(r.URL.Query().Get("confirmed")); err != nil {
+			renderError(w, r, http.StatusBadRequest, "error.message.invalid_export_filter")
+			return
+		}
+		if filter.Active, err = parseOptionalBool(r.URL.Query().Get("active")); err != nil {
+			renderError(w, r, http.StatusBadRequest, "error.message.invalid_export_filter")
+			return
+		}
+		if locale := r.URL.Query().Get("locale"); locale != "" {
+			l, ok := i18n.Parse(locale)
+			if !ok {
+				renderError(w, r, http.StatusBadRequest, "error.message.invalid_export_filter")
+				return
+			}
+			filter.Locale = l
+		}
+
+		extendDeadlines(w, importTimeout)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="subscribers-%v.csv"`, time.Now().UTC().Format("2006-01-02")))
+
+		// The response is already under way if exporting fails, so the error is only logged
+		if err := subscribercsv.Export(r.Context(), w, s, filter); err != nil {
+			util.Logger(r.Context()).Error("Error exporting subscribers", util.ErrAttr(err))
+		}
+	})
+}
+
+// extendDeadlines for reading the request and writing the response to the timeout from now,
+// for the few routes that stream large bodies. Not all response writers support it, which is fine.
+func extendDeadlines(w http.ResponseWriter, timeout time.Duration) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(timeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(timeout))
+}
+
+// parseOptionalBool returns nil for the empty string.
+func parseOptionalBool(v string) (*bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
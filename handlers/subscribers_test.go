@@ -0,0 +1,240 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+
+	"canvas/handlers"
+	"canvas/i18n"
+	"canvas/model"
+	"canvas/storage"
+)
+
+type subscriberStoreMock struct {
+	consent     model.Consent
+	err         error
+	events      []model.ConsentEvent
+	filter      storage.SubscriberFilter
+	subscribers []model.Subscriber
+}
+
+func (s *subscriberStoreMock) ImportSubscribers(
+	ctx context.Context,
+	subscribers []model.Subscriber,
+	consent model.Consent,
+) (map[model.Email]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.consent = consent
+	tokens := map[model.Email]string{}
+	for _, subscriber := range subscribers {
+		s.subscribers = append(s.subscribers, subscriber)
+		tokens[subscriber.Email] = "123"
+	}
+	return tokens, nil
+}
+
+func (s *subscriberStoreMock) ExportSubscribers(
+	ctx context.Context,
+	filter storage.SubscriberFilter,
+	fn func(model.Subscriber) error,
+) error {
+	s.filter = filter
+	for _, subscriber := range s.subscribers {
+		if err := fn(subscriber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSubscriberImport(t *testing.T) {
+	upload := func(t *testing.T, fields map[string]string, file string) *http.Request {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range fields {
+			if err := mw.WriteField(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if file != "" {
+			fw, err := mw.CreateFormFile("file", "subscribers.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = fw.Write([]byte(file))
+		}
+		_ = mw.Close()
+		r := httptest.NewRequest(http.MethodPost, "/admin/subscribers/import", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		return r
+	}
+
+	t.Run("imports unconfirmed subscribers and reports invalid rows", func(t *testing.T) {
+		is := is.New(t)
+		mux := chi.NewMux()
+		s := &subscriberStoreMock{}
+		handlers.SubscriberImport(mux, s)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, upload(t, map[string]string{"mode": "confirm", "delimiter": ";"},
+			"email;locale\nme@example.com;da\nnotanemail;en\n"))
+
+		is.Equal(http.StatusOK, w.Code)
+		is.Equal(1, len(s.subscribers))
+		is.Equal(model.Email("me@example.com"), s.subscribers[0].Email)
+		is.Equal(i18n.Locale("da"), s.subscribers[0].Locale)
+		is.True(strings.Contains(w.Body.String(), "notanemail"))
+		is.True(!s.subscribers[0].Confirmed)
+		is.Equal(model.Consent{Source: "import", IP: "192.0.2.1"}, s.consent)
+	})
+
+	t.Run("rejects an upload without a file", func(t *testing.T) {
+		is := is.New(t)
+		mux := chi.NewMux()
+		s := &subscriberStoreMock{}
+		handlers.SubscriberImport(mux, s)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, upload(t, map[string]string{"mode": "confirm"}, ""))
+
+		is.Equal(http.StatusBadRequest, w.Code)
+		is.Equal(0, len(s.subscribers))
+	})
+
+	t.Run("reports an unknown mode", func(t *testing.T) {
+		is := is.New(t)
+		mux := chi.NewMux()
+		s := &subscriberStoreMock{}
+		handlers.SubscriberImport(mux, s)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, upload(t, map[string]string{"mode": "whatever"}, "email\nme@example.com\n"))
+
+		is.Equal(http.StatusBadRequest, w.Code)
+		is.Equal(0, len(s.subscribers))
+	})
+
+	t.Run("reports store errors as a server error without the details", func(t *testing.T) {
+		is := is.New(t)
+		mux := chi.NewMux()
+		s := &subscriberStoreMock{err: errors.New("connection refused")}
+		handlers.SubscriberImport(mux, s)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, upload(t, map[string]string{"mode": "confirm"}, "email\nme@example.com\n"))
+
+		is.Equal(http.StatusBadGateway, w.Code)
+		is.True(!strings.Contains(w.Body.String(), "connection refused"))
+	})
+}
+
+func TestSubscriberExport(t *testing.T) {
+	t.Run("streams filtered subscribers as a CSV download", func(t *testing.T) {
+		is := is.New(t)
+		mux := chi.NewMux()
+		s := &subscriberStoreMock{subscribers: []model.Subscriber{{Email: "me@example.com", Locale: "en", Confirmed: true, Active: true}}}
+		handlers.SubscriberExport(mux, s)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/subscribers/export?confirmed=true&locale=en", nil))
+
+		is.Equal(http.StatusOK, w.Code)
+		is.Equal("text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		is.True(strings.HasPrefix(w.Header().Get("Content-Disposition"), `attachment; filename="subscribers-`))
+		is.True(s.filter.Confirmed != nil && *s.filter.Confirmed)
+		is.True(s.filter.Active == nil)
+		is.Equal(i18n.Locale("en"), s.filter.Locale)
+		is.True(strings.Contains(w.Body.String(), "me@example.com"))
+	})
+
+	t.Run("rejects an invalid filter", func(t *testing.T) {
+		is := is.New(t)
+		mux := chi.NewMux()
+		handlers.SubscriberExport(mux, &subscriberStoreMock{})
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/subscribers/export?active=maybe", nil))
+
+		is.Equal(http.StatusBadRequest, w.Code)
+		is.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		is.True(strings.Contains(w.Body.String(), "The export filter is invalid."))
+	})
+}
+
+func (s *subscriberStoreMock) GetSubscriber(ctx context.Context, email model.Email) (*model.Subscriber, error) {
+	for _, subscriber := range s.subscribers {
+		if strings.EqualFold(subscriber.Email.String(), email.String()) {
+			return &subscriber, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *subscriberStoreMock) ListConsentEvents(ctx context.Context, email model.Email) ([]model.ConsentEvent, error) {
+	var events []model.ConsentEvent
+	for _, e := range s.events {
+		if strings.EqualFold(e.Email.String(), email.String()) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func TestSubscriberTimeline(t *testing.T) {
+	s := &subscriberStoreMock{
+		events: []model.ConsentEvent{
+			{Email: "me@example.com", Type: model.ConsentEventSignup, Consent: model.Consent{Source: "signup_form", IP: "192.0.2.1"}},
+			{Email: "gone@example.com", Type: model.ConsentEventSignup, Consent: model.Consent{Source: "api"}},
+		},
+		subscribers: []model.Subscriber{{Email: "me@example.com", Locale: "da", Active: true}},
+	}
+	mux := chi.NewMux()
+	handlers.SubscriberTimeline(mux, s)
+
+	t.Run("shows the subscriber and their consent events", func(t *testing.T) {
+		is := is.New(t)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/subscribers/timeline?email=Me%40Example.com", nil))
+
+		is.Equal(http.StatusOK, w.Code)
+		body := w.Body.String()
+		is.True(strings.Contains(body, "Timeline of Me@example.com"))
+		is.True(strings.Contains(body, "<li>Locale: da</li>"))
+		is.True(strings.Contains(body, "<td>signup_form</td>"))
+		is.True(strings.Contains(body, "<td>192.0.2.1</td>"))
+		is.True(!strings.Contains(body, "<td>api</td>"))
+	})
+
+	t.Run("shows the events of a subscriber that is gone", func(t *testing.T) {
+		is := is.New(t)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/subscribers/timeline?email=gone@example.com", nil))
+
+		is.Equal(http.StatusOK, w.Code)
+		is.True(strings.Contains(w.Body.String(), "There is no subscriber with this address."))
+		is.True(strings.Contains(w.Body.String(), "<td>api</td>"))
+	})
+
+	t.Run("rejects an invalid email address", func(t *testing.T) {
+		is := is.New(t)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/subscribers/timeline?email=notanemail", nil))
+
+		is.Equal(http.StatusBadRequest, w.Code)
+	})
+}
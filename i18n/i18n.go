@@ -0,0 +1,162 @@
+// Package i18n translates the copy in pages and emails, from message catalogs per locale.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Locale of a supported language, as a lowercase language tag such as "en".
+type Locale string
+
+// Default locale, used when no supported locale is requested, and for keys missing in other catalogs.
+const Default Locale = "en"
+
+// Locales supported, with the default first.
+var Locales = []Locale{Default, "da", "de"}
+
+//go:embed locales
+var locales embed.FS
+
+// catalogs map locales to message keys to messages, see LoadCatalogs.
+var catalogs = struct {
+	messages map[Locale]map[string]string
+	mutex    sync.RWMutex
+}{}
+
+func init() {
+	fsys, err := fs.Sub(locales, "locales")
+	if err != nil {
+		panic(err)
+	}
+	if err := LoadCatalogs(fsys); err != nil {
+		panic(err)
+	}
+}
+
+// LoadCatalogs from a JSON file per supported locale in fsys, such as en.json, replacing the embedded ones.
+// Each file is a flat object of message keys to messages.
+// Messages for keys ending in _html are trusted HTML, which views render without escaping.
+func LoadCatalogs(fsys fs.FS) error {
+	messages := map[Locale]map[string]string{}
+	for _, l := range Locales {
+		catalogAsBytes, err := fs.ReadFile(fsys, string(l)+".json")
+		if err != nil {
+			return err
+		}
+
+		var catalog map[string]string
+		if err := json.Unmarshal(catalogAsBytes, &catalog); err != nil {
+			return fmt.Errorf("error parsing catalog for locale %v: %w", l, err)
+		}
+		messages[l] = catalog
+	}
+
+	catalogs.mutex.Lock()
+	defer catalogs.mutex.Unlock()
+	catalogs.messages = messages
+	return nil
+}
+
+// T translates the message with the given key to the locale.
+// Keys missing in the locale's catalog fall back to the default catalog, and then to the key itself.
+// If there are args, the message is a format string for them, see fmt.Sprintf.
+func (l Locale) T(key string, args ...any) string {
+	catalogs.mutex.RLock()
+	message, ok := catalogs.messages[l][key]
+	if !ok {
+		message, ok = catalogs.messages[Default][key]
+	}
+	catalogs.mutex.RUnlock()
+
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Parse the locale from a language tag, such as from a cookie or URL, if it's supported.
+func Parse(tag string) (Locale, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	for _, l := range Locales {
+		if string(l) == tag {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+// Match the supported locale preferred in an Accept-Language header, such as "da-DK,da;q=0.9,en;q=0.8".
+// Regional tags match the locale for their language, so "da-DK" matches "da".
+func Match(acceptLanguage string) (Locale, bool) {
+	type preference struct {
+		locale Locale
+		q      float64
+	}
+	var preferences []preference
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		language, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+		l, ok := Parse(language)
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		preferences = append(preferences, preference{locale: l, q: q})
+	}
+
+	if len(preferences) == 0 {
+		return "", false
+	}
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].q > preferences[j].q
+	})
+	return preferences[0].locale, true
+}
+
+type localeContextKey struct{}
+
+// ContextWithLocale returns a copy of ctx carrying the locale, for FromContext to fetch.
+func ContextWithLocale(ctx context.Context, l Locale) context.Context {
+	return context.WithValue(ctx, localeContextKey{}, l)
+}
+
+// FromContext gets the locale, such as the one negotiated for the request by handlers.Localize.
+// Falls back to the default locale.
+func FromContext(ctx context.Context) Locale {
+	if l, ok := ctx.Value(localeContextKey{}).(Locale); ok {
+		return l
+	}
+	return Default
+}
+
+// T translates the message with the given key to the locale from the context, see Locale.T.
+func T(ctx context.Context, key string, args ...any) string {
+	return FromContext(ctx).T(key, args...)
+}
+
+// Path with the locale prefix, such as "/da/newsletter/thanks" for "/newsletter/thanks".
+func (l Locale) Path(path string) string {
+	return "/" + string(l) + path
+}
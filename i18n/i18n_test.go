@@ -0,0 +1,125 @@
+package i18n_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+
+	"canvas/i18n"
+)
+
+func TestCatalogs(t *testing.T) {
+	t.Run("has every key from the default catalog in every supported locale, and no others", func(t *testing.T) {
+		is := is.New(t)
+
+		defaultCatalog := readCatalog(t, i18n.Default)
+		for _, l := range i18n.Locales[1:] {
+			catalog := readCatalog(t, l)
+			for key := range defaultCatalog {
+				if _, ok := catalog[key]; !ok {
+					t.Errorf("key %v is missing in locale %v", key, l)
+				}
+			}
+			for key := range catalog {
+				if _, ok := defaultCatalog[key]; !ok {
+					t.Errorf("key %v in locale %v is not in the default locale", key, l)
+				}
+			}
+		}
+		is.True(len(defaultCatalog) > 0)
+	})
+
+	t.Run("has the same format verbs for each key in every supported locale", func(t *testing.T) {
+		defaultCatalog := readCatalog(t, i18n.Default)
+		for _, l := range i18n.Locales[1:] {
+			for key, message := range readCatalog(t, l) {
+				if countVerbs(message) != countVerbs(defaultCatalog[key]) {
+					t.Errorf("key %v in locale %v has different format verbs than the default locale", key, l)
+				}
+			}
+		}
+	})
+}
+
+func TestLocale_T(t *testing.T) {
+	t.Run("translates to the locale", func(t *testing.T) {
+		is := is.New(t)
+		is.Equal("Sign up", i18n.Locale("en").T("signup.button"))
+		is.Equal("Tilmeld", i18n.Locale("da").T("signup.button"))
+	})
+
+	t.Run("falls back to the default locale per key, and then to the key", func(t *testing.T) {
+		is := is.New(t)
+
+		is.NoErr(i18n.LoadCatalogs(fstest.MapFS{
+			"en.json": {Data: []byte(`{"hello": "Hello", "bye": "Bye %v"}`)},
+			"da.json": {Data: []byte(`{"hello": "Hej"}`)},
+			"de.json": {Data: []byte(`{}`)},
+		}))
+		t.Cleanup(func() {
+			is.NoErr(i18n.LoadCatalogs(os.DirFS("locales")))
+		})
+
+		is.Equal("Hej", i18n.Locale("da").T("hello"))
+		is.Equal("Bye you", i18n.Locale("da").T("bye", "you"))
+		is.Equal("Hello", i18n.Locale("de").T("hello"))
+		is.Equal("nope", i18n.Locale("da").T("nope"))
+	})
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		expected       i18n.Locale
+		ok             bool
+	}{
+		{"da", "da", true},
+		{"da-DK,da;q=0.9,en;q=0.8", "da", true},
+		{"fr-FR,fr;q=0.9,de;q=0.5,en;q=0.7", "en", true},
+		{"en;q=0.5,de", "de", true},
+		{"de;q=0,en", "en", true},
+		{"fr, *;q=0.5", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.acceptLanguage, func(t *testing.T) {
+			is := is.New(t)
+			l, ok := i18n.Match(test.acceptLanguage)
+			is.Equal(test.expected, l)
+			is.Equal(test.ok, ok)
+		})
+	}
+}
+
+func TestT(t *testing.T) {
+	t.Run("translates to the locale from the context, or the default locale", func(t *testing.T) {
+		is := is.New(t)
+		ctx := context.Background()
+		is.Equal("Sign up", i18n.T(ctx, "signup.button"))
+		is.Equal("Anmelden", i18n.T(i18n.ContextWithLocale(ctx, "de"), "signup.button"))
+	})
+}
+
+// readCatalog for the locale from the locales directory.
+func readCatalog(t *testing.T, l i18n.Locale) map[string]string {
+	t.Helper()
+	catalogAsBytes, err := os.ReadFile("locales/" + string(l) + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var catalog map[string]string
+	if err := json.Unmarshal(catalogAsBytes, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+// countVerbs in a format string, ignoring escaped percent signs.
+func countVerbs(message string) int {
+	return strings.Count(strings.ReplaceAll(message, "%%", ""), "%")
+}
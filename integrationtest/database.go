@@ -2,13 +2,11 @@ package integrationtest
 
 import (
 	"context"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/maragudk/env"
-	"github.com/maragudk/migrate"
 
 	"canvas/storage"
 )
@@ -47,13 +45,13 @@ func initDatabase() {
 		time.Sleep(100 * time.Millisecond)
 	}
 
-	if err := migrate.Up(context.Background(), db.DB.DB, os.DirFS("../storage/migrations")); err != nil {
+	if err := db.MigrateUp(context.Background()); err != nil {
 		panic(err)
 	}
-	if err := migrate.Down(context.Background(), db.DB.DB, os.DirFS("../storage/migrations")); err != nil {
+	if err := db.MigrateTo(context.Background(), ""); err != nil {
 		panic(err)
 	}
-	if err := migrate.Up(context.Background(), db.DB.DB, os.DirFS("../storage/migrations")); err != nil {
+	if err := db.MigrateUp(context.Background()); err != nil {
 		panic(err)
 	}
 
@@ -2,8 +2,11 @@ package integrationtest
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/maragudk/env"
 
 	"canvas/messaging"
@@ -19,14 +22,53 @@ func CreateQueue() (*messaging.Queue, func()) {
 	// load the test env variables.
 	env.MustLoad("../.env-test")
 
-	name := env.GetStringOrDefault("QUEUE_NAME", "jobs")
-	queue := messaging.NewQueue(messaging.NewQueueOptions{
-		Config: getAWSConfig(),
-		Name:   name,
+	return createQueue(messaging.NewQueueOptions{
+		Name: env.GetStringOrDefault("QUEUE_NAME", "jobs"),
+	}, nil)
+}
+
+// CreateQueueWithVisibilityTimeout for testing, with the given default visibility timeout, in whole seconds.
+// Usage:
+//
+//	queue, cleanup := CreateQueueWithVisibilityTimeout(time.Second)
+//	defer cleanup()
+//	…
+func CreateQueueWithVisibilityTimeout(timeout time.Duration) (*messaging.Queue, func()) {
+	env.MustLoad("../.env-test")
+
+	return createQueue(messaging.NewQueueOptions{
+		Name: env.GetStringOrDefault("QUEUE_NAME", "jobs") + "-visibility",
+	}, map[string]string{
+		string(types.QueueAttributeNameVisibilityTimeout): strconv.Itoa(int(timeout.Seconds())),
 	})
+}
+
+// CreateFIFOQueue for testing, with message groups from the "email" field
+// and deduplication IDs from the "idempotency_key" field.
+// Usage:
+//
+//	queue, cleanup := CreateFIFOQueue()
+//	defer cleanup()
+//	…
+func CreateFIFOQueue() (*messaging.Queue, func()) {
+	env.MustLoad("../.env-test")
+
+	return createQueue(messaging.NewQueueOptions{
+		DeduplicationIDField: "idempotency_key",
+		GroupIDField:         "email",
+		Name:                 env.GetStringOrDefault("QUEUE_NAME", "jobs") + ".fifo",
+	}, map[string]string{
+		string(types.QueueAttributeNameFifoQueue): "true",
+	})
+}
+
+func createQueue(opts messaging.NewQueueOptions, attributes map[string]string) (*messaging.Queue, func()) {
+	opts.Config = getAWSConfig()
+	queue := messaging.NewQueue(opts)
 
 	createQueueOutput, err := queue.Client.CreateQueue(context.Background(), &sqs.CreateQueueInput{
-		QueueName: &name,
+		Attributes: attributes,
+		QueueName:  &opts.Name,
 	})
 
 	if err != nil {
@@ -17,10 +17,11 @@ func CreateServer() func() {
 	db, cleanupDB := CreateDatabase()
 	queue, cleanupQueue := CreateQueue()
 	s := server.New(server.Options{
-		Database: db,
-		Host:     "localhost",
-		Port:     8081,
-		Queue:    queue,
+		Database:   db,
+		Host:       "localhost",
+		Port:       8081,
+		Queue:      queue,
+		SigningKey: "abcdefghijklmnopqrstuvwxyzabcdef",
 	})
 
 	go func() {
@@ -4,19 +4,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"canvas/i18n"
 	"canvas/model"
 )
 
 type newsletterconfirmationEmailSender interface {
-	SendNewsletterConfirmationEmail(ctx context.Context, to model.Email, token string) error
+	SendNewsletterConfirmationEmail(ctx context.Context, to model.Email, token string, locale i18n.Locale) error
 }
 
-// SendNewsletterConfirmationEmail to a newsletter subscriber.
-func SendNewsletterConfirmationEmail(r registry, es newsletterconfirmationEmailSender) {
-	r.Register("confirmation_email", func(ctx context.Context, m model.Message) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+type reminderScheduler interface {
+	ScheduleMessage(ctx context.Context, key string, m model.Message, at time.Time) error
+}
+
+// SendNewsletterConfirmationEmail to a newsletter subscriber, in their locale.
+// If reminderDelay is positive, a confirmation reminder is scheduled for after the delay,
+// replacing any reminder scheduled for an earlier signup with the same address.
+func SendNewsletterConfirmationEmail(
+	r registry,
+	es newsletterconfirmationEmailSender,
+	s reminderScheduler,
+	reminderDelay time.Duration,
+) {
+	r.Register(model.JobConfirmationEmail, func(ctx context.Context, m model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
 		to, ok := m["email"]
@@ -29,21 +42,30 @@ func SendNewsletterConfirmationEmail(r registry, es newsletterconfirmationEmailS
 			return errors.New("no token in message")
 		}
 
-		if err := es.SendNewsletterConfirmationEmail(ctx, model.Email(to), token); err != nil {
+		if err := es.SendNewsletterConfirmationEmail(ctx, model.Email(to), token, getLocale(m)); err != nil {
 			return fmt.Errorf("error sending newsletter confirmation email: %w", err)
 		}
 
+		if reminderDelay <= 0 {
+			return nil
+		}
+		reminder := model.Message{"job": model.JobConfirmationReminderEmail, "email": to}
+		key := confirmationReminderKeyPrefix + strings.ToLower(to)
+		if err := s.ScheduleMessage(ctx, key, reminder, time.Now().Add(reminderDelay)); err != nil {
+			return fmt.Errorf("error scheduling confirmation reminder: %w", err)
+		}
+
 		return nil
 	})
 }
 
 type newsletterWelcomeEmailSender interface {
-	SendNewsletterWelcomeEmail(ctx context.Context, to model.Email) error
+	SendNewsletterWelcomeEmail(ctx context.Context, to model.Email, locale i18n.Locale) error
 }
 
 func SendNewsletterWelcomeEmail(r registry, es newsletterWelcomeEmailSender) {
-	r.Register("welcome_email", func(ctx context.Context, m model.Message) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	r.Register(model.JobWelcomeEmail, func(ctx context.Context, m model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
 		to, ok := m["email"]
@@ -51,10 +73,18 @@ func SendNewsletterWelcomeEmail(r registry, es newsletterWelcomeEmailSender) {
 			return errors.New("no email address in message")
 		}
 
-		if err := es.SendNewsletterWelcomeEmail(ctx, model.Email(to)); err != nil {
+		if err := es.SendNewsletterWelcomeEmail(ctx, model.Email(to), getLocale(m)); err != nil {
 			return fmt.Errorf("error sending newsletter welcome email: %w", err)
 		}
 
 		return nil
 	})
 }
+
+// getLocale from the message, falling back to the default locale for messages sent without one.
+func getLocale(m model.Message) i18n.Locale {
+	if locale, ok := i18n.Parse(m["locale"]); ok {
+		return locale
+	}
+	return i18n.Default
+}
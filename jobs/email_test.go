@@ -4,74 +4,134 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 
+	"canvas/i18n"
 	"canvas/jobs"
 	"canvas/model"
 )
 
 type mockConfirmationEmailer struct {
-	err   error
-	to    model.Email
-	token string
+	err    error
+	to     model.Email
+	token  string
+	locale i18n.Locale
 }
 
 func (m *mockConfirmationEmailer) SendNewsletterConfirmationEmail(
 	ctx context.Context,
 	to model.Email,
 	token string,
+	locale i18n.Locale,
 ) error {
 	m.to = to
 	m.token = token
+	m.locale = locale
 	return m.err
 }
 
 func TestSendConfirmationEmail(t *testing.T) {
 	r := testRegistry{}
 
-	t.Run("passes the recipient email and token to the email sender", func(t *testing.T) {
+	t.Run("passes the recipient email, token, and locale to the email sender", func(t *testing.T) {
 		is := is.New(t)
 
 		emailer := &mockConfirmationEmailer{}
-		jobs.SendNewsletterConfirmationEmail(r, emailer)
+		jobs.SendNewsletterConfirmationEmail(r, emailer, nil, 0)
 
 		job, ok := r["confirmation_email"]
 		is.True(ok)
 
-		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123"})
+		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123", "locale": "da"})
 		is.NoErr(err)
 
 		is.Equal("you@example.com", emailer.to.String())
 		is.Equal("123", emailer.token)
+		is.Equal(i18n.Locale("da"), emailer.locale)
+	})
+
+	t.Run("uses the default locale if the message has none", func(t *testing.T) {
+		is := is.New(t)
+
+		emailer := &mockConfirmationEmailer{}
+		jobs.SendNewsletterConfirmationEmail(r, emailer, nil, 0)
+		job := r["confirmation_email"]
+
+		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123"})
+		is.NoErr(err)
+		is.Equal(i18n.Default, emailer.locale)
 	})
 
 	t.Run("errors on email sending failure", func(t *testing.T) {
 		is := is.New(t)
 
 		emailer := &mockConfirmationEmailer{err: errors.New("wire is cut")}
-		jobs.SendNewsletterConfirmationEmail(r, emailer)
+		jobs.SendNewsletterConfirmationEmail(r, emailer, nil, 0)
 		job := r["confirmation_email"]
 
 		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123"})
 		is.True(err != nil)
 	})
+
+	t.Run("schedules a confirmation reminder after the delay", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &mockScheduler{}
+		jobs.SendNewsletterConfirmationEmail(r, &mockConfirmationEmailer{}, s, 24*time.Hour)
+		job := r["confirmation_email"]
+
+		err := job(context.Background(), model.Message{"email": "You@example.com", "token": "123"})
+		is.NoErr(err)
+
+		is.Equal("confirmation_reminder:you@example.com", s.key)
+		is.Equal(model.Message{"job": "confirmation_reminder_email", "email": "You@example.com"}, s.m)
+		is.True(s.at.After(time.Now().Add(23 * time.Hour)))
+	})
+
+	t.Run("doesn't schedule a reminder if sending the confirmation email fails", func(t *testing.T) {
+		is := is.New(t)
+
+		s := &mockScheduler{}
+		jobs.SendNewsletterConfirmationEmail(r, &mockConfirmationEmailer{err: errors.New("wire is cut")}, s, time.Hour)
+		job := r["confirmation_email"]
+
+		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123"})
+		is.True(err != nil)
+		is.Equal("", s.key)
+	})
+}
+
+type mockScheduler struct {
+	key string
+	m   model.Message
+	at  time.Time
+}
+
+func (s *mockScheduler) ScheduleMessage(ctx context.Context, key string, m model.Message, at time.Time) error {
+	s.key = key
+	s.m = m
+	s.at = at
+	return nil
 }
 
 type mockWelcomeEmailer struct {
-	err error
-	to  model.Email
+	err    error
+	to     model.Email
+	locale i18n.Locale
 }
 
-func (m *mockWelcomeEmailer) SendNewsletterWelcomeEmail(ctx context.Context, to model.Email) error {
+func (m *mockWelcomeEmailer) SendNewsletterWelcomeEmail(ctx context.Context, to model.Email, locale i18n.Locale) error {
 	m.to = to
+	m.locale = locale
 	return m.err
 }
 
 func TestSendNewsletterWelcomeEmail(t *testing.T) {
 	r := testRegistry{}
 
-	t.Run("passes the recipient email to the email sender", func(t *testing.T) {
+	t.Run("passes the recipient email and locale to the email sender", func(t *testing.T) {
 		is := is.New(t)
 
 		emailer := &mockWelcomeEmailer{}
@@ -80,10 +140,11 @@ func TestSendNewsletterWelcomeEmail(t *testing.T) {
 		job, ok := r["welcome_email"]
 		is.True(ok)
 
-		err := job(context.Background(), model.Message{"email": "you@example.com"})
+		err := job(context.Background(), model.Message{"email": "you@example.com", "locale": "de"})
 		is.NoErr(err)
 
 		is.Equal("you@example.com", emailer.to.String())
+		is.Equal(i18n.Locale("de"), emailer.locale)
 	})
 
 	t.Run("errors on email sending failure", func(t *testing.T) {
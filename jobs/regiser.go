@@ -1,6 +1,59 @@
 package jobs
 
+import (
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"canvas/messaging"
+	"canvas/storage"
+)
+
+// dependencies of the jobs.
+type dependencies struct {
+	database      *storage.Database
+	emailer       *messaging.Emailer
+	metrics       *prometheus.Registry
+	reminderDelay time.Duration
+	retention     RetentionPolicies
+}
+
 func (r *Runner) registerJobs() {
-	SendNewsletterConfirmationEmail(r, r.emailer)
-	SendNewsletterWelcomeEmail(r, r.emailer)
+	register(r, dependencies{
+		database:      r.database,
+		emailer:       r.emailer,
+		metrics:       r.metrics,
+		reminderDelay: r.reminderDelay,
+		retention:     r.retention,
+	})
+}
+
+// register the jobs the Runner runs.
+func register(r registry, d dependencies) {
+	SendNewsletterConfirmationEmail(r, d.emailer, d.database, d.reminderDelay)
+	SendNewsletterConfirmationReminderEmail(r, d.database, d.emailer, d.metrics)
+	SendNewsletterWelcomeEmail(r, d.emailer)
+	ApplyRetentionPolicies(r, d.database, d.retention, d.metrics)
+	AdvanceSequenceEnrollment(r, d.database, d.emailer, d.metrics)
+}
+
+// nameRegistry only records the names of jobs.
+type nameRegistry map[string]struct{}
+
+func (r nameRegistry) Register(name string, fn Func) {
+	r[name] = struct{}{}
+}
+
+// Names of the jobs the Runner runs, sorted.
+func Names() []string {
+	r := nameRegistry{}
+	register(r, dependencies{})
+
+	var names []string
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
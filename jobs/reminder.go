@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"canvas/i18n"
+	"canvas/model"
+)
+
+// confirmationReminderKeyPrefix of scheduled confirmation reminders, followed by the lowercased email address.
+const confirmationReminderKeyPrefix = "confirmation_reminder:"
+
+type newsletterConfirmationReminderEmailSender interface {
+	SendNewsletterConfirmationReminderEmail(ctx context.Context, to model.Email, token string, locale i18n.Locale) error
+}
+
+type reminderStore interface {
+	RemindUnconfirmedSubscriber(
+		ctx context.Context,
+		email model.Email,
+		remind func(ctx context.Context, token string, locale i18n.Locale) error,
+	) (bool, error)
+}
+
+// SendNewsletterConfirmationReminderEmail to a newsletter subscriber who hasn't confirmed their signup yet,
+// in their locale. Every subscriber gets at most one reminder, and none if they have confirmed or been deactivated.
+// Reminders are counted in the app_confirmation_reminders_total metric, labelled with whether they were sent.
+// Together with app_newsletter_confirmations_total, that gives the conversion of reminded and unreminded signups.
+func SendNewsletterConfirmationReminderEmail(
+	r registry,
+	s reminderStore,
+	es newsletterConfirmationReminderEmailSender,
+	metrics *prometheus.Registry,
+) {
+	if metrics == nil {
+		metrics = prometheus.NewRegistry()
+	}
+
+	reminders := promauto.With(metrics).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_confirmation_reminders_total",
+		Help: "The total number of confirmation reminders, sent or skipped because the subscriber had confirmed, " +
+			"been deactivated, or been reminded already.",
+	}, []string{"sent"})
+
+	r.Register(model.JobConfirmationReminderEmail, func(ctx context.Context, m model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		to, ok := m["email"]
+		if !ok {
+			return errors.New("no email address in message")
+		}
+
+		reminded, err := s.RemindUnconfirmedSubscriber(ctx, model.Email(to),
+			func(ctx context.Context, token string, locale i18n.Locale) error {
+				return es.SendNewsletterConfirmationReminderEmail(ctx, model.Email(to), token, locale)
+			})
+		if err != nil {
+			return fmt.Errorf("error sending newsletter confirmation reminder email: %w", err)
+		}
+
+		reminders.WithLabelValues(strconv.FormatBool(reminded)).Inc()
+
+		return nil
+	})
+}
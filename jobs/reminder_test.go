@@ -0,0 +1,126 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"canvas/i18n"
+	"canvas/jobs"
+	"canvas/model"
+)
+
+type reminderStoreMock struct {
+	email    model.Email
+	reminded bool
+}
+
+func (s *reminderStoreMock) RemindUnconfirmedSubscriber(
+	ctx context.Context,
+	email model.Email,
+	remind func(ctx context.Context, token string, locale i18n.Locale) error,
+) (bool, error) {
+	s.email = email
+	if s.reminded {
+		return false, nil
+	}
+	if err := remind(ctx, "123", "de"); err != nil {
+		return false, err
+	}
+	s.reminded = true
+	return true, nil
+}
+
+type mockConfirmationReminderEmailer struct {
+	err    error
+	to     model.Email
+	token  string
+	locale i18n.Locale
+}
+
+func (m *mockConfirmationReminderEmailer) SendNewsletterConfirmationReminderEmail(
+	ctx context.Context,
+	to model.Email,
+	token string,
+	locale i18n.Locale,
+) error {
+	m.to = to
+	m.token = token
+	m.locale = locale
+	return m.err
+}
+
+func TestSendNewsletterConfirmationReminderEmail(t *testing.T) {
+	t.Run("sends one reminder with the subscriber's token and locale, and counts it", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		registry := prometheus.NewRegistry()
+		s := &reminderStoreMock{}
+		emailer := &mockConfirmationReminderEmailer{}
+		jobs.SendNewsletterConfirmationReminderEmail(r, s, emailer, registry)
+
+		job, ok := r["confirmation_reminder_email"]
+		is.True(ok)
+
+		err := job(context.Background(), model.Message{"email": "you@example.com"})
+		is.NoErr(err)
+
+		is.Equal(model.Email("you@example.com"), s.email)
+		is.Equal(model.Email("you@example.com"), emailer.to)
+		is.Equal("123", emailer.token)
+		is.Equal(i18n.Locale("de"), emailer.locale)
+
+		emailer.to = ""
+		err = job(context.Background(), model.Message{"email": "you@example.com"})
+		is.NoErr(err)
+		is.Equal(model.Email(""), emailer.to)
+
+		is.Equal(float64(1), getReminders(is, registry, "true"))
+		is.Equal(float64(1), getReminders(is, registry, "false"))
+	})
+
+	t.Run("errors on email sending failure, without marking the subscriber as reminded", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		s := &reminderStoreMock{}
+		jobs.SendNewsletterConfirmationReminderEmail(r, s, &mockConfirmationReminderEmailer{err: errors.New("wire is cut")}, nil)
+		job := r["confirmation_reminder_email"]
+
+		err := job(context.Background(), model.Message{"email": "you@example.com"})
+		is.True(err != nil)
+		is.True(!s.reminded)
+	})
+
+	t.Run("errors on no email address in the message", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		jobs.SendNewsletterConfirmationReminderEmail(r, &reminderStoreMock{}, &mockConfirmationReminderEmailer{}, nil)
+		job := r["confirmation_reminder_email"]
+
+		err := job(context.Background(), model.Message{})
+		is.True(err != nil)
+	})
+}
+
+// getReminders from the metrics registry, by whether they were sent.
+func getReminders(is *is.I, registry *prometheus.Registry, sent string) float64 {
+	metrics, err := registry.Gather()
+	is.NoErr(err)
+	for _, metric := range metrics {
+		if metric.GetName() != "app_confirmation_reminders_total" {
+			continue
+		}
+		for _, m := range metric.Metric {
+			if m.Label[0].GetValue() == sent {
+				return m.Counter.GetValue()
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"canvas/model"
+)
+
+// retentionScheduleKey of the scheduled message for the next retention run.
+const retentionScheduleKey = "retention"
+
+// RetentionPolicies for personal data, applied by the ApplyRetentionPolicies job. Zero disables a policy.
+type RetentionPolicies struct {
+	// DryRun counts and logs the rows the policies would affect, without changing anything.
+	DryRun bool
+	// Interval between runs. Defaults to one day.
+	Interval time.Duration
+	// UnconfirmedDays after which subscribers who never confirmed are deleted.
+	UnconfirmedDays int
+	// InactiveMonths after which deactivated subscribers are anonymized.
+	InactiveMonths int
+	// ConsentEventsMonths after which consent events of addresses without a subscriber are deleted.
+	ConsentEventsMonths int
+	// SequenceDeliveriesMonths after which sequence deliveries and their opens are deleted,
+	// for enrollments that are no longer active.
+	SequenceDeliveriesMonths int
+}
+
+type retentionStore interface {
+	DeleteUnconfirmedSubscribers(ctx context.Context, before time.Time, dryRun bool) (int, error)
+	AnonymizeInactiveSubscribers(ctx context.Context, before time.Time, dryRun bool) (int, error)
+	DeleteOrphanedConsentEvents(ctx context.Context, before time.Time, dryRun bool) (int, error)
+	DeleteSequenceDeliveries(ctx context.Context, before time.Time, dryRun bool) (int, error)
+	DeleteExpiredRateLimits(ctx context.Context, dryRun bool) (int, error)
+	ScheduleMessage(ctx context.Context, key string, m model.Message, at time.Time) error
+}
+
+// retentionPolicy is a named step of the retention job.
+type retentionPolicy struct {
+	name    string
+	enabled bool
+	apply   func(ctx context.Context, now time.Time, dryRun bool) (int, error)
+}
+
+// ApplyRetentionPolicies to the database, and schedule the next run after the policy interval.
+// The number of affected rows per policy is logged and counted in the app_retention_rows_total metric,
+// labelled with whether it was a dry run. Policies that fail don't stop the others.
+func ApplyRetentionPolicies(r registry, s retentionStore, p RetentionPolicies, metrics *prometheus.Registry) {
+	if metrics == nil {
+		metrics = prometheus.NewRegistry()
+	}
+	if p.Interval <= 0 {
+		p.Interval = 24 * time.Hour
+	}
+
+	rows := promauto.With(metrics).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_retention_rows_total",
+		Help: "The total number of rows deleted or anonymized by retention policies.",
+	}, []string{"policy", "dry_run"})
+
+	policies := []retentionPolicy{
+		{
+			name:    "unconfirmed_subscribers",
+			enabled: p.UnconfirmedDays > 0,
+			apply: func(ctx context.Context, now time.Time, dryRun bool) (int, error) {
+				return s.DeleteUnconfirmedSubscribers(ctx, now.AddDate(0, 0, -p.UnconfirmedDays), dryRun)
+			},
+		},
+		{
+			name:    "inactive_subscribers",
+			enabled: p.InactiveMonths > 0,
+			apply: func(ctx context.Context, now time.Time, dryRun bool) (int, error) {
+				return s.AnonymizeInactiveSubscribers(ctx, now.AddDate(0, -p.InactiveMonths, 0), dryRun)
+			},
+		},
+		{
+			name:    "consent_events",
+			enabled: p.ConsentEventsMonths > 0,
+			apply: func(ctx context.Context, now time.Time, dryRun bool) (int, error) {
+				return s.DeleteOrphanedConsentEvents(ctx, now.AddDate(0, -p.ConsentEventsMonths, 0), dryRun)
+			},
+		},
+		{
+			name:    "sequence_deliveries",
+			enabled: p.SequenceDeliveriesMonths > 0,
+			apply: func(ctx context.Context, now time.Time, dryRun bool) (int, error) {
+				return s.DeleteSequenceDeliveries(ctx, now.AddDate(0, -p.SequenceDeliveriesMonths, 0), dryRun)
+			},
+		},
+		{
+			name:    "rate_limits",
+			enabled: true,
+			apply: func(ctx context.Context, now time.Time, dryRun bool) (int, error) {
+				return s.DeleteExpiredRateLimits(ctx, dryRun)
+			},
+		},
+	}
+
+	r.Register(model.JobApplyRetentionPolicies, func(ctx context.Context, m model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		defer cancel()
+
+		// Schedule the next run first, so a failing run doesn't stop the schedule
+		now := time.Now()
+		if err := s.ScheduleMessage(ctx, retentionScheduleKey, model.Message{"job": model.JobApplyRetentionPolicies}, now.Add(p.Interval)); err != nil {
+			return fmt.Errorf("error scheduling next retention run: %w", err)
+		}
+
+		var errs []error
+		for _, policy := range policies {
+			if !policy.enabled {
+				continue
+			}
+			count, err := policy.apply(ctx, now, p.DryRun)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error applying retention policy %v: %w", policy.name, err))
+				continue
+			}
+			rows.WithLabelValues(policy.name, strconv.FormatBool(p.DryRun)).Add(float64(count))
+			slog.Info("Applied retention policy", slog.String("policy", policy.name), slog.Int("rows", count),
+				slog.Bool("dry_run", p.DryRun))
+		}
+		return errors.Join(errs...)
+	})
+}
+
+type messageScheduler interface {
+	ScheduleMessageIfAbsent(ctx context.Context, key string, m model.Message, at time.Time) (bool, error)
+}
+
+// ScheduleRetention runs now, unless a run is already scheduled. Call it on startup,
+// to start the schedule the retention job keeps after that.
+func ScheduleRetention(ctx context.Context, s messageScheduler) error {
+	_, err := s.ScheduleMessageIfAbsent(ctx, retentionScheduleKey, model.Message{"job": model.JobApplyRetentionPolicies}, time.Now())
+	return err
+}
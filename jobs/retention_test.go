@@ -0,0 +1,122 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"canvas/jobs"
+	"canvas/model"
+)
+
+type retentionStoreMock struct {
+	calls         []string
+	dryRun        bool
+	err           error
+	scheduled     model.Message
+	scheduledAt   time.Time
+	unconfirmedAt time.Time
+}
+
+func (s *retentionStoreMock) DeleteUnconfirmedSubscribers(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	s.calls = append(s.calls, "unconfirmed")
+	s.dryRun = dryRun
+	s.unconfirmedAt = before
+	return 3, s.err
+}
+
+func (s *retentionStoreMock) AnonymizeInactiveSubscribers(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	s.calls = append(s.calls, "inactive")
+	return 2, nil
+}
+
+func (s *retentionStoreMock) DeleteOrphanedConsentEvents(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	s.calls = append(s.calls, "consent_events")
+	return 1, nil
+}
+
+func (s *retentionStoreMock) DeleteSequenceDeliveries(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	s.calls = append(s.calls, "sequence_deliveries")
+	return 4, nil
+}
+
+func (s *retentionStoreMock) DeleteExpiredRateLimits(ctx context.Context, dryRun bool) (int, error) {
+	s.calls = append(s.calls, "rate_limits")
+	return 5, nil
+}
+
+func (s *retentionStoreMock) ScheduleMessage(ctx context.Context, key string, m model.Message, at time.Time) error {
+	s.scheduled = m
+	s.scheduledAt = at
+	return nil
+}
+
+func TestApplyRetentionPolicies(t *testing.T) {
+	t.Run("applies the enabled policies, counts the rows, and schedules the next run", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		s := &retentionStoreMock{}
+		registry := prometheus.NewRegistry()
+		jobs.ApplyRetentionPolicies(r, s, jobs.RetentionPolicies{DryRun: true, UnconfirmedDays: 30}, registry)
+
+		job, ok := r["apply_retention_policies"]
+		is.True(ok)
+
+		err := job(context.Background(), model.Message{"job": "apply_retention_policies"})
+		is.NoErr(err)
+
+		is.Equal([]string{"unconfirmed", "rate_limits"}, s.calls)
+		is.True(s.dryRun)
+		is.True(time.Until(s.unconfirmedAt) < -29*24*time.Hour)
+
+		is.Equal(model.Message{"job": "apply_retention_policies"}, s.scheduled)
+		is.True(time.Until(s.scheduledAt) > 23*time.Hour)
+
+		is.Equal(float64(3), getRetentionRows(is, registry, "unconfirmed_subscribers"))
+		is.Equal(float64(5), getRetentionRows(is, registry, "rate_limits"))
+		is.Equal(float64(0), getRetentionRows(is, registry, "inactive_subscribers"))
+	})
+
+	t.Run("applies the other policies if one fails, and returns the error", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		s := &retentionStoreMock{err: errors.New("oh no")}
+		jobs.ApplyRetentionPolicies(r, s, jobs.RetentionPolicies{
+			UnconfirmedDays:          30,
+			InactiveMonths:           24,
+			ConsentEventsMonths:      36,
+			SequenceDeliveriesMonths: 12,
+		}, nil)
+
+		err := r["apply_retention_policies"](context.Background(), model.Message{})
+		is.True(err != nil)
+		is.Equal([]string{"unconfirmed", "inactive", "consent_events", "sequence_deliveries", "rate_limits"}, s.calls)
+		is.True(s.scheduled != nil)
+	})
+}
+
+// getRetentionRows for the policy from the metrics registry, from dry runs and real ones.
+func getRetentionRows(is *is.I, registry *prometheus.Registry, policy string) float64 {
+	metrics, err := registry.Gather()
+	is.NoErr(err)
+	var rows float64
+	for _, metric := range metrics {
+		if metric.GetName() != "app_retention_rows_total" {
+			continue
+		}
+		for _, m := range metric.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "policy" && l.GetValue() == policy {
+					rows += m.Counter.GetValue()
+				}
+			}
+		}
+	}
+	return rows
+}
@@ -3,6 +3,7 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"strconv"
 	"sync"
@@ -10,32 +11,72 @@ import (
 
 	"canvas/messaging"
 	"canvas/model"
+	"canvas/storage"
 	"canvas/util"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+const (
+	// deleteInterval is the longest time a finished job waits before its message is deleted from the queue.
+	deleteInterval = time.Second
+
+	// maxDeleteBatchSize matches the largest batch the queue can delete in one request.
+	maxDeleteBatchSize = 10
+)
+
+// receiver of messages from a queue, such as messaging.Queue or messaging.MemoryQueue.
+type receiver interface {
+	ReceiveBatch(ctx context.Context) ([]messaging.ReceivedMessage, error)
+	ChangeVisibility(ctx context.Context, receiptID string, timeout time.Duration) error
+	DeleteBatch(ctx context.Context, receiptIDs []string) error
+}
+
 // Runner runs jobs.
 type Runner struct {
-	emailer        *messaging.Emailer
-	jobs           map[string]Func
-	queue          *messaging.Queue
-	jobCount       *prometheus.CounterVec
-	jobDurations   *prometheus.CounterVec
-	runnerReceives *prometheus.CounterVec
+	concurrency       int
+	database          *storage.Database
+	emailer           *messaging.Emailer
+	jobs              map[string]registeredJob
+	metrics           *prometheus.Registry
+	queue             receiver
+	reminderDelay     time.Duration
+	retention         RetentionPolicies
+	visibilityTimeout time.Duration
+	jobCount          *prometheus.CounterVec
+	jobDurations      *prometheus.CounterVec
+	runnerReceives    *prometheus.CounterVec
+	heartbeats        *prometheus.CounterVec
 }
 
 type NewRunnerOptions struct {
-	Emailer *messaging.Emailer
-	Metrics *prometheus.Registry
-	Queue   *messaging.Queue
+	// Concurrency is the number of jobs that can run at the same time. Defaults to 10.
+	Concurrency int
+	// Database for jobs that use it, like the retention job.
+	Database *storage.Database
+	Emailer  *messaging.Emailer
+	Metrics  *prometheus.Registry
+	Queue    receiver
+	// ReminderDelay after a confirmation email before a reminder is sent, if not confirmed by then.
+	// Zero disables reminders.
+	ReminderDelay time.Duration
+	// Retention policies applied by the retention job.
+	Retention RetentionPolicies
+	// VisibilityTimeout is the default for JobOptions.VisibilityTimeout. Defaults to one minute.
+	VisibilityTimeout time.Duration
 }
 
 func NewRunner(opts NewRunnerOptions) *Runner {
 	if opts.Metrics == nil {
 		opts.Metrics = prometheus.NewRegistry()
 	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 10
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = time.Minute
+	}
 	jobCount := promauto.With(opts.Metrics).NewCounterVec(prometheus.CounterOpts{
 		Name: "app_jobs_total",
 	}, []string{"name", "success"})
@@ -47,105 +88,402 @@ func NewRunner(opts NewRunnerOptions) *Runner {
 	runnerReceives := promauto.With(opts.Metrics).NewCounterVec(prometheus.CounterOpts{
 		Name: "app_job_runner_receives_total",
 	}, []string{"success"})
+
+	heartbeats := promauto.With(opts.Metrics).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_job_heartbeats_total",
+	}, []string{"name", "success"})
 	return &Runner{
-		emailer:        opts.Emailer,
-		jobs:           map[string]Func{},
-		queue:          opts.Queue,
-		jobCount:       jobCount,
-		jobDurations:   jobDurations,
-		runnerReceives: runnerReceives,
+		concurrency:       opts.Concurrency,
+		database:          opts.Database,
+		emailer:           opts.Emailer,
+		jobs:              map[string]registeredJob{},
+		metrics:           opts.Metrics,
+		queue:             opts.Queue,
+		reminderDelay:     opts.ReminderDelay,
+		retention:         opts.Retention,
+		visibilityTimeout: opts.VisibilityTimeout,
+		jobCount:          jobCount,
+		jobDurations:      jobDurations,
+		runnerReceives:    runnerReceives,
+		heartbeats:        heartbeats,
 	}
 }
 
 // Func is the actual work to do in a job.
-// The given context is the root context of the runner, which may be cancelled.
+// The given context is derived from the root context of the runner, and is cancelled if the runner stops
+// or if the job's message can no longer be kept hidden from other receivers.
 type Func = func(context.Context, model.Message) error
 
+// JobOptions for RegisterWithOptions.
+type JobOptions struct {
+	// VisibilityTimeout is how long the job's message is hidden from other receivers at a time.
+	// From when the message is received until the job is done, the timeout is extended right away and
+	// then every half timeout, so it only needs to cover the time between heartbeats.
+	// Defaults to NewRunnerOptions.VisibilityTimeout.
+	VisibilityTimeout time.Duration
+}
+
+// registeredJob is a job function and its options.
+type registeredJob struct {
+	fn   Func
+	opts JobOptions
+}
+
+// task is a received message together with the job to run for it.
+type task struct {
+	job       registeredJob
+	message   model.Message
+	name      string
+	receiptID string
+}
+
+// sequence of tasks that are run one after the other, in order. Messages in the same FIFO message group
+// are in one sequence, and all other messages are in a sequence of their own.
+// From when the messages are received until the sequence is done, a heartbeat keeps them hidden from
+// other receivers.
+type sequence struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	tasks  []task
+	// mutex guards next.
+	mutex sync.Mutex
+	// next is the index of the first task in tasks that hasn't finished.
+	next          int
+	stopHeartbeat chan struct{}
+	heartbeatDone chan struct{}
+}
+
+// finish the next task in the sequence, so its message is no longer extended by the heartbeat.
+func (s *sequence) finish() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.next++
+}
+
+// unfinished tasks in the sequence.
+func (s *sequence) unfinished() []task {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tasks[s.next:]
+}
+
+// stop the heartbeat of the sequence and cancel its context, waiting for the heartbeat to return.
+func (s *sequence) stop() {
+	close(s.stopHeartbeat)
+	<-s.heartbeatDone
+	s.cancel(nil)
+}
+
 // Start the Runner, blocking until the given context is cancelled.
+// Messages are received from the queue in batches and dispatched to a pool of workers.
+// Messages in the same FIFO message group are run one after the other, in order.
+// Messages of successful jobs are deleted from the queue in batches.
 func (r *Runner) Start(ctx context.Context) {
 	slog.Info("Starting")
 	r.registerJobs()
-	var wg sync.WaitGroup
+
+	sequences := make(chan *sequence)
+	finished := make(chan task, r.concurrency)
+
+	var workers sync.WaitGroup
+	for i := 0; i < r.concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for s := range sequences {
+				r.runSequence(s, finished)
+			}
+		}()
+	}
+
+	deleterDone := make(chan struct{})
+	go func() {
+		defer close(deleterDone)
+		r.deleteFinished(finished)
+	}()
 
 	for {
 		select {
 		case <-ctx.Done():
 			slog.Info("Stopping")
-			wg.Wait()
+			close(sequences)
+			workers.Wait()
+			close(finished)
+			<-deleterDone
 			return
 		default:
-			r.receiveAndRun(ctx, &wg)
+			r.receiveAndDispatch(ctx, sequences)
 		}
 	}
 }
 
-// receiveAndRun jobs.
-func (r *Runner) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
-	m, receiptID, err := r.queue.Receive(ctx)
+// receiveAndDispatch a batch of messages to the workers.
+// Each message is dispatched on its own, except messages with the same group ID, which are dispatched
+// together as a sequence. The messages of each sequence are extended and its heartbeat started before it's
+// dispatched, so the time waiting for a free worker is covered.
+func (r *Runner) receiveAndDispatch(ctx context.Context, sequences chan<- *sequence) {
+	ms, err := r.queue.ReceiveBatch(ctx)
 	if err != nil {
 		r.runnerReceives.WithLabelValues("false").Inc()
-		slog.Info("Error receiving message", util.ErrAttr(err))
+		slog.Info("Error receiving messages", util.ErrAttr(err))
 		// Sleep a bit to not hammer the queue if there's an error with it
 		time.Sleep(time.Second)
 		return
 	}
 
-	// If there was no message there is nothing to do
-	if m == nil {
+	// If there were no messages there is nothing to do
+	if len(ms) == 0 {
 		r.runnerReceives.WithLabelValues("true").Inc()
 		return
 	}
 
-	name, ok := (*m)["job"]
-	if !ok {
-		r.runnerReceives.WithLabelValues("false").Inc()
-		slog.Info("Error getting job name from message")
-		return
+	var batch [][]task
+	groups := map[string]int{}
+	brokenGroups := map[string]bool{}
+	for _, m := range ms {
+		if brokenGroups[m.GroupID] {
+			continue
+		}
+
+		name, ok := m.Message["job"]
+		if !ok {
+			r.runnerReceives.WithLabelValues("false").Inc()
+			slog.Info("Error getting job name from message")
+			if m.GroupID != "" {
+				brokenGroups[m.GroupID] = true
+			}
+			continue
+		}
+
+		job, ok := r.jobs[name]
+		if !ok {
+			r.runnerReceives.WithLabelValues("false").Inc()
+			slog.Info("No job with this name", slog.String("name", name))
+			if m.GroupID != "" {
+				brokenGroups[m.GroupID] = true
+			}
+			continue
+		}
+
+		r.runnerReceives.WithLabelValues("true").Inc()
+
+		t := task{job: job, message: m.Message, name: name, receiptID: m.ReceiptID}
+		if i, ok := groups[m.GroupID]; ok && m.GroupID != "" {
+			batch[i] = append(batch[i], t)
+			continue
+		}
+		groups[m.GroupID] = len(batch)
+		batch = append(batch, []task{t})
 	}
 
-	job, ok := r.jobs[name]
-	if !ok {
-		r.runnerReceives.WithLabelValues("false").Inc()
-		slog.Info("No job with this name", slog.String("name", name))
-		return
+	var ss []*sequence
+	for _, ts := range batch {
+		ss = append(ss, r.startSequence(ctx, ts))
 	}
 
-	r.runnerReceives.WithLabelValues("true").Inc()
-	wg.Add(1)
+	for i, s := range ss {
+		select {
+		case sequences <- s:
+		case <-ctx.Done():
+			// The rest of the batch is received again after the visibility timeout
+			for _, s := range ss[i:] {
+				s.stop()
+			}
+			return
+		}
+	}
+}
+
+// startSequence of the given tasks, with a context derived from ctx, extending the visibility timeouts of
+// their messages right away, and start its heartbeat.
+// If the timeouts cannot be extended, the sequence is cancelled with errLostMessage, and none of it is run.
+func (r *Runner) startSequence(ctx context.Context, ts []task) *sequence {
+	ctx, cancel := context.WithCancelCause(ctx)
+	s := &sequence{
+		ctx:           ctx,
+		cancel:        cancel,
+		tasks:         ts,
+		stopHeartbeat: make(chan struct{}),
+		heartbeatDone: make(chan struct{}),
+	}
+	if !r.extend(s) {
+		s.cancel(errLostMessage)
+		close(s.heartbeatDone)
+		return s
+	}
 	go func() {
-		defer wg.Done()
+		defer close(s.heartbeatDone)
+		r.heartbeat(s)
+	}()
+	return s
+}
 
-		log := slog.With(slog.String("name", name))
+// runSequence of tasks in order, passing each successful task to finished, and stop the sequence after.
+func (r *Runner) runSequence(s *sequence, finished chan<- task) {
+	defer s.stop()
 
-		defer func() {
-			if rec := recover(); rec != nil {
-				r.jobCount.WithLabelValues(name, "false").Inc()
-				log.Info("Recovered from panic in job", slog.Any("recover", rec))
-			}
-		}()
+	for _, t := range s.tasks {
+		// Don't start jobs whose messages may already have been received by another worker
+		if errors.Is(context.Cause(s.ctx), errLostMessage) {
+			return
+		}
+		// Stop the sequence on failure, so the rest of it is received again in order
+		if !r.run(s.ctx, t) {
+			return
+		}
+		s.finish()
+		finished <- t
+	}
+}
 
-		before := time.Now()
-		err := job(ctx, *m)
-		duration := time.Since(before)
+// errLostMessage is the cause of a job context being cancelled because its message could not be kept hidden.
+var errLostMessage = errors.New("message visibility could not be extended, another worker may be running the job")
 
-		success := strconv.FormatBool(err == nil)
-		r.jobCount.WithLabelValues(name, success).Inc()
-		r.jobDurations.WithLabelValues(name, success).Add(duration.Seconds())
+// run the job in the task, returning whether it succeeded.
+// The job context is cancelled with errLostMessage if the heartbeat of its sequence fails.
+func (r *Runner) run(ctx context.Context, t task) (success bool) {
+	log := slog.With(slog.String("name", t.name))
 
-		if err != nil {
-			log.Info("Error running job", util.ErrAttr(err))
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.jobCount.WithLabelValues(t.name, "false").Inc()
+			log.Info("Recovered from panic in job", slog.Any("recover", rec))
+			success = false
+		}
+	}()
+
+	before := time.Now()
+	err := t.job.fn(ctx, t.message)
+	duration := time.Since(before)
+
+	if err == nil && errors.Is(context.Cause(ctx), errLostMessage) {
+		err = errLostMessage
+	}
+
+	successLabel := strconv.FormatBool(err == nil)
+	r.jobCount.WithLabelValues(t.name, successLabel).Inc()
+	r.jobDurations.WithLabelValues(t.name, successLabel).Add(duration.Seconds())
+
+	if err != nil {
+		log.Info("Error running job", util.ErrAttr(err))
+		return false
+	}
+	log.Info("Successfully ran job", slog.Duration("duration", duration))
+	return true
+}
+
+// visibilityTimeout of the message of the given task, from its job options or the runner default.
+func (r *Runner) visibilityTimeoutOf(t task) time.Duration {
+	if t.job.opts.VisibilityTimeout > 0 {
+		return t.job.opts.VisibilityTimeout
+	}
+	return r.visibilityTimeout
+}
+
+// heartbeat extends the visibility timeouts of the messages of all unfinished tasks in the sequence
+// every half of the shortest timeout in the sequence, until the sequence is stopped.
+// Tasks waiting behind others in the sequence are included, so a long sequence isn't received again while it runs.
+// If a timeout cannot be extended, the sequence is cancelled with errLostMessage, because the message
+// may already have been received by another worker.
+func (r *Runner) heartbeat(s *sequence) {
+	interval := r.visibilityTimeoutOf(s.tasks[0])
+	for _, t := range s.tasks[1:] {
+		interval = min(interval, r.visibilityTimeoutOf(t))
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopHeartbeat:
 			return
+		case <-ticker.C:
 		}
-		log.Info("Successfully ran job", slog.Duration("duration", duration))
-
-		// We use context.Background as the parent context instead of the existing ctx, because if we've come
-		// this far we don't want the deletion to be cancelled.
-		deleteCtx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
-		if err := r.queue.Delete(deleteCtx, receiptID); err != nil {
-			log.Error("Error deleting message, job will be repeated", util.ErrAttr(err))
+
+		if !r.extend(s) {
+			s.cancel(errLostMessage)
+			return
 		}
-	}()
+	}
+}
+
+// extend the visibility timeouts of the messages of the unfinished tasks in the sequence,
+// returning whether all of them succeeded.
+func (r *Runner) extend(s *sequence) bool {
+	for _, t := range s.unfinished() {
+		timeout := r.visibilityTimeoutOf(t)
+		// Use a parent context that isn't cancelled when the runner stops, so the job can finish
+		ctx, cancel := context.WithTimeout(context.Background(), timeout/4)
+		err := r.queue.ChangeVisibility(ctx, t.receiptID, timeout)
+		cancel()
+
+		r.heartbeats.WithLabelValues(t.name, strconv.FormatBool(err == nil)).Inc()
+		if err != nil {
+			slog.Error("Error extending message visibility, cancelling sequence",
+				slog.String("name", t.name), util.ErrAttr(err))
+			return false
+		}
+	}
+	return true
+}
+
+// deleteFinished tasks from the queue in batches, until the finished channel is closed.
+// A batch is deleted when it is full, or when deleteInterval has passed since the last deletion.
+func (r *Runner) deleteFinished(finished <-chan task) {
+	ticker := time.NewTicker(deleteInterval)
+	defer ticker.Stop()
+
+	var ts []task
+	for {
+		select {
+		case t, ok := <-finished:
+			if !ok {
+				r.delete(ts)
+				return
+			}
+			ts = append(ts, t)
+			if len(ts) == maxDeleteBatchSize {
+				r.delete(ts)
+				ts = nil
+			}
+		case <-ticker.C:
+			r.delete(ts)
+			ts = nil
+		}
+	}
+}
+
+// delete the messages of the given tasks, logging each message that could not be deleted.
+func (r *Runner) delete(ts []task) {
+	if len(ts) == 0 {
+		return
+	}
+
+	receiptIDs := make([]string, len(ts))
+	for i, t := range ts {
+		receiptIDs[i] = t.receiptID
+	}
+
+	// We use context.Background as the parent context, because if we've come
+	// this far we don't want the deletion to be cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := r.queue.DeleteBatch(ctx, receiptIDs)
+	if err == nil {
+		return
+	}
+
+	var batchErr *messaging.BatchError
+	if !errors.As(err, &batchErr) {
+		slog.Error("Error deleting messages, jobs will be repeated", slog.Int("count", len(ts)), util.ErrAttr(err))
+		return
+	}
+	for _, f := range batchErr.Failures {
+		slog.Error("Error deleting message, job will be repeated",
+			slog.String("name", ts[f.Index].name), util.ErrAttr(f.Err))
+	}
 }
 
 // registry provides a way to Register jobs by name.
@@ -155,5 +493,10 @@ type registry interface {
 
 // Register implements registry.
 func (r *Runner) Register(name string, j Func) {
-	r.jobs[name] = j
+	r.RegisterWithOptions(name, j, JobOptions{})
+}
+
+// RegisterWithOptions is like Register, but with options for the job.
+func (r *Runner) RegisterWithOptions(name string, j Func, opts JobOptions) {
+	r.jobs[name] = registeredJob{fn: j, opts: opts}
 }
@@ -2,13 +2,17 @@ package jobs_test
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"canvas/integrationtest"
 	"canvas/jobs"
+	"canvas/messaging"
 	"canvas/model"
 )
 
@@ -18,13 +22,143 @@ func (r testRegistry) Register(name string, fn jobs.Func) {
 	r[name] = fn
 }
 
+// testQueue is implemented by all the queues the runner can receive jobs from.
+type testQueue interface {
+	Send(ctx context.Context, m model.Message) error
+	SendBatch(ctx context.Context, ms []model.Message) error
+	Receive(ctx context.Context) (*model.Message, string, error)
+	ReceiveBatch(ctx context.Context) ([]messaging.ReceivedMessage, error)
+	ChangeVisibility(ctx context.Context, receiptID string, timeout time.Duration) error
+	DeleteBatch(ctx context.Context, receiptIDs []string) error
+}
+
+// testQueueFactory creates queues for the runner tests.
+type testQueueFactory struct {
+	name        string
+	integration bool
+	create      func() (testQueue, func())
+	// createWithVisibilityTimeout creates a queue that hides received messages for the given timeout by default.
+	createWithVisibilityTimeout func(timeout time.Duration) (testQueue, func())
+}
+
+// queues the runner tests run against. Integration queues are skipped in short mode.
+var queues = []testQueueFactory{
+	{
+		name: "memory",
+		create: func() (testQueue, func()) {
+			return messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{}), func() {}
+		},
+		createWithVisibilityTimeout: func(timeout time.Duration) (testQueue, func()) {
+			return messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{VisibilityTimeout: timeout}), func() {}
+		},
+	},
+	{
+		name:        "sqs",
+		integration: true,
+		create: func() (testQueue, func()) {
+			return integrationtest.CreateQueue()
+		},
+		createWithVisibilityTimeout: func(timeout time.Duration) (testQueue, func()) {
+			return integrationtest.CreateQueueWithVisibilityTimeout(timeout)
+		},
+	},
+}
+
 func TestRunner_Start(t *testing.T) {
-	integrationtest.SkipIfShort(t)
+	for _, q := range queues {
+		t.Run(q.name, func(t *testing.T) {
+			if q.integration {
+				integrationtest.SkipIfShort(t)
+			}
+			testRunnerStart(t, q)
+		})
+	}
+
+	t.Run("runs jobs in the same FIFO message group in order", func(t *testing.T) {
+		integrationtest.SkipIfShort(t)
+
+		is := is.New(t)
+
+		queue, cleanup := integrationtest.CreateFIFOQueue()
+		defer cleanup()
+
+		runner := jobs.NewRunner(jobs.NewRunnerOptions{
+			Queue: queue,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var lock sync.Mutex
+		var order []string
+		runner.Register("test", func(ctx context.Context, m model.Message) error {
+			if m["i"] == "0" {
+				// Give the other jobs a chance to overtake this one, if they are not run in order
+				time.Sleep(100 * time.Millisecond)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			order = append(order, m["i"])
+			if len(order) == 3 {
+				cancel()
+			}
+			return nil
+		})
+
+		err := queue.SendBatch(context.Background(), []model.Message{
+			{"job": "test", "email": "me@example.com", "i": "0"},
+			{"job": "test", "email": "me@example.com", "i": "1"},
+			{"job": "test", "email": "me@example.com", "i": "2"},
+		})
+		is.NoErr(err)
+
+		runner.Start(ctx)
+
+		is.Equal([]string{"0", "1", "2"}, order)
+	})
+
+	t.Run("keeps jobs waiting in a FIFO message group hidden until they run", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := &groupReceiver{
+			ms: []messaging.ReceivedMessage{
+				{GroupID: "me@example.com", Message: model.Message{"job": "test", "i": "0"}, ReceiptID: "0"},
+				{GroupID: "me@example.com", Message: model.Message{"job": "test", "i": "1"}, ReceiptID: "1"},
+			},
+			extended: map[string]int{},
+		}
+
+		runner := jobs.NewRunner(jobs.NewRunnerOptions{
+			Queue:             queue,
+			VisibilityTimeout: 200 * time.Millisecond,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var waitingExtensions int
+		runner.Register("test", func(ctx context.Context, m model.Message) error {
+			if m["i"] == "0" {
+				time.Sleep(250 * time.Millisecond)
+				waitingExtensions = queue.extensions("1")
+				return nil
+			}
+			cancel()
+			return nil
+		})
+
+		runner.Start(ctx)
+
+		// On receipt, and after half the timeout
+		is.True(waitingExtensions >= 2)
+	})
+}
+
+func testRunnerStart(t *testing.T, q testQueueFactory) {
+	createQueue := q.create
 
 	t.Run("starts the runner and runs jobs until the context is cancelled", func(t *testing.T) {
 		is := is.New(t)
 
-		queue, cleanup := integrationtest.CreateQueue()
+		queue, cleanup := createQueue()
 		defer cleanup()
 
 		runner := jobs.NewRunner(jobs.NewRunnerOptions{
@@ -50,10 +184,92 @@ func TestRunner_Start(t *testing.T) {
 
 	})
 
+	t.Run("runs a batch of jobs on the workers and deletes their messages", func(t *testing.T) {
+		is := is.New(t)
+
+		queue, cleanup := createQueue()
+		defer cleanup()
+
+		runner := jobs.NewRunner(jobs.NewRunnerOptions{
+			Concurrency: 3,
+			Queue:       queue,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var lock sync.Mutex
+		seen := map[string]bool{}
+		runner.Register("test", func(ctx context.Context, m model.Message) error {
+			lock.Lock()
+			defer lock.Unlock()
+			seen[m["i"]] = true
+			if len(seen) == 12 {
+				cancel()
+			}
+			return nil
+		})
+
+		var ms []model.Message
+		for i := 0; i < 12; i++ {
+			ms = append(ms, model.Message{"job": "test", "i": strconv.Itoa(i)})
+		}
+		err := queue.SendBatch(context.Background(), ms)
+		is.NoErr(err)
+
+		runner.Start(ctx)
+
+		is.Equal(12, len(seen))
+
+		m, _, err := queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(nil, m)
+	})
+
+	t.Run("extends the message visibility from receipt until the job is done", func(t *testing.T) {
+		is := is.New(t)
+
+		// Without heartbeats, the message would be visible again after a second
+		queue, cleanup := q.createWithVisibilityTimeout(time.Second)
+		defer cleanup()
+
+		registry := prometheus.NewRegistry()
+
+		runner := jobs.NewRunner(jobs.NewRunnerOptions{
+			Metrics: registry,
+			Queue:   queue,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var received *model.Message
+		var receiveErr error
+		runner.RegisterWithOptions("test", func(ctx context.Context, m model.Message) error {
+			defer cancel()
+
+			time.Sleep(1500 * time.Millisecond)
+
+			received, _, receiveErr = queue.Receive(context.Background())
+
+			return ctx.Err()
+		}, jobs.JobOptions{VisibilityTimeout: 2 * time.Second})
+
+		err := queue.Send(context.Background(), model.Message{"job": "test"})
+		is.NoErr(err)
+
+		runner.Start(ctx)
+
+		// The message must still have been hidden from other receivers
+		is.NoErr(receiveErr)
+		is.Equal(nil, received)
+
+		// One heartbeat on receipt, and one after half the timeout
+		is.Equal(float64(2), getHeartbeats(is, registry, "true"))
+	})
+
 	t.Run("emits job metrics", func(t *testing.T) {
 		is := is.New(t)
 
-		queue, cleanup := integrationtest.CreateQueue()
+		queue, cleanup := createQueue()
 		defer cleanup()
 
 		registry := prometheus.NewRegistry()
@@ -77,7 +293,7 @@ func TestRunner_Start(t *testing.T) {
 
 		metrics, err := registry.Gather()
 		is.NoErr(err)
-		is.Equal(3, len(metrics))
+		is.Equal(4, len(metrics))
 
 		metric := metrics[0]
 		is.Equal("app_job_duration_seconds_total", metric.GetName())
@@ -88,12 +304,18 @@ func TestRunner_Start(t *testing.T) {
 		is.True(metric.Metric[0].Counter.GetValue() > 0)
 
 		metric = metrics[1]
+		is.Equal("app_job_heartbeats_total", metric.GetName())
+		is.Equal("test", metric.Metric[0].Label[0].GetValue())
+		is.Equal("true", metric.Metric[0].Label[1].GetValue())
+		is.Equal(float64(1), metric.Metric[0].Counter.GetValue())
+
+		metric = metrics[2]
 		is.Equal("app_job_runner_receives_total", metric.GetName())
 		is.Equal("success", metric.Metric[0].Label[0].GetName())
 		is.Equal("true", metric.Metric[0].Label[0].GetValue())
 		is.True(metric.Metric[0].Counter.GetValue() > 0)
 
-		metric = metrics[2]
+		metric = metrics[3]
 		is.Equal("app_jobs_total", metric.GetName())
 		is.Equal("name", metric.Metric[0].Label[0].GetName())
 		is.Equal("test", metric.Metric[0].Label[0].GetValue())
@@ -102,3 +324,70 @@ func TestRunner_Start(t *testing.T) {
 		is.Equal(float64(1), metric.Metric[0].Counter.GetValue())
 	})
 }
+
+// groupReceiver returns the given messages in one batch, in the same FIFO message group,
+// and records the receipt IDs of the messages whose visibility is changed.
+type groupReceiver struct {
+	lock     sync.Mutex
+	ms       []messaging.ReceivedMessage
+	extended map[string]int
+}
+
+func (r *groupReceiver) ReceiveBatch(ctx context.Context) ([]messaging.ReceivedMessage, error) {
+	r.lock.Lock()
+	ms := r.ms
+	r.ms = nil
+	r.lock.Unlock()
+
+	if len(ms) == 0 {
+		<-ctx.Done()
+	}
+	return ms, nil
+}
+
+func (r *groupReceiver) ChangeVisibility(ctx context.Context, receiptID string, timeout time.Duration) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.extended[receiptID]++
+	return nil
+}
+
+func (r *groupReceiver) DeleteBatch(ctx context.Context, receiptIDs []string) error {
+	return nil
+}
+
+func (r *groupReceiver) extensions(receiptID string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.extended[receiptID]
+}
+
+// getHeartbeats from the metrics registry, by whether they succeeded.
+func getHeartbeats(is *is.I, registry *prometheus.Registry, success string) float64 {
+	metrics, err := registry.Gather()
+	is.NoErr(err)
+	for _, metric := range metrics {
+		if metric.GetName() != "app_job_heartbeats_total" {
+			continue
+		}
+		for _, m := range metric.Metric {
+			if m.Label[1].GetValue() == success {
+				return m.Counter.GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestNames(t *testing.T) {
+	t.Run("lists the registered jobs, sorted", func(t *testing.T) {
+		is := is.New(t)
+		is.Equal([]string{
+			"advance_sequence_enrollment",
+			"apply_retention_policies",
+			"confirmation_email",
+			"confirmation_reminder_email",
+			"welcome_email",
+		}, jobs.Names())
+	})
+}
@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"canvas/model"
+	"canvas/storage"
+	"canvas/util"
+)
+
+// sender of messages to a queue, such as messaging.Queue or messaging.MemoryQueue.
+type sender interface {
+	Send(ctx context.Context, m model.Message) error
+}
+
+// Scheduler moves scheduled messages from the database to the queue when they are due.
+type Scheduler struct {
+	database *storage.Database
+	interval time.Duration
+	limit    int
+	queue    sender
+	moved    *prometheus.CounterVec
+}
+
+type NewSchedulerOptions struct {
+	Database *storage.Database
+	// Interval between checks for due messages. Defaults to 10 seconds.
+	Interval time.Duration
+	Metrics  *prometheus.Registry
+	Queue    sender
+}
+
+func NewScheduler(opts NewSchedulerOptions) *Scheduler {
+	if opts.Metrics == nil {
+		opts.Metrics = prometheus.NewRegistry()
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+
+	moved := promauto.With(opts.Metrics).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_scheduled_messages_total",
+	}, []string{"success"})
+
+	return &Scheduler{
+		database: opts.Database,
+		interval: opts.Interval,
+		limit:    100,
+		queue:    opts.Queue,
+		moved:    moved,
+	}
+}
+
+// Start the Scheduler, blocking until the given context is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	slog.Info("Starting scheduler")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping scheduler")
+			return
+		case <-ticker.C:
+			s.moveDue(ctx)
+		}
+	}
+}
+
+// moveDue messages to the queue, as long as there are full pages of them.
+func (s *Scheduler) moveDue(ctx context.Context) {
+	for {
+		sent, err := s.database.SendDueScheduledMessages(ctx, s.limit, s.queue.Send)
+		s.moved.WithLabelValues("true").Add(float64(sent))
+		if err != nil {
+			s.moved.WithLabelValues("false").Inc()
+			slog.Info("Error sending scheduled messages", util.ErrAttr(err))
+			return
+		}
+		if sent > 0 {
+			slog.Info("Sent scheduled messages", slog.Int("count", sent))
+		}
+		if sent < s.limit {
+			return
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"canvas/model"
+)
+
+type sequenceEmailSender interface {
+	SendSequenceEmail(ctx context.Context, d model.SequenceDelivery) error
+}
+
+type sequenceStore interface {
+	AdvanceSequenceEnrollment(
+		ctx context.Context,
+		id int64,
+		position int,
+		send func(ctx context.Context, delivery model.SequenceDelivery) error,
+	) (model.SequenceAdvance, error)
+}
+
+// AdvanceSequenceEnrollment to its next step, sending it unless its condition isn't met.
+// The messages are scheduled by the store, when subscribers enter a sequence and after each step.
+// What happened is counted in the app_sequence_steps_total metric, labelled with the result.
+func AdvanceSequenceEnrollment(r registry, s sequenceStore, es sequenceEmailSender, metrics *prometheus.Registry) {
+	if metrics == nil {
+		metrics = prometheus.NewRegistry()
+	}
+
+	steps := promauto.With(metrics).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_sequence_steps_total",
+		Help: "The total number of sequence enrollments advanced, by whether a step was sent or skipped, " +
+			"or the enrollment completed or stopped.",
+	}, []string{"result"})
+
+	r.Register(model.JobAdvanceSequenceEnrollment, func(ctx context.Context, m model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		id, err := strconv.ParseInt(m["enrollment_id"], 10, 64)
+		if err != nil {
+			return errors.New("no valid enrollment ID in message")
+		}
+
+		position, err := strconv.Atoi(m["position"])
+		if err != nil {
+			return errors.New("no valid position in message")
+		}
+
+		advance, err := s.AdvanceSequenceEnrollment(ctx, id, position, es.SendSequenceEmail)
+		if err != nil {
+			return fmt.Errorf("error advancing sequence enrollment: %w", err)
+		}
+		steps.WithLabelValues(string(advance)).Inc()
+
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"canvas/jobs"
+	"canvas/model"
+)
+
+type sequenceStoreMock struct {
+	advance  model.SequenceAdvance
+	err      error
+	id       int64
+	position int
+}
+
+func (s *sequenceStoreMock) AdvanceSequenceEnrollment(
+	ctx context.Context,
+	id int64,
+	position int,
+	send func(ctx context.Context, delivery model.SequenceDelivery) error,
+) (model.SequenceAdvance, error) {
+	s.id = id
+	s.position = position
+	if s.err != nil {
+		return model.SequenceAdvanceNone, s.err
+	}
+	if s.advance == model.SequenceAdvanceSent {
+		if err := send(ctx, model.SequenceDelivery{Email: "you@example.com", Token: "abc"}); err != nil {
+			return model.SequenceAdvanceNone, err
+		}
+	}
+	return s.advance, nil
+}
+
+type mockSequenceEmailer struct {
+	delivery model.SequenceDelivery
+	err      error
+}
+
+func (m *mockSequenceEmailer) SendSequenceEmail(ctx context.Context, d model.SequenceDelivery) error {
+	m.delivery = d
+	return m.err
+}
+
+func TestAdvanceSequenceEnrollment(t *testing.T) {
+	t.Run("advances the enrollment at the position, sends the delivery, and counts the result", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		registry := prometheus.NewRegistry()
+		s := &sequenceStoreMock{advance: model.SequenceAdvanceSent}
+		emailer := &mockSequenceEmailer{}
+		jobs.AdvanceSequenceEnrollment(r, s, emailer, registry)
+
+		job, ok := r["advance_sequence_enrollment"]
+		is.True(ok)
+
+		err := job(context.Background(), model.Message{"enrollment_id": "12", "position": "3"})
+		is.NoErr(err)
+
+		is.Equal(int64(12), s.id)
+		is.Equal(3, s.position)
+		is.Equal("abc", emailer.delivery.Token)
+		is.Equal(float64(1), getSequenceSteps(is, registry, "sent"))
+
+		s.advance = model.SequenceAdvanceCompleted
+		err = job(context.Background(), model.Message{"enrollment_id": "12", "position": "4"})
+		is.NoErr(err)
+		is.Equal(float64(1), getSequenceSteps(is, registry, "completed"))
+	})
+
+	t.Run("errors on email sending failure", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		s := &sequenceStoreMock{advance: model.SequenceAdvanceSent}
+		jobs.AdvanceSequenceEnrollment(r, s, &mockSequenceEmailer{err: errors.New("wire is cut")}, nil)
+		job := r["advance_sequence_enrollment"]
+
+		err := job(context.Background(), model.Message{"enrollment_id": "12", "position": "0"})
+		is.True(err != nil)
+	})
+
+	t.Run("errors on invalid messages", func(t *testing.T) {
+		is := is.New(t)
+
+		r := testRegistry{}
+		jobs.AdvanceSequenceEnrollment(r, &sequenceStoreMock{}, &mockSequenceEmailer{}, nil)
+		job := r["advance_sequence_enrollment"]
+
+		err := job(context.Background(), model.Message{"position": "0"})
+		is.True(err != nil)
+
+		err = job(context.Background(), model.Message{"enrollment_id": "12"})
+		is.True(err != nil)
+	})
+}
+
+// getSequenceSteps from the metrics registry, by result.
+func getSequenceSteps(is *is.I, registry *prometheus.Registry, result string) float64 {
+	metrics, err := registry.Gather()
+	is.NoErr(err)
+	for _, metric := range metrics {
+		if metric.GetName() != "app_sequence_steps_total" {
+			continue
+		}
+		for _, m := range metric.Metric {
+			if m.Label[0].GetValue() == result {
+				return m.Counter.GetValue()
+			}
+		}
+	}
+	return 0
+}
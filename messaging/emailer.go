@@ -6,13 +6,16 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
+	"canvas/i18n"
 	"canvas/model"
 )
 
@@ -24,6 +27,12 @@ const (
 // nameAndEmail combo, of the form "Name <email@example.com>"
 type nameAndEmail = string
 
+// translationMatcher for placeholders in emails like {{t:email.welcome.heading}}, replaced by the translated message.
+var translationMatcher = regexp.MustCompile(`\{\{t:([\w.]+)\}\}`)
+
+// paragraphSeparator in plain text email bodies, a blank line.
+var paragraphSeparator = regexp.MustCompile(`\n\s*\n`)
+
 //go:embed emails
 var emails embed.FS
 
@@ -33,14 +42,17 @@ type Emailer struct {
 	baseURL           *url.URL
 	client            *http.Client
 	marketingFrom     nameAndEmail
+	recorder          *EmailRecorder
 	token             string
 	transactionalFrom nameAndEmail
 }
 
 type NewEmailerOptions struct {
-	BaseURL                   *url.URL
-	MarketingEmailAddress     string
-	MarketingEmailName        string
+	BaseURL               *url.URL
+	MarketingEmailAddress string
+	MarketingEmailName    string
+	// Recorder, if set, records emails instead of sending them through Postmark.
+	Recorder                  *EmailRecorder
 	Token                     string
 	TransactionalEmailAddress string
 	TransactionalEmailName    string
@@ -51,6 +63,7 @@ func NewEmailer(opts NewEmailerOptions) *Emailer {
 		baseURL:       opts.BaseURL,
 		client:        &http.Client{Timeout: 3 * time.Second},
 		marketingFrom: createNameAndEmail(opts.MarketingEmailName, opts.MarketingEmailAddress),
+		recorder:      opts.Recorder,
 		token:         opts.Token,
 		transactionalFrom: createNameAndEmail(
 			opts.TransactionalEmailName,
@@ -59,50 +72,119 @@ func NewEmailer(opts NewEmailerOptions) *Emailer {
 	}
 }
 
-// SendNewsletterConfirmationEmail with a confirmation link.
+// SendNewsletterConfirmationEmail with a confirmation link, in the given locale.
 // This is a transactional email, because it's a response to a user action.
 func (e *Emailer) SendNewsletterConfirmationEmail(
 	ctx context.Context,
 	to model.Email,
 	token string,
+	locale i18n.Locale,
+) error {
+	keywords := e.confirmationKeywords(token, locale)
+
+	return e.send(ctx, RenderedEmail{
+		MessageStream: transactionalMessageStream,
+		From:          e.transactionalFrom,
+		To:            to.String(),
+		Subject:       locale.T("email.confirmation.subject"),
+		HtmlBody:      getEmail("confirmation_email.html", locale, keywords),
+		TextBody:      getEmail("confirmation_email.txt", locale, keywords),
+	})
+}
+
+// SendNewsletterConfirmationReminderEmail with the same confirmation link as the confirmation email,
+// in the given locale. Like the confirmation email, this is a transactional email.
+func (e *Emailer) SendNewsletterConfirmationReminderEmail(
+	ctx context.Context,
+	to model.Email,
+	token string,
+	locale i18n.Locale,
 ) error {
+	keywords := e.confirmationKeywords(token, locale)
+
+	return e.send(ctx, RenderedEmail{
+		MessageStream: transactionalMessageStream,
+		From:          e.transactionalFrom,
+		To:            to.String(),
+		Subject:       locale.T("email.confirmation_reminder.subject"),
+		HtmlBody:      getEmail("confirmation_reminder_email.html", locale, keywords),
+		TextBody:      getEmail("confirmation_reminder_email.txt", locale, keywords),
+	})
+}
+
+// confirmationKeywords for the confirmation emails, with the confirmation link for the token as the action URL.
+func (e *Emailer) confirmationKeywords(token string, locale i18n.Locale) map[string]string {
 	actionUrl := e.baseURL
 	actionUrl = actionUrl.JoinPath("/newsletter/confirm")
 	actionUrl.RawQuery = fmt.Sprintf("token=%s", token)
-	keywords := map[string]string{
+	return map[string]string{
 		"base_url":   e.baseURL.String(),
 		"action_url": actionUrl.String(),
+		"locale":     string(locale),
 	}
+}
 
-	return e.send(ctx, requestBody{
-		MessageStream: transactionalMessageStream,
-		From:          e.transactionalFrom,
+// SendNewsletterWelcomeEmail with just the web app URL, in the given locale.
+func (e *Emailer) SendNewsletterWelcomeEmail(ctx context.Context, to model.Email, locale i18n.Locale) error {
+	keywords := map[string]string{
+		"base_url": e.baseURL.String(),
+		"locale":   string(locale),
+	}
+
+	return e.send(ctx, RenderedEmail{
+		MessageStream: marketingMessageStream,
+		From:          e.marketingFrom,
 		To:            to.String(),
-		Subject:       "Confirm your subscription to the Canvas newsletter",
-		HtmlBody:      getEmail("confirmation_email.html", keywords),
-		TextBody:      getEmail("confirmation_email.txt", keywords),
+		Subject:       locale.T("email.welcome.subject"),
+		HtmlBody:      getEmail("welcome_email.html", locale, keywords),
+		TextBody:      getEmail("welcome_email.txt", locale, keywords),
 	})
 }
 
-// SendNewsletterWelcomeEmail with just the web app URL.
-func (e *Emailer) SendNewsletterWelcomeEmail(ctx context.Context, to model.Email) error {
+// SendSequenceEmail with the subject and body of the sequence step, and an image for tracking opens.
+// This is a marketing email, like the welcome email.
+func (e *Emailer) SendSequenceEmail(ctx context.Context, d model.SequenceDelivery) error {
+	openURL := e.baseURL.JoinPath("/newsletter/open")
+	openURL.RawQuery = url.Values{"token": {d.Token}}.Encode()
 	keywords := map[string]string{
-		"base_url": e.baseURL.String(),
+		"base_url":  e.baseURL.String(),
+		"locale":    string(d.Locale),
+		"open_url":  openURL.String(),
+		"preheader": html.EscapeString(d.Step.Subject),
+	}
+
+	htmlKeywords := map[string]string{"body": htmlParagraphs(d.Step.Body)}
+	textKeywords := map[string]string{"body": d.Step.Body}
+	for k, v := range keywords {
+		htmlKeywords[k] = v
+		textKeywords[k] = v
 	}
 
-	return e.send(ctx, requestBody{
+	return e.send(ctx, RenderedEmail{
 		MessageStream: marketingMessageStream,
 		From:          e.marketingFrom,
-		To:            to.String(),
-		Subject:       "Welcome to the Canvas newsletter",
-		HtmlBody:      getEmail("welcome_email.html", keywords),
-		TextBody:      getEmail("welcome_email.txt", keywords),
+		To:            d.Email.String(),
+		Subject:       d.Step.Subject,
+		HtmlBody:      getEmail("sequence_email.html", d.Locale, htmlKeywords),
+		TextBody:      getEmail("sequence_email.txt", d.Locale, textKeywords),
 	})
 }
 
-// requestBody used in Emailer.send.
+// htmlParagraphs from plain text with paragraphs separated by blank lines, escaped,
+// and with the remaining line breaks kept.
+func htmlParagraphs(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n")
+	var paragraphs []string
+	for _, p := range paragraphSeparator.Split(text, -1) {
+		p = html.EscapeString(strings.TrimSpace(p))
+		paragraphs = append(paragraphs, "<p>"+strings.ReplaceAll(p, "\n", "<br>")+"</p>")
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+// RenderedEmail ready for sending, which is also the request body for Postmark.
 // See https://postmarkapp.com/developer/user-guide/send-email-with-api
-type requestBody struct {
+type RenderedEmail struct {
 	MessageStream string
 	From          nameAndEmail
 	To            nameAndEmail
@@ -111,8 +193,13 @@ type requestBody struct {
 	TextBody      string
 }
 
-// send using the Postmark API.
-func (e *Emailer) send(ctx context.Context, body requestBody) error {
+// send using the Postmark API, or to the recorder if there is one.
+func (e *Emailer) send(ctx context.Context, body RenderedEmail) error {
+	if e.recorder != nil {
+		e.recorder.record(body)
+		return nil
+	}
+
 	bodyAsBytes, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("error marshalling request body to json: %w", err)
@@ -158,17 +245,26 @@ func createNameAndEmail(name, email string) nameAndEmail {
 }
 
 // getEmail from the given path, panicking on errors.
-// It also replaces keywords given in the map.
-func getEmail(path string, keywords map[string]string) string {
+// It replaces translation placeholders with messages in the locale, escaped in HTML emails,
+// and also replaces keywords given in the map.
+func getEmail(path string, locale i18n.Locale, keywords map[string]string) string {
 	email, err := emails.ReadFile("emails/" + path)
 	if err != nil {
 		panic(err)
 	}
 
-	emailString := string(email)
+	emailString := translationMatcher.ReplaceAllStringFunc(string(email), func(placeholder string) string {
+		message := locale.T(translationMatcher.FindStringSubmatch(placeholder)[1])
+		if strings.HasSuffix(path, ".html") {
+			return html.EscapeString(message)
+		}
+		return message
+	})
+	// Replace in a single pass, so keywords in replacements, like in a sequence step body, are left as they are
+	var oldnew []string
 	for keyword, replacement := range keywords {
-		emailString = strings.ReplaceAll(emailString, "{{"+keyword+"}}", replacement)
+		oldnew = append(oldnew, "{{"+keyword+"}}", replacement)
 	}
 
-	return emailString
+	return strings.NewReplacer(oldnew...).Replace(emailString)
 }
@@ -0,0 +1,145 @@
+package messaging_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/i18n"
+	"canvas/messaging"
+	"canvas/model"
+)
+
+func TestEmailer_SendNewsletterConfirmationEmail(t *testing.T) {
+	t.Run("renders the confirmation email with the action link and records it", func(t *testing.T) {
+		is := is.New(t)
+
+		recorder := messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{})
+		emailer := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:                   &url.URL{Scheme: "https", Host: "example.com"},
+			Recorder:                  recorder,
+			TransactionalEmailAddress: "bot@example.com",
+			TransactionalEmailName:    "Canvas bot",
+		})
+
+		err := emailer.SendNewsletterConfirmationEmail(context.Background(), "me@example.com", "123", i18n.Default)
+		is.NoErr(err)
+
+		emails := recorder.Emails()
+		is.Equal(1, len(emails))
+		is.Equal("Canvas bot <bot@example.com>", emails[0].From)
+		is.Equal("me@example.com", emails[0].To)
+		is.True(strings.Contains(emails[0].HtmlBody, "https://example.com/newsletter/confirm?token=123"))
+		is.True(strings.Contains(emails[0].TextBody, "https://example.com/newsletter/confirm?token=123"))
+	})
+}
+
+func TestEmailer_SendNewsletterConfirmationReminderEmail(t *testing.T) {
+	t.Run("renders the reminder email in the locale with the action link and records it", func(t *testing.T) {
+		is := is.New(t)
+
+		recorder := messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{})
+		emailer := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:                   &url.URL{Scheme: "https", Host: "example.com"},
+			Recorder:                  recorder,
+			TransactionalEmailAddress: "bot@example.com",
+			TransactionalEmailName:    "Canvas bot",
+		})
+
+		err := emailer.SendNewsletterConfirmationReminderEmail(context.Background(), "me@example.com", "123", "da")
+		is.NoErr(err)
+
+		emails := recorder.Emails()
+		is.Equal(1, len(emails))
+		is.Equal("Canvas bot <bot@example.com>", emails[0].From)
+		is.Equal("me@example.com", emails[0].To)
+		is.Equal("Påmindelse: Bekræft din tilmelding til Canvas-nyhedsbrevet", emails[0].Subject)
+		is.True(strings.Contains(emails[0].HtmlBody, "Stadig interesseret?"))
+		is.True(strings.Contains(emails[0].HtmlBody, "https://example.com/newsletter/confirm?token=123"))
+		is.True(strings.Contains(emails[0].TextBody, "https://example.com/newsletter/confirm?token=123"))
+	})
+}
+
+func TestEmailer_SendNewsletterWelcomeEmail(t *testing.T) {
+	t.Run("renders the welcome email in the locale and records it", func(t *testing.T) {
+		is := is.New(t)
+
+		recorder := messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{})
+		emailer := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:               &url.URL{Scheme: "https", Host: "example.com"},
+			MarketingEmailAddress: "newsletter@example.com",
+			MarketingEmailName:    "Canvas newsletter",
+			Recorder:              recorder,
+		})
+
+		err := emailer.SendNewsletterWelcomeEmail(context.Background(), "me@example.com", "da")
+		is.NoErr(err)
+
+		emails := recorder.Emails()
+		is.Equal(1, len(emails))
+		is.Equal("Velkommen til Canvas-nyhedsbrevet", emails[0].Subject)
+		is.True(strings.Contains(emails[0].HtmlBody, `lang="da"`))
+		is.True(strings.Contains(emails[0].HtmlBody, "<h1>Velkommen!</h1>"))
+		is.True(strings.Contains(emails[0].TextBody, "Du kan altid besøge os på https://example.com"))
+		is.True(!strings.Contains(emails[0].HtmlBody, "{{"))
+	})
+}
+
+func TestEmailer_SendSequenceEmail(t *testing.T) {
+	t.Run("renders the step with escaped paragraphs and an open tracking image, and records it", func(t *testing.T) {
+		is := is.New(t)
+
+		recorder := messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{})
+		emailer := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:               &url.URL{Scheme: "https", Host: "example.com"},
+			MarketingEmailAddress: "news@example.com",
+			MarketingEmailName:    "Canvas",
+			Recorder:              recorder,
+		})
+
+		err := emailer.SendSequenceEmail(context.Background(), model.SequenceDelivery{
+			Email:  "me@example.com",
+			Locale: "en",
+			Step: model.SequenceStep{
+				Subject: "Tips & tricks",
+				Body:    "Hi!\n\nHere are <three> tips.\nEnjoy.",
+			},
+			Token: "abc",
+		})
+		is.NoErr(err)
+
+		emails := recorder.Emails()
+		is.Equal(1, len(emails))
+		is.Equal("Canvas <news@example.com>", emails[0].From)
+		is.Equal("me@example.com", emails[0].To)
+		is.Equal("Tips & tricks", emails[0].Subject)
+		is.True(strings.Contains(emails[0].HtmlBody, "<p>Hi!</p>\n<p>Here are &lt;three&gt; tips.<br>Enjoy.</p>"))
+		is.True(strings.Contains(emails[0].HtmlBody, `<img src="https://example.com/newsletter/open?token=abc"`))
+		is.True(strings.Contains(emails[0].TextBody, "Hi!\n\nHere are <three> tips.\nEnjoy."))
+	})
+
+	t.Run("leaves keywords in the step body as they are", func(t *testing.T) {
+		is := is.New(t)
+
+		recorder := messaging.NewEmailRecorder(messaging.NewEmailRecorderOptions{})
+		emailer := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:  &url.URL{Scheme: "https", Host: "example.com"},
+			Recorder: recorder,
+		})
+
+		err := emailer.SendSequenceEmail(context.Background(), model.SequenceDelivery{
+			Email:  "me@example.com",
+			Locale: "en",
+			Step:   model.SequenceStep{Subject: "Hi", Body: "{{open_url}} {{locale}} {{base_url}} {{body}}"},
+			Token:  "abc",
+		})
+		is.NoErr(err)
+
+		emails := recorder.Emails()
+		is.True(strings.Contains(emails[0].HtmlBody, "<p>{{open_url}} {{locale}} {{base_url}} {{body}}</p>"))
+		is.True(strings.Contains(emails[0].TextBody, "{{open_url}} {{locale}} {{base_url}} {{body}}"))
+	})
+}
@@ -0,0 +1,54 @@
+package messaging
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// EmailRecorder records rendered emails instead of sending them, for tests and local development.
+// It is safe for concurrent use.
+type EmailRecorder struct {
+	emails []RenderedEmail
+	log    bool
+	mutex  sync.Mutex
+}
+
+type NewEmailRecorderOptions struct {
+	// Log each recorded email, so the links in them can be followed during local development.
+	// Tokens in the links are redacted from logs, unless the "text" key is allowed with LOG_ALLOW_KEYS.
+	Log bool
+}
+
+func NewEmailRecorder(opts NewEmailRecorderOptions) *EmailRecorder {
+	return &EmailRecorder{log: opts.Log}
+}
+
+// Emails recorded so far, oldest first.
+func (r *EmailRecorder) Emails() []RenderedEmail {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	emails := make([]RenderedEmail, len(r.emails))
+	copy(emails, r.emails)
+	return emails
+}
+
+// Reset the recorder by forgetting all recorded emails.
+func (r *EmailRecorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.emails = nil
+}
+
+func (r *EmailRecorder) record(e RenderedEmail) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.emails = append(r.emails, e)
+
+	if r.log {
+		slog.Info("Recorded email", slog.String("to", e.To), slog.String("subject", e.Subject),
+			slog.String("text", e.TextBody))
+	}
+}
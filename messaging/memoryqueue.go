@@ -0,0 +1,261 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+
+	"canvas/model"
+)
+
+// ErrReceiptNotFound is returned from MemoryQueue when a receipt ID doesn't match an in-flight message,
+// for example because the message has been received again since.
+var ErrReceiptNotFound = errors.New("receipt ID not found")
+
+// MemoryQueue is an in-memory queue with the semantics of Queue on a standard SQS queue:
+// messages can be delayed, received messages are hidden for a visibility timeout and can be received again
+// if they aren't deleted in time, and every receive gives a new receipt ID.
+// It is safe for concurrent use, but messages are lost when the process stops.
+type MemoryQueue struct {
+	maxMessages       int
+	messages          []*memoryMessage
+	mutex             sync.Mutex
+	nextReceiptID     int
+	sent              chan struct{}
+	visibilityTimeout time.Duration
+	waitTime          time.Duration
+}
+
+// memoryMessage is a message in the MemoryQueue.
+type memoryMessage struct {
+	message      model.Message
+	receiptID    string
+	receiveCount int
+	visibleAt    time.Time
+}
+
+type NewMemoryQueueOptions struct {
+	// MaxMessages returned by ReceiveBatch, between 1 and 10. Defaults to 10.
+	MaxMessages int
+	// VisibilityTimeout of received messages. Defaults to 30 seconds, like on SQS.
+	VisibilityTimeout time.Duration
+	// WaitTime for messages to arrive when receiving from an empty queue.
+	WaitTime time.Duration
+}
+
+func NewMemoryQueue(opts NewMemoryQueueOptions) *MemoryQueue {
+	if opts.MaxMessages <= 0 || opts.MaxMessages > maxBatchSize {
+		opts.MaxMessages = maxBatchSize
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	return &MemoryQueue{
+		maxMessages:       opts.MaxMessages,
+		sent:              make(chan struct{}),
+		visibilityTimeout: opts.VisibilityTimeout,
+		waitTime:          opts.WaitTime,
+	}
+}
+
+// Send a message to the queue.
+func (q *MemoryQueue) Send(ctx context.Context, m model.Message) error {
+	return q.SendWithOptions(ctx, m, SendOptions{})
+}
+
+// SendWithOptions sends a message to the queue, like Send.
+func (q *MemoryQueue) SendWithOptions(ctx context.Context, m model.Message, opts SendOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.messages = append(q.messages, &memoryMessage{
+		message:   maps.Clone(m),
+		visibleAt: time.Now().Add(opts.Delay),
+	})
+	q.notify()
+	return nil
+}
+
+// SendBatch of messages to the queue. It never fails.
+func (q *MemoryQueue) SendBatch(ctx context.Context, ms []model.Message) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	for _, m := range ms {
+		q.messages = append(q.messages, &memoryMessage{message: maps.Clone(m), visibleAt: now})
+	}
+	q.notify()
+	return nil
+}
+
+// Receive a message and its receipt ID from the queue. Returns nil if no message is available.
+func (q *MemoryQueue) Receive(ctx context.Context) (*model.Message, string, error) {
+	ms, err := q.receive(ctx, 1)
+	if err != nil || len(ms) == 0 {
+		return nil, "", err
+	}
+	return &ms[0].Message, ms[0].ReceiptID, nil
+}
+
+// ReceiveBatch of up to NewMemoryQueueOptions.MaxMessages messages from the queue.
+// Returns an empty slice if no messages are available.
+func (q *MemoryQueue) ReceiveBatch(ctx context.Context) ([]ReceivedMessage, error) {
+	return q.receive(ctx, q.maxMessages)
+}
+
+// receive up to maxMessages, waiting up to the wait time for at least one to become visible.
+func (q *MemoryQueue) receive(ctx context.Context, maxMessages int) ([]ReceivedMessage, error) {
+	deadline := time.Now().Add(q.waitTime)
+
+	for {
+		q.mutex.Lock()
+		now := time.Now()
+		ms := q.takeVisible(now, maxMessages)
+		if len(ms) > 0 || !now.Before(deadline) {
+			q.mutex.Unlock()
+			return ms, nil
+		}
+
+		// Wait until a message is sent, the next message becomes visible, or the wait time is over
+		sent := q.sent
+		wakeAt := deadline
+		for _, m := range q.messages {
+			if m.visibleAt.Before(wakeAt) {
+				wakeAt = m.visibleAt
+			}
+		}
+		q.mutex.Unlock()
+
+		timer := time.NewTimer(wakeAt.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil
+		case <-sent:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// takeVisible messages up to max, hiding them for the visibility timeout. Must be called with the lock held.
+func (q *MemoryQueue) takeVisible(now time.Time, max int) []ReceivedMessage {
+	var ms []ReceivedMessage
+	for _, m := range q.messages {
+		if len(ms) == max {
+			break
+		}
+		if m.visibleAt.After(now) {
+			continue
+		}
+
+		q.nextReceiptID++
+		m.receiptID = strconv.Itoa(q.nextReceiptID)
+		m.receiveCount++
+		m.visibleAt = now.Add(q.visibilityTimeout)
+
+		ms = append(ms, ReceivedMessage{
+			Message:      maps.Clone(m.message),
+			ReceiptID:    m.receiptID,
+			ReceiveCount: m.receiveCount,
+		})
+	}
+	return ms
+}
+
+// ChangeVisibility of a received message by receipt ID, hiding it from other receivers for the given timeout,
+// counting from now.
+func (q *MemoryQueue) ChangeVisibility(ctx context.Context, receiptID string, timeout time.Duration) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	i := q.find(receiptID)
+	if i < 0 {
+		return ErrReceiptNotFound
+	}
+	q.messages[i].visibleAt = time.Now().Add(timeout)
+	if timeout == 0 {
+		q.notify()
+	}
+	return nil
+}
+
+// Delete a message by receipt ID.
+func (q *MemoryQueue) Delete(ctx context.Context, receiptID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	i := q.find(receiptID)
+	if i < 0 {
+		return ErrReceiptNotFound
+	}
+	q.messages = append(q.messages[:i], q.messages[i+1:]...)
+	return nil
+}
+
+// DeleteBatch of messages by receipt ID.
+// If some of the messages could not be deleted, the returned error is a *BatchError.
+func (q *MemoryQueue) DeleteBatch(ctx context.Context, receiptIDs []string) error {
+	batchErr := &BatchError{}
+	for i, receiptID := range receiptIDs {
+		if err := q.Delete(ctx, receiptID); err != nil {
+			batchErr.Failures = append(batchErr.Failures, BatchFailure{Index: i, Err: err})
+		}
+	}
+	return batchErr.orNil()
+}
+
+// Stats of the queue. Unlike on SQS, the counts are exact.
+func (q *MemoryQueue) Stats(ctx context.Context) (QueueStats, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var stats QueueStats
+	now := time.Now()
+	for _, m := range q.messages {
+		switch {
+		case !m.visibleAt.After(now):
+			stats.Visible++
+		case m.receiveCount == 0:
+			stats.Delayed++
+		default:
+			stats.InFlight++
+		}
+	}
+	return stats, nil
+}
+
+// Purge all messages from the queue, including in-flight ones.
+func (q *MemoryQueue) Purge(ctx context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.messages = nil
+	return nil
+}
+
+// find the index of the in-flight message with the given receipt ID, or -1. Must be called with the lock held.
+// A message is only in flight until its visibility timeout runs out.
+func (q *MemoryQueue) find(receiptID string) int {
+	now := time.Now()
+	for i, m := range q.messages {
+		if m.receiptID == receiptID && m.visibleAt.After(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+// notify receivers waiting for messages. Must be called with the lock held.
+func (q *MemoryQueue) notify() {
+	close(q.sent)
+	q.sent = make(chan struct{})
+}
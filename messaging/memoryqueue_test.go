@@ -0,0 +1,188 @@
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/messaging"
+	"canvas/model"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	t.Run("sends a message to the queue, receives it, and deletes it", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{})
+
+		err := queue.Send(context.Background(), model.Message{"foo": "bar"})
+		is.NoErr(err)
+
+		m, receiptID, err := queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(model.Message{"foo": "bar"}, *m)
+
+		err = queue.Delete(context.Background(), receiptID)
+		is.NoErr(err)
+
+		m, _, err = queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(nil, m)
+	})
+
+	t.Run("receives a message again after the visibility timeout, with a new receipt ID", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{
+			VisibilityTimeout: 10 * time.Millisecond,
+		})
+
+		err := queue.Send(context.Background(), model.Message{})
+		is.NoErr(err)
+
+		ms, err := queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(1, len(ms))
+		is.Equal(1, ms[0].ReceiveCount)
+
+		ms2, err := queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(0, len(ms2))
+
+		time.Sleep(20 * time.Millisecond)
+
+		ms2, err = queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(1, len(ms2))
+		is.Equal(2, ms2[0].ReceiveCount)
+		is.True(ms[0].ReceiptID != ms2[0].ReceiptID)
+
+		err = queue.Delete(context.Background(), ms[0].ReceiptID)
+		is.True(errors.Is(err, messaging.ErrReceiptNotFound))
+	})
+
+	t.Run("extends the visibility timeout", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{
+			VisibilityTimeout: 10 * time.Millisecond,
+		})
+
+		err := queue.Send(context.Background(), model.Message{})
+		is.NoErr(err)
+
+		_, receiptID, err := queue.Receive(context.Background())
+		is.NoErr(err)
+
+		err = queue.ChangeVisibility(context.Background(), receiptID, time.Minute)
+		is.NoErr(err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		m, _, err := queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(nil, m)
+	})
+
+	t.Run("delays messages", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{})
+
+		err := queue.SendWithOptions(context.Background(), model.Message{},
+			messaging.SendOptions{Delay: 20 * time.Millisecond})
+		is.NoErr(err)
+
+		m, _, err := queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(nil, m)
+
+		time.Sleep(30 * time.Millisecond)
+
+		m, _, err = queue.Receive(context.Background())
+		is.NoErr(err)
+		is.True(m != nil)
+	})
+
+	t.Run("waits for messages up to the wait time", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{WaitTime: time.Second})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = queue.Send(context.Background(), model.Message{"foo": "bar"})
+		}()
+
+		m, _, err := queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(model.Message{"foo": "bar"}, *m)
+	})
+
+	t.Run("receive does not return an error if the context is cancelled while waiting", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{WaitTime: time.Minute})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		m, _, err := queue.Receive(ctx)
+		is.NoErr(err)
+		is.Equal(nil, m)
+	})
+
+	t.Run("receives and deletes in batches", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{MaxMessages: 2})
+
+		err := queue.SendBatch(context.Background(), []model.Message{{"i": "0"}, {"i": "1"}, {"i": "2"}})
+		is.NoErr(err)
+
+		ms, err := queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(2, len(ms))
+		is.Equal("0", ms[0].Message["i"])
+		is.Equal("1", ms[1].Message["i"])
+
+		err = queue.DeleteBatch(context.Background(), []string{ms[0].ReceiptID, "notareceiptid", ms[1].ReceiptID})
+		var batchErr *messaging.BatchError
+		is.True(errors.As(err, &batchErr))
+		is.Equal(1, len(batchErr.Failures))
+		is.Equal(1, batchErr.Failures[0].Index)
+
+		ms, err = queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(1, len(ms))
+		is.Equal("2", ms[0].Message["i"])
+	})
+
+	t.Run("counts visible, in-flight, and delayed messages, and purges them all", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{MaxMessages: 1})
+
+		err := queue.SendBatch(context.Background(), []model.Message{{"i": "0"}, {"i": "1"}})
+		is.NoErr(err)
+		err = queue.SendWithOptions(context.Background(), model.Message{"i": "2"}, messaging.SendOptions{Delay: time.Minute})
+		is.NoErr(err)
+
+		_, err = queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+
+		stats, err := queue.Stats(context.Background())
+		is.NoErr(err)
+		is.Equal(messaging.QueueStats{Visible: 1, InFlight: 1, Delayed: 1}, stats)
+
+		err = queue.Purge(context.Background())
+		is.NoErr(err)
+
+		stats, err = queue.Stats(context.Background())
+		is.NoErr(err)
+		is.Equal(messaging.QueueStats{}, stats)
+	})
+}
@@ -3,41 +3,139 @@ package messaging
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 
 	"canvas/model"
+	"canvas/util"
 )
 
+const (
+	// maxBatchSize is the maximum number of entries SQS accepts in a single batch request.
+	maxBatchSize = 10
+
+	// MaxDelay is the longest SendOptions.Delay that SQS supports.
+	// Use a scheduled message in storage for longer delays.
+	MaxDelay = 15 * time.Minute
+)
+
+// defaultGroupID for messages on a FIFO queue that don't have the field named by NewQueueOptions.GroupIDField.
+const defaultGroupID = "default"
+
+// Queue for messages on SQS.
+// If the queue name ends in ".fifo", the queue is a FIFO queue, and messages are sent with a
+// message group ID and a deduplication ID.
+// See https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/FIFO-queues.html
 type Queue struct {
-	Client   *sqs.Client
-	mutex    sync.Mutex
-	name     string
-	url      *string
-	waitTime time.Duration
+	Client               *sqs.Client
+	deduplicationIDField string
+	fifo                 bool
+	groupIDField         string
+	maxMessages          int
+	mutex                sync.Mutex
+	name                 string
+	url                  *string
+	waitTime             time.Duration
 }
 
 type NewQueueOptions struct {
-	Config   aws.Config
-	Name     string
-	WaitTime time.Duration
+	Config aws.Config
+	// DeduplicationIDField is the message field used as the deduplication ID on FIFO queues,
+	// such as an idempotency key. Messages without the field are deduplicated on a hash of their content.
+	DeduplicationIDField string
+	// GroupIDField is the message field used as the message group ID on FIFO queues, such as "email".
+	// Messages in the same group are received in the order they were sent.
+	// Messages without the field all share one group.
+	GroupIDField string
+	// MaxMessages returned by ReceiveBatch, between 1 and 10. Defaults to 10.
+	MaxMessages int
+	Name        string
+	WaitTime    time.Duration
 }
 
 func NewQueue(opts NewQueueOptions) *Queue {
+	if opts.MaxMessages <= 0 || opts.MaxMessages > maxBatchSize {
+		opts.MaxMessages = maxBatchSize
+	}
 	return &Queue{
-		Client:   sqs.NewFromConfig(opts.Config),
-		name:     opts.Name,
-		waitTime: opts.WaitTime,
+		Client:               sqs.NewFromConfig(opts.Config),
+		deduplicationIDField: opts.DeduplicationIDField,
+		fifo:                 strings.HasSuffix(opts.Name, ".fifo"),
+		groupIDField:         opts.GroupIDField,
+		maxMessages:          opts.MaxMessages,
+		name:                 opts.Name,
+		waitTime:             opts.WaitTime,
+	}
+}
+
+// ReceivedMessage from the queue, with the receipt ID used to delete it.
+type ReceivedMessage struct {
+	// GroupID of the message on FIFO queues, empty otherwise.
+	GroupID   string
+	Message   model.Message
+	ReceiptID string
+	// ReceiveCount is the number of times the message has been received, including this time.
+	ReceiveCount int
+}
+
+// BatchFailure is a single failed entry in a batch request.
+type BatchFailure struct {
+	// Index of the entry in the slice given to the batch method.
+	Index int
+	Err   error
+}
+
+// BatchError is returned from batch methods when one or more entries failed.
+// Entries not listed in Failures succeeded.
+type BatchError struct {
+	Failures []BatchFailure
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%v of the batch entries failed, first error: %v", len(e.Failures), e.Failures[0].Err)
+}
+
+// SendOptions for SendWithOptions.
+type SendOptions struct {
+	// Delay before the message can be received, up to MaxDelay.
+	// FIFO queues don't support delays per message, see Queue.FIFO.
+	Delay time.Duration
+}
+
+// validate that the options are supported by SQS.
+func (o SendOptions) validate() error {
+	if o.Delay < 0 || o.Delay > MaxDelay {
+		return fmt.Errorf("delay %v must be between 0 and %v", o.Delay, MaxDelay)
 	}
+	return nil
 }
 
 // Send a message to the queue as JSON.
 func (q *Queue) Send(ctx context.Context, m model.Message) error {
+	return q.SendWithOptions(ctx, m, SendOptions{})
+}
+
+// SendWithOptions sends a message to the queue as JSON, like Send.
+func (q *Queue) SendWithOptions(ctx context.Context, m model.Message, opts SendOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if q.fifo && opts.Delay > 0 {
+		return errors.New("delay is not supported on FIFO queues")
+	}
+
 	if q.url == nil {
 		if err := q.getQueueURL(ctx); err != nil {
 			return err
@@ -50,42 +148,128 @@ func (q *Queue) Send(ctx context.Context, m model.Message) error {
 	}
 	messageAsString := string(messageAsBytes)
 
+	groupID, deduplicationID := q.getFIFOIDs(m, messageAsBytes)
 	_, err = q.Client.SendMessage(ctx, &sqs.SendMessageInput{
-		MessageBody: &messageAsString,
-		QueueUrl:    q.url,
+		DelaySeconds:           int32(opts.Delay.Seconds()),
+		MessageBody:            &messageAsString,
+		MessageDeduplicationId: deduplicationID,
+		MessageGroupId:         groupID,
+		QueueUrl:               q.url,
 	})
 	return err
 }
 
+// SendBatch of messages to the queue as JSON, split into as many batch requests as needed.
+// If some of the messages could not be sent, the returned error is a *BatchError.
+func (q *Queue) SendBatch(ctx context.Context, ms []model.Message) error {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return err
+		}
+	}
+
+	batchErr := &BatchError{}
+	for start := 0; start < len(ms); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(ms))
+
+		var entries []types.SendMessageBatchRequestEntry
+		for i := start; i < end; i++ {
+			messageAsBytes, err := json.Marshal(ms[i])
+			if err != nil {
+				batchErr.Failures = append(batchErr.Failures, BatchFailure{Index: i, Err: err})
+				continue
+			}
+			groupID, deduplicationID := q.getFIFOIDs(ms[i], messageAsBytes)
+			entries = append(entries, types.SendMessageBatchRequestEntry{
+				Id:                     aws.String(strconv.Itoa(i)),
+				MessageBody:            aws.String(string(messageAsBytes)),
+				MessageDeduplicationId: deduplicationID,
+				MessageGroupId:         groupID,
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		output, err := q.Client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			Entries:  entries,
+			QueueUrl: q.url,
+		})
+		if err != nil {
+			for _, entry := range entries {
+				batchErr.addEntryFailure(*entry.Id, err)
+			}
+			continue
+		}
+		batchErr.addResultFailures(output.Failed)
+	}
+
+	return batchErr.orNil()
+}
+
 // Receive a message and its receipt ID from the queue. Returns nil if no message is available.
 func (q *Queue) Receive(ctx context.Context) (*model.Message, string, error) {
+	ms, err := q.receive(ctx, 1)
+	if err != nil || len(ms) == 0 {
+		return nil, "", err
+	}
+	return &ms[0].Message, ms[0].ReceiptID, nil
+}
+
+// ReceiveBatch of up to NewQueueOptions.MaxMessages messages from the queue.
+// Returns an empty slice if no messages are available.
+// Messages that cannot be decoded are logged and skipped, and will end up being received again.
+func (q *Queue) ReceiveBatch(ctx context.Context) ([]ReceivedMessage, error) {
+	return q.receive(ctx, q.maxMessages)
+}
+
+func (q *Queue) receive(ctx context.Context, maxMessages int) ([]ReceivedMessage, error) {
 	if q.url == nil {
 		if err := q.getQueueURL(ctx); err != nil {
-			return nil, "", err
+			return nil, err
 		}
 	}
 
-	output, err := q.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-		QueueUrl:        q.url,
-		WaitTimeSeconds: int32(q.waitTime.Seconds()),
-	})
+	input := &sqs.ReceiveMessageInput{
+		MaxNumberOfMessages: int32(maxMessages),
+		QueueUrl:            q.url,
+		WaitTimeSeconds:     int32(q.waitTime.Seconds()),
+	}
+	input.AttributeNames = []types.QueueAttributeName{
+		types.QueueAttributeName(types.MessageSystemAttributeNameApproximateReceiveCount),
+	}
+	if q.fifo {
+		input.AttributeNames = append(input.AttributeNames,
+			types.QueueAttributeName(types.MessageSystemAttributeNameMessageGroupId))
+	}
+
+	output, err := q.Client.ReceiveMessage(ctx, input)
 	if err != nil {
 		if strings.Contains(err.Error(), "context canceled") {
-			return nil, "", nil
+			return nil, nil
 		}
-		return nil, "", err
+		return nil, err
 	}
 
-	if len(output.Messages) == 0 {
-		return nil, "", nil
-	}
-
-	var m model.Message
-	if err := json.Unmarshal([]byte(*output.Messages[0].Body), &m); err != nil {
-		return nil, "", err
+	var ms []ReceivedMessage
+	for _, message := range output.Messages {
+		var m model.Message
+		if err := json.Unmarshal([]byte(*message.Body), &m); err != nil {
+			slog.Info("Error decoding message, skipping it",
+				slog.String("id", aws.ToString(message.MessageId)), util.ErrAttr(err))
+			continue
+		}
+		receiveCount, _ := strconv.Atoi(
+			message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		ms = append(ms, ReceivedMessage{
+			GroupID:      message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)],
+			Message:      m,
+			ReceiptID:    *message.ReceiptHandle,
+			ReceiveCount: receiveCount,
+		})
 	}
 
-	return &m, *output.Messages[0].ReceiptHandle, nil
+	return ms, nil
 }
 
 // Delete a message by receipt ID.
@@ -103,6 +287,134 @@ func (q *Queue) Delete(ctx context.Context, receiptID string) error {
 	return err
 }
 
+// ChangeVisibility of a received message by receipt ID, hiding it from other receivers for the given timeout,
+// counting from now.
+func (q *Queue) ChangeVisibility(ctx context.Context, receiptID string, timeout time.Duration) error {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return err
+		}
+	}
+
+	_, err := q.Client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          q.url,
+		ReceiptHandle:     &receiptID,
+		VisibilityTimeout: int32(timeout.Seconds()),
+	})
+	return err
+}
+
+// DeleteBatch of messages by receipt ID, split into as many batch requests as needed.
+// If some of the messages could not be deleted, the returned error is a *BatchError.
+func (q *Queue) DeleteBatch(ctx context.Context, receiptIDs []string) error {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return err
+		}
+	}
+
+	batchErr := &BatchError{}
+	for start := 0; start < len(receiptIDs); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(receiptIDs))
+
+		var entries []types.DeleteMessageBatchRequestEntry
+		for i := start; i < end; i++ {
+			entries = append(entries, types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: aws.String(receiptIDs[i]),
+			})
+		}
+
+		output, err := q.Client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			Entries:  entries,
+			QueueUrl: q.url,
+		})
+		if err != nil {
+			for _, entry := range entries {
+				batchErr.addEntryFailure(*entry.Id, err)
+			}
+			continue
+		}
+		batchErr.addResultFailures(output.Failed)
+	}
+
+	return batchErr.orNil()
+}
+
+// QueueStats are approximate message counts for a queue.
+type QueueStats struct {
+	// Visible messages, ready to be received.
+	Visible int `json:"visible"`
+	// InFlight messages, received but not yet deleted or visible again.
+	InFlight int `json:"in_flight"`
+	// Delayed messages, sent with a delay that hasn't passed yet.
+	Delayed int `json:"delayed"`
+}
+
+// Stats of the queue. SQS only gives approximate counts, which can lag behind for about a minute.
+func (q *Queue) Stats(ctx context.Context) (QueueStats, error) {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return QueueStats{}, err
+		}
+	}
+
+	output, err := q.Client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		},
+		QueueUrl: q.url,
+	})
+	if err != nil {
+		return QueueStats{}, err
+	}
+
+	count := func(name types.QueueAttributeName) int {
+		v, _ := strconv.Atoi(output.Attributes[string(name)])
+		return v
+	}
+	return QueueStats{
+		Visible:  count(types.QueueAttributeNameApproximateNumberOfMessages),
+		InFlight: count(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+		Delayed:  count(types.QueueAttributeNameApproximateNumberOfMessagesDelayed),
+	}, nil
+}
+
+// Purge all messages from the queue. SQS allows one purge per queue every 60 seconds.
+func (q *Queue) Purge(ctx context.Context) error {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return err
+		}
+	}
+
+	_, err := q.Client.PurgeQueue(ctx, &sqs.PurgeQueueInput{QueueUrl: q.url})
+	return err
+}
+
+// getFIFOIDs returns the message group ID and deduplication ID for the message on FIFO queues,
+// or nils on standard queues.
+func (q *Queue) getFIFOIDs(m model.Message, body []byte) (*string, *string) {
+	if !q.fifo {
+		return nil, nil
+	}
+
+	groupID, ok := m[q.groupIDField]
+	if !ok || groupID == "" {
+		groupID = defaultGroupID
+	}
+
+	deduplicationID, ok := m[q.deduplicationIDField]
+	if !ok || deduplicationID == "" {
+		hash := sha256.Sum256(body)
+		deduplicationID = hex.EncodeToString(hash[:])
+	}
+
+	return &groupID, &deduplicationID
+}
+
 // getQueueURL under a lock.
 func (q *Queue) getQueueURL(ctx context.Context) error {
 	q.mutex.Lock()
@@ -123,3 +435,25 @@ func (q *Queue) getQueueURL(ctx context.Context) error {
 
 	return nil
 }
+
+// addEntryFailure for the entry with the given batch entry ID, which is the index as a string.
+func (e *BatchError) addEntryFailure(id string, err error) {
+	index, _ := strconv.Atoi(id)
+	e.Failures = append(e.Failures, BatchFailure{Index: index, Err: err})
+}
+
+// addResultFailures from the failed entries in a batch response.
+func (e *BatchError) addResultFailures(failed []types.BatchResultErrorEntry) {
+	for _, f := range failed {
+		e.addEntryFailure(aws.ToString(f.Id),
+			fmt.Errorf("%v: %v", aws.ToString(f.Code), aws.ToString(f.Message)))
+	}
+}
+
+// orNil returns nil if there are no failures, so the result can be returned as an error.
+func (e *BatchError) orNil() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
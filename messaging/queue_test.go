@@ -2,11 +2,15 @@ package messaging_test
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 
 	"canvas/integrationtest"
+	"canvas/messaging"
 	"canvas/model"
 )
 
@@ -56,3 +60,153 @@ func TestQueue(t *testing.T) {
 		},
 	)
 }
+
+func TestQueue_Batch(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("sends, receives, and deletes messages in batches", func(t *testing.T) {
+		is := is.New(t)
+
+		queue, cleanup := integrationtest.CreateQueue()
+		defer cleanup()
+
+		var ms []model.Message
+		for i := 0; i < 15; i++ {
+			ms = append(ms, model.Message{"i": strconv.Itoa(i)})
+		}
+		err := queue.SendBatch(context.Background(), ms)
+		is.NoErr(err)
+
+		received := map[string]bool{}
+		for len(received) < len(ms) {
+			batch, err := queue.ReceiveBatch(context.Background())
+			is.NoErr(err)
+			is.True(len(batch) <= 10)
+
+			var receiptIDs []string
+			for _, m := range batch {
+				received[m.Message["i"]] = true
+				receiptIDs = append(receiptIDs, m.ReceiptID)
+			}
+
+			err = queue.DeleteBatch(context.Background(), receiptIDs)
+			is.NoErr(err)
+		}
+
+		batch, err := queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(0, len(batch))
+	})
+
+	t.Run("reports failed deletes per message", func(t *testing.T) {
+		is := is.New(t)
+
+		queue, cleanup := integrationtest.CreateQueue()
+		defer cleanup()
+
+		err := queue.Send(context.Background(), model.Message{"foo": "bar"})
+		is.NoErr(err)
+
+		_, receiptID, err := queue.Receive(context.Background())
+		is.NoErr(err)
+
+		err = queue.DeleteBatch(context.Background(), []string{"notareceiptid", receiptID})
+		var batchErr *messaging.BatchError
+		is.True(errors.As(err, &batchErr))
+		is.Equal(1, len(batchErr.Failures))
+		is.Equal(0, batchErr.Failures[0].Index)
+	})
+}
+
+func TestQueue_SendWithOptions(t *testing.T) {
+	t.Run("errors if the delay is longer than the maximum", func(t *testing.T) {
+		is := is.New(t)
+
+		queue := messaging.NewQueue(messaging.NewQueueOptions{})
+		err := queue.SendWithOptions(context.Background(), model.Message{},
+			messaging.SendOptions{Delay: messaging.MaxDelay + time.Second})
+		is.True(err != nil)
+	})
+
+	t.Run("delays the message", func(t *testing.T) {
+		integrationtest.SkipIfShort(t)
+		is := is.New(t)
+
+		queue, cleanup := integrationtest.CreateQueue()
+		defer cleanup()
+
+		err := queue.SendWithOptions(context.Background(), model.Message{"foo": "bar"},
+			messaging.SendOptions{Delay: 2 * time.Second})
+		is.NoErr(err)
+
+		m, _, err := queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(nil, m)
+
+		time.Sleep(2 * time.Second)
+
+		m, _, err = queue.Receive(context.Background())
+		is.NoErr(err)
+		is.Equal(model.Message{"foo": "bar"}, *m)
+	})
+}
+
+func TestQueue_FIFO(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("receives messages in the same group in order", func(t *testing.T) {
+		is := is.New(t)
+
+		queue, cleanup := integrationtest.CreateFIFOQueue()
+		defer cleanup()
+
+		for _, job := range []string{"welcome_email", "unsubscribe"} {
+			err := queue.Send(context.Background(), model.Message{"job": job, "email": "me@example.com"})
+			is.NoErr(err)
+		}
+
+		ms, err := queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(2, len(ms))
+		is.Equal("welcome_email", ms[0].Message["job"])
+		is.Equal("unsubscribe", ms[1].Message["job"])
+		is.Equal("me@example.com", ms[0].GroupID)
+	})
+
+	t.Run("deduplicates on content and on the idempotency key", func(t *testing.T) {
+		is := is.New(t)
+
+		queue, cleanup := integrationtest.CreateFIFOQueue()
+		defer cleanup()
+
+		err := queue.SendBatch(context.Background(), []model.Message{
+			{"job": "welcome_email", "email": "me@example.com"},
+			{"job": "welcome_email", "email": "me@example.com"},
+			{"job": "confirmation_email", "idempotency_key": "123", "token": "abc"},
+			{"job": "confirmation_email", "idempotency_key": "123", "token": "def"},
+		})
+		is.NoErr(err)
+
+		ms, err := queue.ReceiveBatch(context.Background())
+		is.NoErr(err)
+		is.Equal(2, len(ms))
+
+		jobs := map[string]model.Message{}
+		for _, m := range ms {
+			jobs[m.Message["job"]] = m.Message
+		}
+		is.True(jobs["welcome_email"] != nil)
+		is.Equal("abc", jobs["confirmation_email"]["token"])
+	})
+
+	t.Run("errors on delayed messages", func(t *testing.T) {
+		is := is.New(t)
+
+		queue, cleanup := integrationtest.CreateFIFOQueue()
+		defer cleanup()
+
+		err := queue.SendWithOptions(context.Background(), model.Message{},
+			messaging.SendOptions{Delay: time.Second})
+		is.True(err != nil)
+	})
+}
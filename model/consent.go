@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+// ConsentEventType is the kind of change to a subscription in the consent log.
+type ConsentEventType string
+
+const (
+	ConsentEventSignup       ConsentEventType = "signup"
+	ConsentEventConfirmation ConsentEventType = "confirmation"
+	ConsentEventUnsubscribe  ConsentEventType = "unsubscribe"
+	// ConsentEventPreferenceChange is a change to the preferences of a subscription, such as its locale.
+	ConsentEventPreferenceChange ConsentEventType = "preference_change"
+	ConsentEventErasure          ConsentEventType = "erasure"
+)
+
+// Sources of consent events.
+const (
+	ConsentSourceAPI         = "api"
+	ConsentSourceAdmin       = "admin"
+	ConsentSourceCLI         = "cli"
+	ConsentSourceConfirmLink = "confirm_link"
+	ConsentSourceImport      = "import"
+	ConsentSourceSignupForm  = "signup_form"
+)
+
+// Consent is how a change to a subscription came about, recorded with it in the consent log.
+type Consent struct {
+	// Source of the change, one of the ConsentSource constants.
+	Source string `db:"source" json:"source"`
+	// IP of the client that made the change, if it came from a request.
+	IP        string `db:"ip" json:"ip"`
+	UserAgent string `db:"user_agent" json:"user_agent"`
+	// WordingVersion of the consent text the person was shown, if any.
+	WordingVersion string `db:"wording_version" json:"wording_version"`
+}
+
+// ConsentEvent in the append-only consent log, to prove when and how a person consented.
+type ConsentEvent struct {
+	ID    int64            `db:"id" json:"id"`
+	Email Email            `db:"email" json:"email"`
+	Type  ConsentEventType `db:"type" json:"type"`
+	Consent
+	Created time.Time `db:"created" json:"created"`
+}
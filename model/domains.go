@@ -0,0 +1,121 @@
+package model
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+)
+
+// disposableDomainsFile has a domain per line. Empty lines and lines starting with # are ignored.
+// It's a curated list of the most common disposable email services, kept short to avoid blocking real people.
+// Add domains by hand, for example from https://github.com/disposable-email-domains/disposable-email-domains.
+//
+//go:embed disposable_domains.txt
+var disposableDomainsFile string
+
+var disposableDomains = parseDomains(disposableDomainsFile)
+
+// commonDomains that people often sign up with, and that typos are checked against in Suggest.
+var commonDomains = []string{
+	"aol.com",
+	"fastmail.com",
+	"gmail.com",
+	"gmx.de",
+	"gmx.net",
+	"googlemail.com",
+	"hey.com",
+	"hotmail.co.uk",
+	"hotmail.com",
+	"icloud.com",
+	"live.com",
+	"mail.com",
+	"me.com",
+	"msn.com",
+	"outlook.com",
+	"proton.me",
+	"protonmail.com",
+	"web.de",
+	"yahoo.co.uk",
+	"yahoo.com",
+}
+
+// IsDisposable is true if the domain of the address, or one of its parent domains,
+// is on the embedded list of disposable email domains.
+func (e Email) IsDisposable() bool {
+	domain := strings.ToLower(e.Domain())
+	for domain != "" {
+		if _, ok := disposableDomains[domain]; ok {
+			return true
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return false
+}
+
+// Suggest a correction if the domain of the address looks like a typo of a common domain,
+// like "me@gmial.com" for "me@gmail.com". Returns false if there's nothing to suggest.
+func (e Email) Suggest() (Email, bool) {
+	domain := strings.ToLower(e.Domain())
+	if domain == "" {
+		return "", false
+	}
+
+	var best string
+	bestDistance := 3
+	for _, d := range commonDomains {
+		if d == domain {
+			return "", false
+		}
+		if distance := editDistance(domain, d); distance < bestDistance {
+			best, bestDistance = d, distance
+		}
+	}
+
+	// Two edits in a short domain is too far from being a typo
+	if best == "" || (bestDistance == 2 && len(domain) < 8) {
+		return "", false
+	}
+	local := string(e)[:strings.LastIndex(string(e), "@")]
+	return Email(local + "@" + best), true
+}
+
+// editDistance between a and b, counting insertions, deletions, substitutions,
+// and transpositions of adjacent bytes as one edit each.
+func editDistance(a, b string) int {
+	// Three rows of the distance matrix are enough: the current one and the two before it
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func parseDomains(s string) map[string]struct{} {
+	domains := map[string]struct{}{}
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+	return domains
+}
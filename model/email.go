@@ -1,6 +1,13 @@
 package model
 
-import "regexp"
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
 
 // emailAddressMatcher for valid email addresses.
 // See https://regex101.com/r/1BEPJo/latest for an interactive breakdown of the regexp.
@@ -23,6 +30,57 @@ func (e Email) IsValid() bool {
 	return emailAddressMatcher.MatchString(string(e))
 }
 
+// Normalize the address by trimming surrounding whitespace, and lowercasing the domain and converting
+// it to ASCII (punycode), so "Me@Bücher.Example" becomes "Me@xn--bcher-kva.example".
+// The local part is kept as typed, the database compares addresses case-insensitively.
+// Addresses without an @ or with a domain that can't be converted are returned trimmed, and fail IsValid.
+func (e Email) Normalize() Email {
+	v := strings.TrimSpace(string(e))
+	i := strings.LastIndex(v, "@")
+	if i < 0 {
+		return Email(v)
+	}
+	local, domain := v[:i], v[i+1:]
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return Email(v)
+	}
+	return Email(local + "@" + domain)
+}
+
+// Domain of the address, the part after the last @. Empty if there is no @.
+func (e Email) Domain() string {
+	i := strings.LastIndex(string(e), "@")
+	if i < 0 {
+		return ""
+	}
+	return string(e)[i+1:]
+}
+
 func (e Email) String() string {
 	return string(e)
 }
+
+// LogValue masks the address in logs, keeping the first character of the local part and the domain,
+// like "m***@example.com".
+func (e Email) LogValue() slog.Value {
+	local, domain, ok := strings.Cut(string(e), "@")
+	if !ok || local == "" {
+		return slog.StringValue("***")
+	}
+	_, size := utf8.DecodeRuneInString(local)
+	return slog.StringValue(local[:size] + "***@" + domain)
+}
+
+// emailInTextMatcher for email addresses in free text, like log messages and errors.
+var emailInTextMatcher = regexp.MustCompile(`[a-zA-Z0-9.!#$%&'*+/=?^_\x60{|}~-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*`)
+
+// EmailRedactor masks email addresses in free text like Email.LogValue does, for the log handler in util.
+type EmailRedactor struct{}
+
+// Redact email addresses in s.
+func (EmailRedactor) Redact(s string) string {
+	return emailInTextMatcher.ReplaceAllStringFunc(s, func(email string) string {
+		return Email(email).LogValue().String()
+	})
+}
@@ -34,3 +34,105 @@ func TestEmail_IsValid(t *testing.T) {
 		}
 	})
 }
+
+func TestEmail_Normalize(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected model.Email
+	}{
+		{" me@example.com\t", "me@example.com"},
+		{"Me@Example.COM", "Me@example.com"},
+		{"me@bücher.example", "me@xn--bcher-kva.example"},
+		{"me@BÜCHER.example", "me@xn--bcher-kva.example"},
+		{"me@example.com.", "me@example.com"},
+		{"me@some@example.com", "me@some@example.com"},
+		{"notanemail", "notanemail"},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(test.expected, model.Email(test.address).Normalize())
+		})
+	}
+
+	t.Run("makes IDN addresses valid", func(t *testing.T) {
+		is := is.New(t)
+		is.True(!model.Email("me@bücher.example").IsValid())
+		is.True(model.Email("me@bücher.example").Normalize().IsValid())
+	})
+}
+
+func TestEmail_IsDisposable(t *testing.T) {
+	tests := []struct {
+		address    string
+		disposable bool
+	}{
+		{"me@example.com", false},
+		{"me@mailinator.com", true},
+		{"me@MAILINATOR.com", true},
+		{"me@sub.mailinator.com", true},
+		{"me@notmailinator.com", false},
+		{"notanemail", false},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(test.disposable, model.Email(test.address).IsDisposable())
+		})
+	}
+}
+
+func TestEmail_Suggest(t *testing.T) {
+	tests := []struct {
+		address    string
+		suggestion model.Email
+	}{
+		{"me@gmial.com", "me@gmail.com"},
+		{"Me@gmai.com", "Me@gmail.com"},
+		{"me@gmail.co", "me@gmail.com"},
+		{"me@hotmial.com", "me@hotmail.com"},
+		{"me@outlok.com", "me@outlook.com"},
+		{"me@yahooo.com", "me@yahoo.com"},
+		{"me@gmail.com", ""},
+		{"me@example.com", ""},
+		{"me@me.com", ""},
+		{"me@mx.co", ""},
+		{"notanemail", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			is := is.New(t)
+			suggestion, ok := model.Email(test.address).Suggest()
+			is.Equal(test.suggestion != "", ok)
+			is.Equal(test.suggestion, suggestion)
+		})
+	}
+}
+
+func TestEmail_LogValue(t *testing.T) {
+	t.Run("masks the local part of the address", func(t *testing.T) {
+		tests := []struct {
+			address  string
+			expected string
+		}{
+			{"me@example.com", "m***@example.com"},
+			{"m@example.com", "m***@example.com"},
+			{"notanemail", "***"},
+			{"@example.com", "***"},
+		}
+		for _, test := range tests {
+			t.Run(test.address, func(t *testing.T) {
+				is := is.New(t)
+				is.Equal(test.expected, model.Email(test.address).LogValue().String())
+			})
+		}
+	})
+}
+
+func TestEmailRedactor_Redact(t *testing.T) {
+	t.Run("masks every address in the text", func(t *testing.T) {
+		is := is.New(t)
+		is.Equal("From m***@example.com to y***@example.org, no one else",
+			model.EmailRedactor{}.Redact("From me@example.com to you@example.org, no one else"))
+	})
+}
@@ -2,3 +2,13 @@ package model
 
 // Message for communication through a queue.
 type Message = map[string]string
+
+// Names of jobs, in the "job" field of a Message.
+// Messages for jobs are sent and scheduled from several packages, and package jobs registers the jobs by these names.
+const (
+	JobAdvanceSequenceEnrollment = "advance_sequence_enrollment"
+	JobApplyRetentionPolicies    = "apply_retention_policies"
+	JobConfirmationEmail         = "confirmation_email"
+	JobConfirmationReminderEmail = "confirmation_reminder_email"
+	JobWelcomeEmail              = "welcome_email"
+)
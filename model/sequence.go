@@ -0,0 +1,126 @@
+package model
+
+import (
+	"time"
+
+	"canvas/i18n"
+)
+
+// Sequence of emails that new subscribers get after they confirm, like a welcome series.
+type Sequence struct {
+	ID   int64  `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+	// Locale of the subscribers who enter the sequence, since the steps are written in one language.
+	Locale i18n.Locale `db:"locale" json:"locale"`
+	// Active sequences enroll new subscribers. Enrollments in progress continue regardless.
+	Active  bool      `db:"active" json:"active"`
+	Created time.Time `db:"created" json:"created"`
+	Updated time.Time `db:"updated" json:"updated"`
+}
+
+// SequenceStepCondition for sending a step, based on the step before it. Steps with unmet conditions are skipped.
+type SequenceStepCondition string
+
+const (
+	SequenceStepAlways      SequenceStepCondition = "always"
+	SequenceStepIfOpened    SequenceStepCondition = "opened_previous"
+	SequenceStepIfNotOpened SequenceStepCondition = "not_opened_previous"
+)
+
+// SequenceStepConditions in the order they are offered.
+var SequenceStepConditions = []SequenceStepCondition{
+	SequenceStepAlways,
+	SequenceStepIfOpened,
+	SequenceStepIfNotOpened,
+}
+
+func (c SequenceStepCondition) IsValid() bool {
+	for _, condition := range SequenceStepConditions {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// Met by the previous step being opened or not. A skipped previous step, or none, counts as not opened.
+func (c SequenceStepCondition) Met(openedPrevious bool) bool {
+	switch c {
+	case SequenceStepIfOpened:
+		return openedPrevious
+	case SequenceStepIfNotOpened:
+		return !openedPrevious
+	default:
+		return true
+	}
+}
+
+// SequenceStep is one email in a sequence.
+type SequenceStep struct {
+	ID         int64 `db:"id" json:"id"`
+	SequenceID int64 `db:"sequence_id" json:"sequence_id"`
+	// Position of the step in the sequence. Steps are sent in increasing order, with gaps allowed.
+	Position int `db:"position" json:"position"`
+	// DelayHours after the step before this one, or after confirmation for the first step.
+	DelayHours int                   `db:"delay_hours" json:"delay_hours"`
+	Condition  SequenceStepCondition `db:"condition" json:"condition"`
+	Subject    string                `db:"subject" json:"subject"`
+	// Body of the email as plain text, with paragraphs separated by blank lines.
+	Body    string    `db:"body" json:"body"`
+	Created time.Time `db:"created" json:"created"`
+	Updated time.Time `db:"updated" json:"updated"`
+}
+
+func (s SequenceStep) Delay() time.Duration {
+	return time.Duration(s.DelayHours) * time.Hour
+}
+
+// SequenceEnrollmentStatus of a subscriber in a sequence.
+type SequenceEnrollmentStatus string
+
+const (
+	SequenceEnrollmentActive    SequenceEnrollmentStatus = "active"
+	SequenceEnrollmentCompleted SequenceEnrollmentStatus = "completed"
+	// SequenceEnrollmentStopped when the subscriber unsubscribed before the sequence was done.
+	SequenceEnrollmentStopped SequenceEnrollmentStatus = "stopped"
+)
+
+// SequenceDelivery of a step to an enrolled subscriber.
+type SequenceDelivery struct {
+	Email  Email
+	Locale i18n.Locale
+	Step   SequenceStep
+	// Token identifies the delivery in the open tracking image.
+	Token string
+}
+
+// SequenceAdvance is what happened when an enrollment was advanced to its next step.
+type SequenceAdvance string
+
+const (
+	SequenceAdvanceSent      SequenceAdvance = "sent"
+	SequenceAdvanceSkipped   SequenceAdvance = "skipped"
+	SequenceAdvanceCompleted SequenceAdvance = "completed"
+	SequenceAdvanceStopped   SequenceAdvance = "stopped"
+	// SequenceAdvanceNone when the enrollment is gone or already done.
+	SequenceAdvanceNone SequenceAdvance = "none"
+)
+
+// SequenceSummary of a sequence with the number of enrollments by status.
+type SequenceSummary struct {
+	Sequence
+	Enrollments int `db:"enrollments" json:"enrollments"`
+	InProgress  int `db:"in_progress" json:"in_progress"`
+	Completed   int `db:"completed" json:"completed"`
+	Stopped     int `db:"stopped" json:"stopped"`
+}
+
+// SequenceStepStats of a step for the sequence funnel.
+type SequenceStepStats struct {
+	SequenceStep
+	// Reached by enrollments, whether the step was sent or skipped.
+	Reached int `db:"reached" json:"reached"`
+	Sent    int `db:"sent" json:"sent"`
+	Skipped int `db:"skipped" json:"skipped"`
+	Opened  int `db:"opened" json:"opened"`
+}
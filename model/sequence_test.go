@@ -0,0 +1,43 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/model"
+)
+
+func TestSequenceStepCondition_Met(t *testing.T) {
+	tests := []struct {
+		condition      model.SequenceStepCondition
+		openedPrevious bool
+		met            bool
+	}{
+		{model.SequenceStepAlways, false, true},
+		{model.SequenceStepAlways, true, true},
+		{model.SequenceStepIfOpened, false, false},
+		{model.SequenceStepIfOpened, true, true},
+		{model.SequenceStepIfNotOpened, false, true},
+		{model.SequenceStepIfNotOpened, true, false},
+	}
+	t.Run("is met depending on whether the previous step was opened", func(t *testing.T) {
+		for _, test := range tests {
+			t.Run(string(test.condition), func(t *testing.T) {
+				is := is.New(t)
+				is.Equal(test.met, test.condition.Met(test.openedPrevious))
+			})
+		}
+	})
+}
+
+func TestSequenceStepCondition_IsValid(t *testing.T) {
+	t.Run("is valid for the known conditions only", func(t *testing.T) {
+		is := is.New(t)
+		for _, c := range model.SequenceStepConditions {
+			is.True(c.IsValid())
+		}
+		is.True(!model.SequenceStepCondition("sometimes").IsValid())
+		is.True(!model.SequenceStepCondition("").IsValid())
+	})
+}
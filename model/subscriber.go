@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"canvas/i18n"
+)
+
+// Subscriber to the newsletter.
+type Subscriber struct {
+	Email Email `db:"email" json:"email"`
+	// Locale the subscriber signed up in, for the emails they get.
+	Locale    i18n.Locale `db:"locale" json:"locale"`
+	Confirmed bool        `db:"confirmed" json:"confirmed"`
+	// Active is false when the subscriber has been deactivated, and should get no more emails.
+	Active bool `db:"active" json:"active"`
+	// Reminded is when the subscriber got a reminder to confirm, if they have.
+	Reminded *time.Time `db:"reminded" json:"reminded,omitempty"`
+	Created  time.Time  `db:"created" json:"created"`
+	Updated  time.Time  `db:"updated" json:"updated"`
+}
@@ -0,0 +1,19 @@
+// Package canvas embeds the static assets in the public directory, so the server binary is self-contained.
+package canvas
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed public
+var public embed.FS
+
+// PublicFS with the embedded static assets, rooted at the public directory.
+func PublicFS() fs.FS {
+	fsys, err := fs.Sub(public, "public")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
@@ -0,0 +1,8 @@
+// Swap error responses into the page too, so validation errors and error messages from the server are shown
+// in place of the form. By default, htmx ignores responses with 4xx and 5xx status codes.
+document.addEventListener("htmx:beforeSwap", function (event) {
+  if (event.detail.xhr.status >= 400) {
+    event.detail.shouldSwap = true;
+    event.detail.isError = false;
+  }
+});
@@ -0,0 +1,102 @@
+// Package ratelimit has a fixed-window rate Limiter, with counts held in memory or in a shared Store.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store counts hits per key in fixed windows.
+type Store interface {
+	// HitRateLimit for the key, returning the number of hits in the current window including this one,
+	// and the time until the window resets.
+	HitRateLimit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error)
+}
+
+// Limiter allows a number of hits per key in each window of time.
+type Limiter struct {
+	limit  int
+	name   string
+	store  Store
+	window time.Duration
+}
+
+type NewLimiterOptions struct {
+	// Limit of hits per key in each window.
+	Limit int
+	// Name of the limiter, used to separate keys from other limiters in the same Store.
+	Name string
+	// Store for the counts. Defaults to a new MemoryStore, which only limits within this process.
+	Store  Store
+	Window time.Duration
+}
+
+func NewLimiter(opts NewLimiterOptions) *Limiter {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	return &Limiter{
+		limit:  opts.Limit,
+		name:   opts.Name,
+		store:  opts.Store,
+		window: opts.Window,
+	}
+}
+
+// Allow a hit for the key. If not allowed, also returns how long until the next hit will be allowed.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	hits, resetIn, err := l.store.HitRateLimit(ctx, l.name+":"+key, l.window)
+	if err != nil {
+		return false, 0, err
+	}
+	if hits > l.limit {
+		return false, resetIn, nil
+	}
+	return true, 0, nil
+}
+
+// MemoryStore is a Store in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	windows map[string]*memoryWindow
+}
+
+// memoryWindow is the hit count for a key in the current window.
+type memoryWindow struct {
+	hits  int
+	reset time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: map[string]*memoryWindow{}}
+}
+
+// HitRateLimit satisfies Store.
+func (s *MemoryStore) HitRateLimit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.reset) {
+		// Sweep expired windows now and then, so keys that are never seen again don't take up memory
+		if len(s.windows) >= 1000 {
+			s.sweep(now)
+		}
+		w = &memoryWindow{reset: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.hits++
+
+	return w.hits, w.reset.Sub(now), nil
+}
+
+// sweep windows that have reset. Must be called with the lock held.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, w := range s.windows {
+		if !now.Before(w.reset) {
+			delete(s.windows, key)
+		}
+	}
+}
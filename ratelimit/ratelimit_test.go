@@ -0,0 +1,60 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/ratelimit"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Run("allows hits up to the limit per key in each window", func(t *testing.T) {
+		is := is.New(t)
+
+		l := ratelimit.NewLimiter(ratelimit.NewLimiterOptions{Limit: 2, Window: 20 * time.Millisecond})
+
+		for i := 0; i < 2; i++ {
+			allowed, _, err := l.Allow(context.Background(), "me")
+			is.NoErr(err)
+			is.True(allowed)
+		}
+
+		allowed, retryAfter, err := l.Allow(context.Background(), "me")
+		is.NoErr(err)
+		is.True(!allowed)
+		is.True(retryAfter > 0 && retryAfter <= 20*time.Millisecond)
+
+		allowed, _, err = l.Allow(context.Background(), "you")
+		is.NoErr(err)
+		is.True(allowed)
+
+		time.Sleep(retryAfter)
+
+		allowed, _, err = l.Allow(context.Background(), "me")
+		is.NoErr(err)
+		is.True(allowed)
+	})
+
+	t.Run("separates limiters by name in a shared store", func(t *testing.T) {
+		is := is.New(t)
+
+		store := ratelimit.NewMemoryStore()
+		l1 := ratelimit.NewLimiter(ratelimit.NewLimiterOptions{
+			Limit: 1, Name: "one", Store: store, Window: time.Minute,
+		})
+		l2 := ratelimit.NewLimiter(ratelimit.NewLimiterOptions{
+			Limit: 1, Name: "two", Store: store, Window: time.Minute,
+		})
+
+		allowed, _, err := l1.Allow(context.Background(), "me")
+		is.NoErr(err)
+		is.True(allowed)
+
+		allowed, _, err = l2.Allow(context.Background(), "me")
+		is.NoErr(err)
+		is.True(allowed)
+	})
+}
@@ -2,8 +2,11 @@ package server
 
 import (
 	"canvas/handlers"
+	"canvas/i18n"
 	"canvas/model"
+	"canvas/ratelimit"
 	"context"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,7 +14,12 @@ import (
 
 type signupperMock struct{}
 
-func (s signupperMock) SignupForNewsletter(ctx context.Context, email model.Email) (string, error) {
+func (s signupperMock) SignupForNewsletter(
+	ctx context.Context,
+	email model.Email,
+	locale i18n.Locale,
+	consent model.Consent,
+) (string, error) {
 	return "", nil
 }
 
@@ -20,29 +28,71 @@ type confirmerMock struct{}
 func (s confirmerMock) ConfirmNewsletterSignup(
 	ctx context.Context,
 	token string,
-) (*model.Email, error) {
-	email := model.Email("hello")
-	return &email, nil
+	consent model.Consent,
+) (*model.Subscriber, bool, error) {
+	return &model.Subscriber{Email: "hello", Locale: i18n.Default}, true, nil
 }
 
 func (s *Server) setupRoutes() {
+	s.mux.Use(handlers.ClientIP(s.trustedProxies))
+	s.mux.Use(handlers.AddRequestID(nil))
+	s.mux.Use(handlers.AccessLog())
 	s.mux.Use(handlers.AddMetrics(s.metrics))
-	handlers.Public(s.mux)
+	s.mux.Use(handlers.Recoverer())
+	s.mux.Use(handlers.SecurityHeaders(handlers.SecurityHeadersOptions{HSTS: s.secureCookies}))
+	s.mux.Use(handlers.Localize(handlers.LocalizeOptions{Secure: s.secureCookies}))
+	handlers.Errors(s.mux)
+	handlers.Public(s.mux, s.publicFS)
 	handlers.Health(s.mux, s.database)
-	handlers.Home(s.mux)
 
-	// newsletter routes
-	handlers.NewsletterSignup(s.mux, s.database, s.queue)
-	handlers.NewsletterThanks(s.mux)
-	handlers.NewsletterConfirm(s.mux, s.database, s.queue)
-	handlers.NewsletterConfirmed(s.mux)
+	// Loaded by mail clients as an image, so without CSRF cookies
+	handlers.SequenceOpen(s.mux, s.database)
+
+	csrfOpts := handlers.CSRFOptions{Secure: s.secureCookies}
+
+	// Pages and forms
+	s.mux.Group(func(r chi.Router) {
+		r.Use(handlers.CSRF(csrfOpts))
+
+		formTimer := handlers.NewFormTimer(s.signingKey)
+		handlers.Home(r, formTimer)
+
+		// newsletter routes
+		handlers.NewsletterSignup(r, s.database, s.queue, formTimer,
+			ratelimit.NewLimiter(ratelimit.NewLimiterOptions{
+				Limit:  10,
+				Name:   "signup_ip",
+				Store:  s.rateLimitStore,
+				Window: time.Hour,
+			}),
+			ratelimit.NewLimiter(ratelimit.NewLimiterOptions{
+				Limit:  3,
+				Name:   "signup_email",
+				Store:  s.rateLimitStore,
+				Window: time.Hour,
+			}),
+			s.metrics,
+		)
+		handlers.NewsletterThanks(r)
+		handlers.NewsletterConfirm(r, s.database, s.metrics)
+		handlers.NewsletterConfirmed(r)
+	})
 
 	// Admin routes
 	s.mux.Group(func(r chi.Router) {
 		r.Use(middleware.BasicAuth("canvas", map[string]string{"admin": s.adminPassword}))
+		r.Use(handlers.RejectCrossOrigin(csrfOpts))
 
 		handlers.MigrateTo(r, s.database)
 		handlers.MigrateUp(r, s.database)
+		handlers.MigrateStatus(r, s.database)
+		handlers.Subscribers(r)
+		handlers.SubscriberImport(r, s.database)
+		handlers.SubscriberExport(r, s.database)
+		handlers.SubscriberTimeline(r, s.database)
+		handlers.Sequences(r, s.database)
+		handlers.Sequence(r, s.database)
+		handlers.SequenceSteps(r, s.database)
 	})
 
 	metricsAuth := middleware.BasicAuth(
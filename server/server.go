@@ -2,15 +2,19 @@
 package server
 
 import (
+	"canvas"
 	"canvas/messaging"
+	"canvas/model"
+	"canvas/ratelimit"
 	"canvas/storage"
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net"
-
 	"net/http"
+	"net/netip"
 
 	"strconv"
 	"time"
@@ -19,6 +23,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// queue for sending messages, such as messaging.Queue or messaging.MemoryQueue.
+type queue interface {
+	Send(ctx context.Context, m model.Message) error
+	SendBatch(ctx context.Context, ms []model.Message) error
+	SendWithOptions(ctx context.Context, m model.Message, opts messaging.SendOptions) error
+}
+
 type Server struct {
 	address         string
 	adminPassword   string
@@ -26,18 +37,33 @@ type Server struct {
 	metricsPassword string
 	metrics         *prometheus.Registry
 	mux             chi.Router
-	queue           *messaging.Queue
+	publicFS        fs.FS
+	queue           queue
+	rateLimitStore  ratelimit.Store
+	secureCookies   bool
+	signingKey      string
 	server          *http.Server
+	trustedProxies  []netip.Prefix
 }
 
 type Options struct {
 	Database        *storage.Database
 	Host            string
 	Port            int
-	Queue           *messaging.Queue
+	Queue           queue
 	AdminPassword   string
 	MetricsPassword string
 	Metrics         *prometheus.Registry
+	// SigningKey for values given to clients, like the time the signup form was rendered.
+	SigningKey string
+	// PublicFS with the static assets. Defaults to the assets embedded in the binary.
+	PublicFS fs.FS
+	// RateLimitStore is shared between rate limiters. Defaults to a ratelimit.MemoryStore.
+	RateLimitStore ratelimit.Store
+	// SecureCookies are only sent over HTTPS. Set it when the app is served over HTTPS.
+	SecureCookies bool
+	// TrustedProxies may set the X-Forwarded-For header with the client IP, such as a load balancer.
+	TrustedProxies []netip.Prefix
 }
 
 func New(opts Options) *Server {
@@ -46,6 +72,12 @@ func New(opts Options) *Server {
 	if opts.Metrics == nil {
 		opts.Metrics = prometheus.NewRegistry()
 	}
+	if opts.PublicFS == nil {
+		opts.PublicFS = canvas.PublicFS()
+	}
+	if opts.RateLimitStore == nil {
+		opts.RateLimitStore = ratelimit.NewMemoryStore()
+	}
 	return &Server{
 		address:         address,
 		mux:             mux,
@@ -54,6 +86,11 @@ func New(opts Options) *Server {
 		queue:           opts.Queue,
 		metricsPassword: opts.MetricsPassword,
 		metrics:         opts.Metrics,
+		publicFS:        opts.PublicFS,
+		rateLimitStore:  opts.RateLimitStore,
+		secureCookies:   opts.SecureCookies,
+		signingKey:      opts.SigningKey,
+		trustedProxies:  opts.TrustedProxies,
 		server: &http.Server{
 			Addr:              address,
 			Handler:           mux,
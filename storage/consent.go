@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"canvas/model"
+)
+
+// ListConsentEvents for the email address, oldest first.
+// Events are kept after the subscriber is deleted, so there may be events for an address without a subscriber.
+func (d *Database) ListConsentEvents(ctx context.Context, email model.Email) ([]model.ConsentEvent, error) {
+	events := []model.ConsentEvent{}
+	query := `
+		select id, email, type, source, ip, user_agent, wording_version, created
+		from consent_events
+		where email = $1
+		order by created, id`
+	err := d.DB.SelectContext(ctx, &events, query, email)
+	return events, err
+}
+
+// insertConsentEvent in the transaction that changes the subscription, so the change and its event
+// are stored together or not at all.
+func insertConsentEvent(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	email model.Email,
+	t model.ConsentEventType,
+	consent model.Consent,
+) error {
+	query := `
+		insert into consent_events (email, type, source, ip, user_agent, wording_version)
+		values ($1, $2, $3, $4, $5, $6)`
+	_, err := tx.ExecContext(ctx, query, email, t, consent.Source, consent.IP, consent.UserAgent, consent.WordingVersion)
+	if err != nil {
+		return fmt.Errorf("error inserting %v consent event: %w", t, err)
+	}
+	return nil
+}
+
+// inTransaction calls fn with a new transaction, and commits it if fn returns no error.
+func (d *Database) inTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := d.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/integrationtest"
+	"canvas/model"
+)
+
+func TestDatabase_ListConsentEvents(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("records an event for every subscription change, oldest first", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		formConsent := model.Consent{Source: "signup_form", IP: "192.0.2.1", UserAgent: "Firefox", WordingVersion: "1/en"}
+		token, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", formConsent)
+		is.NoErr(err)
+
+		_, _, err = db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{Source: "confirm_link", IP: "192.0.2.2"})
+		is.NoErr(err)
+
+		_, err = db.DeactivateSubscriber(context.Background(), "Me@example.com", model.Consent{Source: "cli"})
+		is.NoErr(err)
+
+		// No subscriber, no event
+		_, err = db.ConfirmSubscriber(context.Background(), "you@example.com", model.Consent{Source: "cli"})
+		is.NoErr(err)
+
+		events, err := db.ListConsentEvents(context.Background(), "ME@example.com")
+		is.NoErr(err)
+		is.Equal(3, len(events))
+
+		is.Equal(model.ConsentEventSignup, events[0].Type)
+		is.Equal(formConsent, events[0].Consent)
+		is.Equal(model.Email("me@example.com"), events[0].Email)
+		is.True(!events[0].Created.IsZero())
+
+		is.Equal(model.ConsentEventConfirmation, events[1].Type)
+		is.Equal(model.Consent{Source: "confirm_link", IP: "192.0.2.2"}, events[1].Consent)
+
+		is.Equal(model.ConsentEventUnsubscribe, events[2].Type)
+		is.Equal("cli", events[2].Source)
+
+		events, err = db.ListConsentEvents(context.Background(), "you@example.com")
+		is.NoErr(err)
+		is.Equal(0, len(events))
+	})
+
+	t.Run("records a preference change when signing up again with another locale", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{Source: "api"})
+		is.NoErr(err)
+		_, err = db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{Source: "api"})
+		is.NoErr(err)
+		_, err = db.SignupForNewsletter(context.Background(), "me@example.com", "da", model.Consent{Source: "signup_form"})
+		is.NoErr(err)
+
+		events, err := db.ListConsentEvents(context.Background(), "me@example.com")
+		is.NoErr(err)
+		is.Equal(4, len(events))
+		is.Equal(model.ConsentEventSignup, events[2].Type)
+		is.Equal(model.ConsentEventPreferenceChange, events[3].Type)
+		is.Equal("signup_form", events[3].Source)
+	})
+
+	t.Run("records signups and confirmations of imported subscribers only", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{Source: "api"})
+		is.NoErr(err)
+
+		_, err = db.ImportSubscribers(context.Background(), []model.Subscriber{
+			{Email: "me@example.com", Locale: "en", Confirmed: true, Active: true},
+			{Email: "you@example.com", Locale: "en", Confirmed: true, Active: true},
+			{Email: "them@example.com", Locale: "en", Active: true},
+		}, model.Consent{Source: "import"})
+		is.NoErr(err)
+
+		events, err := db.ListConsentEvents(context.Background(), "me@example.com")
+		is.NoErr(err)
+		is.Equal(1, len(events))
+		is.Equal("api", events[0].Source)
+
+		events, err = db.ListConsentEvents(context.Background(), "you@example.com")
+		is.NoErr(err)
+		is.Equal(2, len(events))
+		is.Equal(model.ConsentEventSignup, events[0].Type)
+		is.Equal(model.ConsentEventConfirmation, events[1].Type)
+		is.Equal("import", events[1].Source)
+
+		events, err = db.ListConsentEvents(context.Background(), "them@example.com")
+		is.NoErr(err)
+		is.Equal(1, len(events))
+		is.Equal(model.ConsentEventSignup, events[0].Type)
+	})
+}
@@ -2,16 +2,13 @@ package storage
 
 import (
 	"context"
-	"embed"
 	"fmt"
-	"io/fs"
 	"log/slog"
 	"net/url"
 	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/jmoiron/sqlx"
-	"github.com/maragudk/migrate"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 )
@@ -92,27 +89,6 @@ func (d *Database) Connect() error {
 	return nil
 }
 
-//go:embed migrations
-var migrations embed.FS
-
-func (d *Database) MigrateTo(ctx context.Context, version string) error {
-	fsys := d.getMigrations()
-	return migrate.To(ctx, d.DB.DB, fsys, version)
-}
-
-func (d *Database) MigrateUp(ctx context.Context) error {
-	fsys := d.getMigrations()
-	return migrate.Up(ctx, d.DB.DB, fsys)
-}
-
-func (d *Database) getMigrations() fs.FS {
-	fsys, err := fs.Sub(migrations, "migrations")
-	if err != nil {
-		panic(err)
-	}
-	return fsys
-}
-
 func (d *Database) createDataSourceName(withPassword bool) string {
 	password := d.password
 	if !withPassword {
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"canvas/model"
+)
+
+// ScheduleMessage for sending to the queue at the given time, identified by key.
+// If a message with the same key is already scheduled, it is replaced.
+func (d *Database) ScheduleMessage(ctx context.Context, key string, m model.Message, at time.Time) error {
+	return scheduleMessage(ctx, d.DB, key, m, at)
+}
+
+// scheduleMessage like ScheduleMessage, with the given executor, so it can be part of a transaction.
+func scheduleMessage(ctx context.Context, e sqlx.ExecerContext, key string, m model.Message, at time.Time) error {
+	messageAsBytes, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshalling message to json: %w", err)
+	}
+
+	query := `
+		insert into scheduled_messages (key, message, due)
+		values ($1, $2, $3)
+		on conflict (key) do update set
+			message = excluded.message,
+			due = excluded.due`
+	_, err = e.ExecContext(ctx, query, key, messageAsBytes, at.UTC())
+	return err
+}
+
+// ScheduleMessageIfAbsent for sending to the queue at the given time, identified by key,
+// unless a message with the same key is already scheduled. Returns whether the message was scheduled.
+func (d *Database) ScheduleMessageIfAbsent(ctx context.Context, key string, m model.Message, at time.Time) (bool, error) {
+	messageAsBytes, err := json.Marshal(m)
+	if err != nil {
+		return false, fmt.Errorf("error marshalling message to json: %w", err)
+	}
+
+	query := `
+		insert into scheduled_messages (key, message, due)
+		values ($1, $2, $3)
+		on conflict (key) do nothing`
+	result, err := d.DB.ExecContext(ctx, query, key, messageAsBytes, at.UTC())
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CancelScheduledMessage with the given key. Returns whether there was a message to cancel.
+func (d *Database) CancelScheduledMessage(ctx context.Context, key string) (bool, error) {
+	result, err := d.DB.ExecContext(ctx, `delete from scheduled_messages where key = $1`, key)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// SendDueScheduledMessages passes up to limit messages that are due to send, oldest first.
+// Each message that is sent without error is deleted, and sending stops at the first error.
+// Rows are locked while sending, so concurrent callers never send the same message twice.
+// Returns the number of messages sent.
+func (d *Database) SendDueScheduledMessages(
+	ctx context.Context,
+	limit int,
+	send func(context.Context, model.Message) error,
+) (int, error) {
+	tx, err := d.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var rows []struct {
+		Key     string
+		Message []byte
+	}
+	query := `
+		select key, message
+		from scheduled_messages
+		where due <= now()
+		order by due
+		limit $1
+		for update skip locked`
+	if err := tx.SelectContext(ctx, &rows, query, limit); err != nil {
+		return 0, err
+	}
+
+	// Messages sent before an error are still deleted, so they are not sent again
+	var sent int
+	var sendErr error
+	for _, row := range rows {
+		var m model.Message
+		if err := json.Unmarshal(row.Message, &m); err != nil {
+			sendErr = fmt.Errorf("error unmarshalling scheduled message %v: %w", row.Key, err)
+			break
+		}
+
+		if err := send(ctx, m); err != nil {
+			sendErr = fmt.Errorf("error sending scheduled message %v: %w", row.Key, err)
+			break
+		}
+
+		if _, err := tx.ExecContext(ctx, `delete from scheduled_messages where key = $1`, row.Key); err != nil {
+			return 0, err
+		}
+		sent++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return sent, sendErr
+}
@@ -0,0 +1,140 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/integrationtest"
+	"canvas/model"
+)
+
+func TestDatabase_ScheduleMessage(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("sends due messages and deletes them", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.ScheduleMessage(context.Background(), "past", model.Message{"foo": "past"},
+			time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		err = db.ScheduleMessage(context.Background(), "future", model.Message{"foo": "future"},
+			time.Now().Add(time.Hour))
+		is.NoErr(err)
+
+		var sent []model.Message
+		send := func(ctx context.Context, m model.Message) error {
+			sent = append(sent, m)
+			return nil
+		}
+
+		count, err := db.SendDueScheduledMessages(context.Background(), 10, send)
+		is.NoErr(err)
+		is.Equal(1, count)
+		is.Equal([]model.Message{{"foo": "past"}}, sent)
+
+		count, err = db.SendDueScheduledMessages(context.Background(), 10, send)
+		is.NoErr(err)
+		is.Equal(0, count)
+	})
+
+	t.Run("sends messages when due regardless of the session time zone", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		// One connection, so the time zone applies to all the queries
+		db.DB.SetMaxOpenConns(1)
+		db.DB.MustExec(`set time zone 'Pacific/Auckland'`)
+
+		err := db.ScheduleMessage(context.Background(), "soon", model.Message{"foo": "soon"},
+			time.Now().Add(time.Minute))
+		is.NoErr(err)
+
+		count, err := db.SendDueScheduledMessages(context.Background(), 10, func(ctx context.Context, m model.Message) error {
+			return nil
+		})
+		is.NoErr(err)
+		is.Equal(0, count)
+	})
+
+	t.Run("keeps messages that could not be sent", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.ScheduleMessage(context.Background(), "past", model.Message{"foo": "past"},
+			time.Now().Add(-time.Minute))
+		is.NoErr(err)
+
+		count, err := db.SendDueScheduledMessages(context.Background(), 10,
+			func(ctx context.Context, m model.Message) error {
+				return errors.New("queue is down")
+			})
+		is.True(err != nil)
+		is.Equal(0, count)
+
+		var exists bool
+		err = db.DB.Get(&exists, `select exists (select * from scheduled_messages where key = 'past')`)
+		is.NoErr(err)
+		is.True(exists)
+	})
+
+	t.Run("cancels a scheduled message by key", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.ScheduleMessage(context.Background(), "reminder", model.Message{"foo": "bar"},
+			time.Now().Add(-time.Minute))
+		is.NoErr(err)
+
+		cancelled, err := db.CancelScheduledMessage(context.Background(), "reminder")
+		is.NoErr(err)
+		is.True(cancelled)
+
+		cancelled, err = db.CancelScheduledMessage(context.Background(), "reminder")
+		is.NoErr(err)
+		is.True(!cancelled)
+
+		count, err := db.SendDueScheduledMessages(context.Background(), 10,
+			func(ctx context.Context, m model.Message) error {
+				return nil
+			})
+		is.NoErr(err)
+		is.Equal(0, count)
+	})
+}
+
+func TestDatabase_ScheduleMessageIfAbsent(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("schedules a message only if there is none with the key", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		scheduled, err := db.ScheduleMessageIfAbsent(context.Background(), "key", model.Message{"foo": "first"},
+			time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		is.True(scheduled)
+
+		scheduled, err = db.ScheduleMessageIfAbsent(context.Background(), "key", model.Message{"foo": "second"},
+			time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		is.True(!scheduled)
+
+		var sent []model.Message
+		_, err = db.SendDueScheduledMessages(context.Background(), 10, func(ctx context.Context, m model.Message) error {
+			sent = append(sent, m)
+			return nil
+		})
+		is.NoErr(err)
+		is.Equal([]model.Message{{"foo": "first"}}, sent)
+	})
+}
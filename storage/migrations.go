@@ -0,0 +1,419 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maragudk/migrate"
+
+	"canvas/util"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+var (
+	upMatcher   = regexp.MustCompile(`^([\w-]+)\.up\.sql$`)
+	downMatcher = regexp.MustCompile(`^([\w-]+)\.down\.sql$`)
+	nameMatcher = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// ErrMigrationsModified is returned when migrating while applied migration files have been edited since they were
+// applied. Revert the edit and add a new migration instead.
+var ErrMigrationsModified = errors.New("applied migrations have been modified")
+
+// ErrSchemaTooNew is returned from CheckSchema when the database has been migrated past the latest embedded
+// migration, for example by a newer release, so this binary doesn't know the schema.
+var ErrSchemaTooNew = errors.New("database schema is newer than the migrations in this binary")
+
+// migrationLockID is the Postgres advisory lock key held while migrating.
+// It's an arbitrary constant that must not be used for other advisory locks.
+const migrationLockID = 1_624_619_937
+
+// Migrations embedded in the binary, the same ones the server migrates with.
+func Migrations() fs.FS {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
+
+// MigrationStep is a single migration file to run.
+type MigrationStep struct {
+	// Version the file migrates up or down from.
+	Version string `json:"version"`
+	Name    string `json:"name"`
+	SQL     string `json:"sql"`
+}
+
+// MigrationStatus of the database compared to the embedded migrations.
+type MigrationStatus struct {
+	// Current version of the database schema, empty if nothing has been migrated.
+	Current string `json:"current"`
+	// Latest version in the embedded migrations.
+	Latest string `json:"latest"`
+	// Pending versions that migrating up would apply, oldest first.
+	Pending []string `json:"pending"`
+	// Modified versions whose files have changed since they were applied.
+	Modified []string `json:"modified"`
+}
+
+// MigrateTo the given version, or all the way down for the empty version, while holding the migration lock.
+// See withMigrationLock.
+func (d *Database) MigrateTo(ctx context.Context, version string) error {
+	return d.withMigrationLock(ctx, func() error {
+		if err := d.verifyMigrations(ctx); err != nil {
+			return err
+		}
+		return d.newMigrator().MigrateTo(ctx, version)
+	})
+}
+
+// MigrateUp to the latest version while holding the migration lock. See withMigrationLock.
+func (d *Database) MigrateUp(ctx context.Context) error {
+	return d.withMigrationLock(ctx, func() error {
+		if err := d.verifyMigrations(ctx); err != nil {
+			return err
+		}
+		return d.newMigrator().MigrateUp(ctx)
+	})
+}
+
+// withMigrationLock calls fn while holding a Postgres advisory lock, so that migrations from app instances starting
+// at the same time, the migrate command, and the migrate endpoints run one at a time. When several instances start
+// at the same time, one migrates and the others wait for it, and then find nothing left to migrate.
+// Waiting for the lock stops when ctx is cancelled.
+// The lock is held on its own connection while migrating on another, so it needs a pool of at least two connections.
+func (d *Database) withMigrationLock(ctx context.Context, fn func() error) error {
+	if d.DB.Stats().MaxOpenConnections == 1 {
+		return errors.New("migrating with a lock needs at least two database connections")
+	}
+
+	conn, err := d.DB.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	start := time.Now()
+	if _, err := conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("error getting migration lock: %w", err)
+	}
+	slog.Info("Got migration lock", slog.Duration("waited", time.Since(start)))
+
+	defer func() {
+		// Unlock with a fresh context, so the lock is released even if ctx is cancelled while migrating.
+		// If unlocking fails, closing the connection releases the lock anyway.
+		if _, err := conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			slog.Warn("Error releasing migration lock", util.ErrAttr(err))
+		}
+	}()
+
+	return fn()
+}
+
+// CheckSchema returns ErrSchemaTooNew if the database schema is newer than the embedded migrations.
+// Pending and modified migrations are logged as warnings, but are not errors.
+func (d *Database) CheckSchema(ctx context.Context) error {
+	status, err := d.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Current > status.Latest {
+		return fmt.Errorf("%w: database is at %v, latest known is %v", ErrSchemaTooNew, status.Current, status.Latest)
+	}
+	if len(status.Pending) > 0 {
+		slog.Warn("Database has pending migrations", slog.Any("versions", status.Pending))
+	}
+	if len(status.Modified) > 0 {
+		slog.Warn("Applied migrations have been modified", slog.Any("versions", status.Modified))
+	}
+	return nil
+}
+
+// PlanMigrateTo returns the migration files MigrateTo would run, in order, without running them.
+// An empty version plans migrating all the way down.
+func (d *Database) PlanMigrateTo(ctx context.Context, version string) ([]MigrationStep, error) {
+	current, err := d.getMigrationVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := Migrations()
+	var steps []MigrationStep
+	switch {
+	case version > current:
+		ups, err := getMigrationVersions(fsys, upMatcher)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ups, version) {
+			return nil, errors.New("error finding version " + version)
+		}
+		for _, v := range ups {
+			if v > current && v <= version {
+				steps = append(steps, MigrationStep{Version: v, Name: v + ".up.sql"})
+			}
+		}
+	case version < current:
+		downs, err := getMigrationVersions(fsys, downMatcher)
+		if err != nil {
+			return nil, err
+		}
+		if version != "" && !slices.Contains(downs, version) {
+			return nil, errors.New("error finding version " + version)
+		}
+		for i := len(downs) - 1; i >= 0; i-- {
+			if downs[i] <= current && downs[i] > version {
+				steps = append(steps, MigrationStep{Version: downs[i], Name: downs[i] + ".down.sql"})
+			}
+		}
+	}
+
+	for i := range steps {
+		content, err := fs.ReadFile(fsys, steps[i].Name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration file %v: %w", steps[i].Name, err)
+		}
+		steps[i].SQL = string(content)
+	}
+	return steps, nil
+}
+
+// PlanMigrateUp returns the migration files MigrateUp would run, in order, without running them.
+func (d *Database) PlanMigrateUp(ctx context.Context) ([]MigrationStep, error) {
+	ups, err := getMigrationVersions(Migrations(), upMatcher)
+	if err != nil || len(ups) == 0 {
+		return nil, err
+	}
+	return d.PlanMigrateTo(ctx, ups[len(ups)-1])
+}
+
+// MigrationStatus of the database.
+func (d *Database) MigrationStatus(ctx context.Context) (MigrationStatus, error) {
+	status := MigrationStatus{Pending: []string{}, Modified: []string{}}
+
+	var err error
+	if status.Current, err = d.getMigrationVersion(ctx); err != nil {
+		return status, err
+	}
+
+	ups, err := getMigrationVersions(Migrations(), upMatcher)
+	if err != nil {
+		return status, err
+	}
+	if len(ups) > 0 {
+		status.Latest = ups[len(ups)-1]
+	}
+	for _, v := range ups {
+		if v > status.Current {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+
+	if status.Modified, err = d.getModifiedMigrations(ctx); err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+// CreateMigration files for the given name in dir, with a version after all existing migrations in it.
+// The name must be lowercase words separated by dashes, like "add-subscriber-tags".
+// Returns the paths of the up and down files.
+func CreateMigration(dir, name string, now time.Time) (string, string, error) {
+	if !nameMatcher.MatchString(name) {
+		return "", "", fmt.Errorf("migration name %q must be lowercase words separated by dashes", name)
+	}
+
+	ups, err := getMigrationVersions(os.DirFS(dir), upMatcher)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Versions are compared as strings, so the new one must sort after the last one even if the clock is behind
+	timestamp := now.Unix()
+	if len(ups) > 0 {
+		last, _, _ := strings.Cut(ups[len(ups)-1], "-")
+		if lastTimestamp, err := strconv.ParseInt(last, 10, 64); err == nil && lastTimestamp >= timestamp {
+			timestamp = lastTimestamp + 1
+		}
+	}
+
+	version := fmt.Sprintf("%v-%v", timestamp, name)
+	up := filepath.Join(dir, version+".up.sql")
+	down := filepath.Join(dir, version+".down.sql")
+	for _, path := range []string{up, down} {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return "", "", err
+		}
+		if err := f.Close(); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
+
+// newMigrator that records the checksum of each migration it applies.
+func (d *Database) newMigrator() *migrate.Migrator {
+	return migrate.New(migrate.Options{
+		After: recordMigrationChecksums,
+		DB:    d.DB.DB,
+		FS:    Migrations(),
+	})
+}
+
+// recordMigrationChecksums after migrating to the given version,
+// adding the checksum for the version and forgetting them for all versions after it.
+func recordMigrationChecksums(ctx context.Context, tx *sql.Tx, version string) error {
+	if _, err := tx.ExecContext(ctx, `delete from migration_checksums where version > $1`, version); err != nil {
+		return err
+	}
+	if version == "" {
+		return nil
+	}
+	checksum, err := getMigrationChecksum(Migrations(), version)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		insert into migration_checksums (version, checksum) values ($1, $2)
+		on conflict (version) do nothing`, version, checksum)
+	return err
+}
+
+// verifyMigrations returns ErrMigrationsModified if applied migration files have been edited.
+// Checksums are recorded the first time, for migrations applied before checksums were introduced.
+func (d *Database) verifyMigrations(ctx context.Context) error {
+	if _, err := d.DB.ExecContext(ctx, `
+		create table if not exists migration_checksums (
+			version text primary key,
+			checksum text not null,
+			created timestamp not null default now()
+		)`); err != nil {
+		return fmt.Errorf("error creating migration checksums table: %w", err)
+	}
+
+	current, err := d.getMigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	ups, err := getMigrationVersions(Migrations(), upMatcher)
+	if err != nil {
+		return err
+	}
+	for _, v := range ups {
+		if v > current {
+			break
+		}
+		checksum, err := getMigrationChecksum(Migrations(), v)
+		if err != nil {
+			return err
+		}
+		if _, err := d.DB.ExecContext(ctx, `
+			insert into migration_checksums (version, checksum) values ($1, $2)
+			on conflict (version) do nothing`, v, checksum); err != nil {
+			return err
+		}
+	}
+
+	modified, err := d.getModifiedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("%w: %v", ErrMigrationsModified, strings.Join(modified, ", "))
+	}
+	return nil
+}
+
+// getModifiedMigrations whose recorded checksum doesn't match the embedded file, or whose file is gone.
+func (d *Database) getModifiedMigrations(ctx context.Context) ([]string, error) {
+	var exists bool
+	if err := d.DB.GetContext(ctx, &exists, `select to_regclass('migration_checksums') is not null`); err != nil {
+		return nil, err
+	}
+	modified := []string{}
+	if !exists {
+		return modified, nil
+	}
+
+	var recorded []struct {
+		Version  string
+		Checksum string
+	}
+	if err := d.DB.SelectContext(ctx, &recorded, `select version, checksum from migration_checksums order by version`); err != nil {
+		return nil, err
+	}
+	for _, r := range recorded {
+		checksum, err := getMigrationChecksum(Migrations(), r.Version)
+		if err != nil || checksum != r.Checksum {
+			modified = append(modified, r.Version)
+		}
+	}
+	return modified, nil
+}
+
+// getMigrationVersion of the database, or the empty string if it hasn't been migrated.
+func (d *Database) getMigrationVersion(ctx context.Context) (string, error) {
+	var exists bool
+	if err := d.DB.GetContext(ctx, &exists, `select to_regclass('migrations') is not null`); err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", nil
+	}
+
+	var version string
+	if err := d.DB.GetContext(ctx, &version, `select version from migrations`); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting current migration version: %w", err)
+	}
+	return version, nil
+}
+
+// getMigrationChecksum of the up file for the version.
+func getMigrationChecksum(fsys fs.FS, version string) (string, error) {
+	content, err := fs.ReadFile(fsys, version+".up.sql")
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// getMigrationVersions of the files matching matcher, sorted.
+func getMigrationVersions(fsys fs.FS, matcher *regexp.Regexp) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, entry := range entries {
+		if m := matcher.FindStringSubmatch(entry.Name()); m != nil {
+			versions = append(versions, m[1])
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
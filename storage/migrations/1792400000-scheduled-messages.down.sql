@@ -0,0 +1,5 @@
+alter table newsletter_subscribers
+  alter column created type timestamp,
+  alter column updated type timestamp;
+
+drop table scheduled_messages;
@@ -0,0 +1,14 @@
+-- Times are compared with times from the app and with now(), so they must not depend on the session time zone.
+create table scheduled_messages (
+  key text primary key,
+  message jsonb not null,
+  due timestamptz not null,
+  created timestamptz not null default now ()
+);
+
+create index scheduled_messages_due_idx on scheduled_messages (due);
+
+-- Defaults of now() were stored in the session time zone, which the conversion assumes
+alter table newsletter_subscribers
+  alter column created type timestamptz,
+  alter column updated type timestamptz;
@@ -0,0 +1,5 @@
+create table rate_limits (
+  key text primary key,
+  hits int not null,
+  reset timestamptz not null
+);
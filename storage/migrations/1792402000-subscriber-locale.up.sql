@@ -0,0 +1 @@
+alter table newsletter_subscribers add column locale text not null default 'en';
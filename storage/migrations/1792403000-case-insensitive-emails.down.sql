@@ -0,0 +1 @@
+alter table newsletter_subscribers alter column email type text;
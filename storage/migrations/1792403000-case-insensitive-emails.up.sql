@@ -0,0 +1,20 @@
+create extension if not exists citext;
+
+-- Keep one subscriber per address that differs only in case, preferring confirmed, active, and older ones
+delete from newsletter_subscribers
+where email in (
+  select email from (
+    select email, row_number() over (
+      partition by lower(email)
+      order by confirmed desc, active desc, created, email
+    ) as n
+    from newsletter_subscribers
+  ) ranked
+  where n > 1
+);
+
+update newsletter_subscribers
+set email = split_part(email, '@', 1) || '@' || lower(split_part(email, '@', 2))
+where email != split_part(email, '@', 1) || '@' || lower(split_part(email, '@', 2));
+
+alter table newsletter_subscribers alter column email type citext;
@@ -0,0 +1 @@
+drop table consent_events;
@@ -0,0 +1,24 @@
+-- Append-only log of changes to subscriptions. There's no foreign key to newsletter_subscribers,
+-- so the log outlives the subscriber.
+create table consent_events (
+  id bigint generated always as identity primary key,
+  email citext not null,
+  type text not null,
+  source text not null,
+  ip text not null default '',
+  user_agent text not null default '',
+  wording_version text not null default '',
+  created timestamptz not null default now ()
+);
+
+create index consent_events_email_idx on consent_events (email, created);
+
+-- What is known about existing subscribers, marked with the migration as the source
+insert into consent_events (email, type, source, created)
+select email, 'signup', 'migration', created from newsletter_subscribers;
+
+insert into consent_events (email, type, source, created)
+select email, 'confirmation', 'migration', updated from newsletter_subscribers where confirmed;
+
+insert into consent_events (email, type, source, created)
+select email, 'unsubscribe', 'migration', updated from newsletter_subscribers where not active;
@@ -0,0 +1,4 @@
+drop table sequence_deliveries;
+drop table sequence_enrollments;
+drop table sequence_steps;
+drop table sequences;
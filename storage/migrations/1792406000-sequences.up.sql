@@ -0,0 +1,53 @@
+-- Sequences of emails sent to new subscribers after they confirm, like a welcome series.
+create table sequences (
+  id bigint generated always as identity primary key,
+  name text not null unique,
+  locale text not null default 'en',
+  active bool not null default false,
+  created timestamptz not null default now (),
+  updated timestamptz not null default now ()
+);
+
+-- Positions are unique per sequence, checked at commit so that steps can swap positions.
+create table sequence_steps (
+  id bigint generated always as identity primary key,
+  sequence_id bigint not null references sequences (id) on delete cascade,
+  position int not null,
+  delay_hours int not null default 0 check (delay_hours >= 0),
+  condition text not null default 'always',
+  subject text not null,
+  body text not null,
+  created timestamptz not null default now (),
+  updated timestamptz not null default now (),
+  unique (sequence_id, position) deferrable initially deferred
+);
+
+-- Enrollments follow the subscriber's email address when it changes, and go when the subscriber goes.
+-- The position is of the last step sent or skipped, zero before the first.
+create table sequence_enrollments (
+  id bigint generated always as identity primary key,
+  sequence_id bigint not null references sequences (id) on delete cascade,
+  email citext not null references newsletter_subscribers (email) on update cascade on delete cascade,
+  status text not null default 'active',
+  position int not null default 0,
+  created timestamptz not null default now (),
+  updated timestamptz not null default now (),
+  unique (sequence_id, email)
+);
+
+create index sequence_enrollments_email_idx on sequence_enrollments (email);
+
+-- Deliveries of steps to enrollments, skipped if the step condition wasn't met.
+-- The token identifies the delivery in the open tracking image.
+create table sequence_deliveries (
+  id bigint generated always as identity primary key,
+  enrollment_id bigint not null references sequence_enrollments (id) on delete cascade,
+  step_id bigint not null references sequence_steps (id) on delete cascade,
+  token text not null unique,
+  skipped bool not null,
+  opened timestamptz,
+  created timestamptz not null default now (),
+  unique (enrollment_id, step_id)
+);
+
+create index sequence_deliveries_step_id_idx on sequence_deliveries (step_id);
@@ -0,0 +1,156 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/integrationtest"
+	"canvas/storage"
+)
+
+func TestDatabase_MigrationStatus(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("shows no pending migrations after migrating up", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		status, err := db.MigrationStatus(context.Background())
+		is.NoErr(err)
+		is.Equal(status.Latest, status.Current)
+		is.Equal(0, len(status.Pending))
+		is.Equal(0, len(status.Modified))
+	})
+
+	t.Run("detects modified migrations and refuses to migrate", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		db.DB.MustExec(`update migration_checksums set checksum = 'edited' where version = '1624619937-newsletter-subscribers'`)
+
+		status, err := db.MigrationStatus(context.Background())
+		is.NoErr(err)
+		is.Equal([]string{"1624619937-newsletter-subscribers"}, status.Modified)
+
+		err = db.MigrateUp(context.Background())
+		is.True(errors.Is(err, storage.ErrMigrationsModified))
+	})
+}
+
+func TestDatabase_PlanMigrateTo(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("plans migrating down and back up without changing anything", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		steps, err := db.PlanMigrateTo(context.Background(), "1624619937-newsletter-subscribers")
+		is.NoErr(err)
+		is.True(len(steps) > 0)
+		is.True(strings.HasSuffix(steps[0].Name, ".down.sql"))
+		is.True(steps[0].SQL != "")
+
+		steps, err = db.PlanMigrateUp(context.Background())
+		is.NoErr(err)
+		is.Equal(0, len(steps))
+
+		err = db.MigrateTo(context.Background(), "1624619937-newsletter-subscribers")
+		is.NoErr(err)
+
+		steps, err = db.PlanMigrateUp(context.Background())
+		is.NoErr(err)
+		is.True(len(steps) > 0)
+		is.True(strings.HasSuffix(steps[0].Name, ".up.sql"))
+
+		status, err := db.MigrationStatus(context.Background())
+		is.NoErr(err)
+		is.Equal(len(steps), len(status.Pending))
+		is.Equal(0, len(status.Modified))
+	})
+}
+
+func TestCreateMigration(t *testing.T) {
+	t.Run("creates empty up and down files with a version after the existing ones", func(t *testing.T) {
+		is := is.New(t)
+
+		dir := t.TempDir()
+		is.NoErr(os.WriteFile(filepath.Join(dir, "2000000000-existing.up.sql"), nil, 0644))
+
+		up, down, err := storage.CreateMigration(dir, "add-tags", time.Unix(1000, 0))
+		is.NoErr(err)
+		is.Equal(filepath.Join(dir, "2000000001-add-tags.up.sql"), up)
+		is.Equal(filepath.Join(dir, "2000000001-add-tags.down.sql"), down)
+
+		_, err = os.Stat(down)
+		is.NoErr(err)
+
+		up, _, err = storage.CreateMigration(dir, "later", time.Unix(3000000000, 0))
+		is.NoErr(err)
+		is.Equal(filepath.Join(dir, "3000000000-later.up.sql"), up)
+	})
+
+	t.Run("rejects names that are not lowercase words separated by dashes", func(t *testing.T) {
+		is := is.New(t)
+
+		_, _, err := storage.CreateMigration(t.TempDir(), "Add tags", time.Now())
+		is.True(err != nil)
+	})
+}
+
+func TestDatabase_MigrateUp(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("lets concurrent callers migrate one at a time", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.MigrateTo(context.Background(), "")
+		is.NoErr(err)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = db.MigrateUp(context.Background())
+			}()
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			is.NoErr(err)
+		}
+		status, err := db.MigrationStatus(context.Background())
+		is.NoErr(err)
+		is.Equal(status.Latest, status.Current)
+	})
+}
+
+func TestDatabase_CheckSchema(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("returns an error if the schema is newer than the migrations", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		is.NoErr(db.CheckSchema(context.Background()))
+
+		db.DB.MustExec(`update migrations set version = '9999999999-from-the-future'`)
+		err := db.CheckSchema(context.Background())
+		is.True(errors.Is(err, storage.ErrSchemaTooNew))
+	})
+}
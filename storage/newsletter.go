@@ -6,23 +6,61 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/jmoiron/sqlx"
+
+	"canvas/i18n"
 	"canvas/model"
+	"canvas/util"
 )
 
-// SignupForNewsletter with the given email. Returns a token used for confirming the email address.
-func (d *Database) SignupForNewsletter(ctx context.Context, email model.Email) (string, error) {
+const (
+	// welcomeEmailKeyPrefix of scheduled welcome emails, followed by the lowercased email address.
+	welcomeEmailKeyPrefix = "welcome_email:"
+
+	// welcomeEmailDelay after confirmation, so the welcome email doesn't arrive right on top of the confirmation.
+	welcomeEmailDelay = 10 * time.Minute
+)
+
+// SignupForNewsletter with the given email and the locale for emails to it, recording the consent.
+// If the email address has signed up before with another locale, the change is recorded as a preference change too.
+// Returns a token used for confirming the email address.
+func (d *Database) SignupForNewsletter(
+	ctx context.Context,
+	email model.Email,
+	locale i18n.Locale,
+	consent model.Consent,
+) (string, error) {
 	token, err := createSecret()
 	if err != nil {
 		return "", err
 	}
 	query := `
-		insert into newsletter_subscribers (email, token)
-		values ($1, $2)
+		with previous as (
+			select locale from newsletter_subscribers where email = $1 for update
+		)
+		insert into newsletter_subscribers (email, token, locale)
+		values ($1, $2, $3)
 		on conflict (email) do update set
 			token = excluded.token,
-			updated = now()`
-	_, err = d.DB.ExecContext(ctx, query, email, token)
+			locale = excluded.locale,
+			updated = now()
+		returning (select locale from previous) as previous_locale`
+	err = d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var previousLocale *i18n.Locale
+		if err := tx.GetContext(ctx, &previousLocale, query, email, token, locale); err != nil {
+			return err
+		}
+		if err := insertConsentEvent(ctx, tx, email, model.ConsentEventSignup, consent); err != nil {
+			return err
+		}
+		if previousLocale != nil && *previousLocale != locale {
+			return insertConsentEvent(ctx, tx, email, model.ConsentEventPreferenceChange, consent)
+		}
+		return nil
+	})
 	return token, err
 }
 
@@ -34,25 +72,90 @@ func createSecret() (string, error) {
 	return fmt.Sprintf("%x", secret), nil
 }
 
-// ConfirmNewsletterSignup with the given token. Returns the associated email if matched.
+// ConfirmNewsletterSignup with the given token, recording the consent.
+// Returns the associated subscriber if matched, and whether this call confirmed them,
+// as opposed to them being confirmed already. Newly confirmed subscribers enter the active sequences in their locale,
+// and get a welcome email after welcomeEmailDelay, scheduled in the same transaction, so it's sent exactly once.
 func (d *Database) ConfirmNewsletterSignup(
 	ctx context.Context,
 	token string,
-) (*model.Email, error) {
-	var email model.Email
+	consent model.Consent,
+) (*model.Subscriber, bool, error) {
+	var s *model.Subscriber
+	var wasConfirmed bool
 	query := `
-		update newsletter_subscribers
+		with previous as (
+			select email, confirmed from newsletter_subscribers where token = $1 for update
+		)
+		update newsletter_subscribers s
 		set confirmed = true
-		where token = $1
-		returning email`
-	err := d.DB.GetContext(ctx, &email, query, token)
-
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+		from previous
+		where s.email = previous.email
+		returning s.email, s.locale, s.reminded, previous.confirmed as was_confirmed`
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var row struct {
+			model.Subscriber
+			WasConfirmed bool `db:"was_confirmed"`
+		}
+		if err := tx.GetContext(ctx, &row, query, token); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				util.Logger(ctx).Info("No newsletter signup with the confirmation token")
+				return nil
+			}
+			return err
+		}
+		s = &row.Subscriber
+		wasConfirmed = row.WasConfirmed
+		if !wasConfirmed {
+			if err := enrollInSequences(ctx, tx, s.Email); err != nil {
+				return err
+			}
+			welcome := model.Message{"job": model.JobWelcomeEmail, "email": s.Email.String(), "locale": string(s.Locale)}
+			key := welcomeEmailKeyPrefix + strings.ToLower(s.Email.String())
+			if err := scheduleMessage(ctx, tx, key, welcome, time.Now().Add(welcomeEmailDelay)); err != nil {
+				return err
+			}
 		}
-		return nil, err
+		return insertConsentEvent(ctx, tx, s.Email, model.ConsentEventConfirmation, consent)
+	})
+	if err != nil || s == nil {
+		return nil, false, err
 	}
+	return s, !wasConfirmed, nil
+}
 
-	return &email, nil
+// RemindUnconfirmedSubscriber with the given email, if they are active, haven't confirmed,
+// and haven't been reminded before. The subscriber is marked as reminded and remind is called
+// with their token and locale in the same transaction, so a failing remind leaves them unmarked,
+// and concurrent calls for the same subscriber don't both remind them.
+// Returns whether remind was called without error.
+func (d *Database) RemindUnconfirmedSubscriber(
+	ctx context.Context,
+	email model.Email,
+	remind func(ctx context.Context, token string, locale i18n.Locale) error,
+) (bool, error) {
+	var reminded bool
+	query := `
+		update newsletter_subscribers
+		set reminded = now()
+		where email = $1 and active and not confirmed and reminded is null
+		returning token, locale`
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var row struct {
+			Token  string
+			Locale i18n.Locale
+		}
+		if err := tx.GetContext(ctx, &row, query, email); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		if err := remind(ctx, row.Token, row.Locale); err != nil {
+			return err
+		}
+		reminded = true
+		return nil
+	})
+	return reminded, err
 }
@@ -2,11 +2,16 @@ package storage_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 
+	"canvas/i18n"
 	"canvas/integrationtest"
+	"canvas/model"
 )
 
 func TestDatabase_SignupForNewsletter(t *testing.T) {
@@ -17,7 +22,7 @@ func TestDatabase_SignupForNewsletter(t *testing.T) {
 		db, cleanup := integrationtest.CreateDatabase()
 		defer cleanup()
 
-		expectedToken, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+		expectedToken, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
 		is.NoErr(err)
 		is.Equal(64, len(expectedToken))
 
@@ -27,14 +32,37 @@ func TestDatabase_SignupForNewsletter(t *testing.T) {
 		is.Equal("me@example.com", email)
 		is.Equal(expectedToken, token)
 
-		expectedToken2, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+		expectedToken2, err := db.SignupForNewsletter(context.Background(), "me@example.com", "da", model.Consent{})
 		is.NoErr(err)
 		is.True(expectedToken != expectedToken2)
 
-		err = db.DB.QueryRow(`select email, token from newsletter_subscribers`).Scan(&email, &token)
+		var locale string
+		err = db.DB.QueryRow(`select email, token, locale from newsletter_subscribers`).Scan(&email, &token, &locale)
 		is.NoErr(err)
 		is.Equal("me@example.com", email)
 		is.Equal(expectedToken2, token)
+		is.Equal("da", locale)
+	})
+
+	t.Run("treats addresses that differ only in case as the same subscriber", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
+		is.NoErr(err)
+		_, err = db.SignupForNewsletter(context.Background(), "Me@example.com", "en", model.Consent{})
+		is.NoErr(err)
+
+		var count int
+		err = db.DB.Get(&count, `select count(*) from newsletter_subscribers`)
+		is.NoErr(err)
+		is.Equal(1, count)
+
+		s, err := db.GetSubscriber(context.Background(), "ME@EXAMPLE.COM")
+		is.NoErr(err)
+		is.True(s != nil)
+		is.Equal(model.Email("me@example.com"), s.Email)
 	})
 }
 
@@ -42,13 +70,13 @@ func TestDatabase_ConfirmNewsletterSignup(t *testing.T) {
 	integrationtest.SkipIfShort(t)
 
 	t.Run(
-		"confirms subscriber from the token and returns the associated email address",
+		"confirms subscriber from the token and returns the associated subscriber",
 		func(t *testing.T) {
 			is := is.New(t)
 			db, cleanup := integrationtest.CreateDatabase()
 			defer cleanup()
 
-			token, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+			token, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
 			is.NoErr(err)
 
 			var confirmed bool
@@ -60,9 +88,12 @@ func TestDatabase_ConfirmNewsletterSignup(t *testing.T) {
 			is.NoErr(err)
 			is.True(!confirmed)
 
-			email, err := db.ConfirmNewsletterSignup(context.Background(), token)
+			subscriber, confirmed, err := db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{})
 			is.NoErr(err)
-			is.Equal("me@example.com", email.String())
+			is.True(confirmed)
+			is.Equal("me@example.com", subscriber.Email.String())
+			is.Equal(i18n.Default, subscriber.Locale)
+			is.True(subscriber.Reminded == nil)
 
 			err = db.DB.Get(
 				&confirmed,
@@ -71,19 +102,135 @@ func TestDatabase_ConfirmNewsletterSignup(t *testing.T) {
 			)
 			is.NoErr(err)
 			is.True(confirmed)
+
+			subscriber, confirmed, err = db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{})
+			is.NoErr(err)
+			is.True(!confirmed)
+			is.Equal("me@example.com", subscriber.Email.String())
 		},
 	)
 
+	t.Run("schedules a delayed welcome email once, in the confirmation transaction", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), "Me@example.com", "da", model.Consent{})
+		is.NoErr(err)
+
+		_, _, err = db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{})
+		is.NoErr(err)
+		_, _, err = db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{})
+		is.NoErr(err)
+
+		is.Equal(1, countRows(t, db, "scheduled_messages"))
+
+		var row struct {
+			Message []byte
+			Due     time.Time
+		}
+		err = db.DB.Get(&row, `select message, due from scheduled_messages where key = 'welcome_email:me@example.com'`)
+		is.NoErr(err)
+		var m model.Message
+		is.NoErr(json.Unmarshal(row.Message, &m))
+		is.Equal(model.Message{"job": "welcome_email", "email": "Me@example.com", "locale": "da"}, m)
+		is.True(time.Until(row.Due) > 9*time.Minute)
+	})
+
 	t.Run("returns nil if no such token", func(t *testing.T) {
 		is := is.New(t)
 		db, cleanup := integrationtest.CreateDatabase()
 		defer cleanup()
 
-		_, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
 		is.NoErr(err)
 
-		email, err := db.ConfirmNewsletterSignup(context.Background(), "notmytoken")
+		subscriber, confirmed, err := db.ConfirmNewsletterSignup(context.Background(), "notmytoken", model.Consent{})
 		is.NoErr(err)
-		is.True(email == nil)
+		is.True(subscriber == nil)
+		is.True(!confirmed)
+	})
+}
+
+func TestDatabase_RemindUnconfirmedSubscriber(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("reminds an unconfirmed subscriber once, with their token and locale", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), "me@example.com", "da", model.Consent{})
+		is.NoErr(err)
+
+		var calls int
+		remind := func(ctx context.Context, remindToken string, locale i18n.Locale) error {
+			calls++
+			is.Equal(token, remindToken)
+			is.Equal(i18n.Locale("da"), locale)
+			return nil
+		}
+
+		reminded, err := db.RemindUnconfirmedSubscriber(context.Background(), "Me@example.com", remind)
+		is.NoErr(err)
+		is.True(reminded)
+
+		reminded, err = db.RemindUnconfirmedSubscriber(context.Background(), "me@example.com", remind)
+		is.NoErr(err)
+		is.True(!reminded)
+		is.Equal(1, calls)
+
+		subscriber, confirmed, err := db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{})
+		is.NoErr(err)
+		is.True(confirmed)
+		is.True(subscriber.Reminded != nil)
+	})
+
+	t.Run("doesn't mark the subscriber as reminded if remind fails", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
+		is.NoErr(err)
+
+		reminded, err := db.RemindUnconfirmedSubscriber(context.Background(), "me@example.com",
+			func(ctx context.Context, token string, locale i18n.Locale) error {
+				return errors.New("wire is cut")
+			})
+		is.True(err != nil)
+		is.True(!reminded)
+
+		reminded, err = db.RemindUnconfirmedSubscriber(context.Background(), "me@example.com",
+			func(ctx context.Context, token string, locale i18n.Locale) error {
+				return nil
+			})
+		is.NoErr(err)
+		is.True(reminded)
+	})
+
+	t.Run("doesn't remind confirmed, deactivated, or unknown subscribers", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), "confirmed@example.com", "en", model.Consent{})
+		is.NoErr(err)
+		_, _, err = db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{})
+		is.NoErr(err)
+
+		_, err = db.SignupForNewsletter(context.Background(), "deactivated@example.com", "en", model.Consent{})
+		is.NoErr(err)
+		_, err = db.DeactivateSubscriber(context.Background(), "deactivated@example.com", model.Consent{})
+		is.NoErr(err)
+
+		for _, email := range []model.Email{"confirmed@example.com", "deactivated@example.com", "unknown@example.com"} {
+			reminded, err := db.RemindUnconfirmedSubscriber(context.Background(), email,
+				func(ctx context.Context, token string, locale i18n.Locale) error {
+					return errors.New("should not be called")
+				})
+			is.NoErr(err)
+			is.True(!reminded)
+		}
 	})
 }
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// HitRateLimit for the key, returning the number of hits in the current window including this one,
+// and the time until the window resets. Satisfies ratelimit.Store, so limits are shared between app instances.
+func (d *Database) HitRateLimit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	var result struct {
+		Hits    int
+		ResetIn float64 `db:"reset_in"`
+	}
+	query := `
+		insert into rate_limits (key, hits, reset)
+		values ($1, 1, now() + make_interval(secs => $2))
+		on conflict (key) do update set
+			hits = case when rate_limits.reset <= now() then 1 else rate_limits.hits + 1 end,
+			reset = case when rate_limits.reset <= now() then excluded.reset else rate_limits.reset end
+		returning hits, extract(epoch from reset - now()) as reset_in`
+	if err := d.DB.GetContext(ctx, &result, query, key, window.Seconds()); err != nil {
+		return 0, 0, err
+	}
+	return result.Hits, time.Duration(result.ResetIn * float64(time.Second)), nil
+}
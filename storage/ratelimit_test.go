@@ -0,0 +1,40 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/integrationtest"
+)
+
+func TestDatabase_HitRateLimit(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("counts hits per key until the window resets", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		hits, resetIn, err := db.HitRateLimit(context.Background(), "me", time.Second)
+		is.NoErr(err)
+		is.Equal(1, hits)
+		is.True(resetIn > 0 && resetIn <= time.Second)
+
+		hits, _, err = db.HitRateLimit(context.Background(), "me", time.Second)
+		is.NoErr(err)
+		is.Equal(2, hits)
+
+		hits, _, err = db.HitRateLimit(context.Background(), "you", time.Second)
+		is.NoErr(err)
+		is.Equal(1, hits)
+
+		time.Sleep(time.Second)
+
+		hits, _, err = db.HitRateLimit(context.Background(), "me", time.Second)
+		is.NoErr(err)
+		is.Equal(1, hits)
+	})
+}
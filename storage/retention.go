@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// anonymizedDomain of the addresses that anonymized subscribers get. The .invalid TLD never resolves.
+const anonymizedDomain = "anonymized.invalid"
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// DeleteUnconfirmedSubscribers who haven't confirmed and haven't signed up again since before,
+// together with their consent events, since they never consented.
+// With dryRun, nothing is deleted, but the count is the same. Returns the number of subscribers deleted.
+func (d *Database) DeleteUnconfirmedSubscribers(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	query := `
+		with deleted as (
+			delete from newsletter_subscribers
+			where not confirmed and updated < $1
+			returning email
+		), events as (
+			delete from consent_events
+			where email in (select email from deleted)
+		)
+		select count(*) from deleted`
+	return d.applyRetention(ctx, dryRun, query, before.UTC())
+}
+
+// AnonymizeInactiveSubscribers deactivated since before, by replacing their email address with a random one
+// in both the subscribers and the consent events, and removing IPs and user agents from the events.
+// An erasure consent event is recorded for each, so the history shows what happened.
+// The rows are kept for statistics. With dryRun, nothing is changed, but the count is the same.
+// Returns the number of subscribers anonymized.
+func (d *Database) AnonymizeInactiveSubscribers(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	query := `
+		with targets as (
+			select email, 'anonymized-' || gen_random_uuid() || '@` + anonymizedDomain + `' as anonymized
+			from newsletter_subscribers
+			where not active and updated < $1 and email not like '%@` + anonymizedDomain + `'
+			for update
+		), subscribers as (
+			update newsletter_subscribers s
+			set email = t.anonymized, token = '', updated = now()
+			from targets t
+			where s.email = t.email
+		), events as (
+			update consent_events e
+			set email = t.anonymized, ip = '', user_agent = ''
+			from targets t
+			where e.email = t.email
+		), erasures as (
+			insert into consent_events (email, type, source)
+			select anonymized, 'erasure', 'retention' from targets
+		)
+		select count(*) from targets`
+	return d.applyRetention(ctx, dryRun, query, before.UTC())
+}
+
+// DeleteOrphanedConsentEvents created before, for addresses that are no longer subscribers.
+// With dryRun, nothing is deleted, but the count is the same. Returns the number of events deleted.
+func (d *Database) DeleteOrphanedConsentEvents(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	query := `
+		with deleted as (
+			delete from consent_events e
+			where created < $1 and not exists (select from newsletter_subscribers s where s.email = e.email)
+			returning 1
+		)
+		select count(*) from deleted`
+	return d.applyRetention(ctx, dryRun, query, before.UTC())
+}
+
+// DeleteSequenceDeliveries created before, with the open tracking of each recipient, for enrollments that are
+// completed or stopped. Deliveries of active enrollments are kept, because the next step may depend on them.
+// The step funnel of a sequence only counts the deliveries that are kept.
+// With dryRun, nothing is deleted, but the count is the same. Returns the number of deliveries deleted.
+func (d *Database) DeleteSequenceDeliveries(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	query := `
+		with deleted as (
+			delete from sequence_deliveries d
+			using sequence_enrollments e
+			where d.enrollment_id = e.id and d.created < $1 and e.status != 'active'
+			returning 1
+		)
+		select count(*) from deleted`
+	return d.applyRetention(ctx, dryRun, query, before.UTC())
+}
+
+// DeleteExpiredRateLimits whose window has ended, which are reset on the next hit anyway.
+// With dryRun, nothing is deleted, but the count is the same. Returns the number of rate limits deleted.
+func (d *Database) DeleteExpiredRateLimits(ctx context.Context, dryRun bool) (int, error) {
+	query := `
+		with deleted as (
+			delete from rate_limits
+			where reset <= now()
+			returning 1
+		)
+		select count(*) from deleted`
+	return d.applyRetention(ctx, dryRun, query)
+}
+
+// applyRetention with a query that returns the number of affected rows, in a transaction.
+// With dryRun, the transaction is rolled back, so the count is exact without changing anything.
+func (d *Database) applyRetention(ctx context.Context, dryRun bool, query string, args ...any) (int, error) {
+	var count int
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &count, query, args...); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,200 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/integrationtest"
+	"canvas/model"
+	"canvas/storage"
+)
+
+func TestDatabase_DeleteUnconfirmedSubscribers(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("deletes old unconfirmed subscribers and their consent events, unless it's a dry run", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		signup(t, db, "old@example.com", false)
+		signup(t, db, "new@example.com", false)
+		signup(t, db, "confirmed@example.com", true)
+		age(t, db, "old@example.com", "confirmed@example.com")
+
+		before := time.Now().Add(-24 * time.Hour)
+		count, err := db.DeleteUnconfirmedSubscribers(context.Background(), before, true)
+		is.NoErr(err)
+		is.Equal(1, count)
+		is.Equal(3, countRows(t, db, "newsletter_subscribers"))
+
+		count, err = db.DeleteUnconfirmedSubscribers(context.Background(), before, false)
+		is.NoErr(err)
+		is.Equal(1, count)
+		is.Equal(2, countRows(t, db, "newsletter_subscribers"))
+
+		s, err := db.GetSubscriber(context.Background(), "old@example.com")
+		is.NoErr(err)
+		is.True(s == nil)
+
+		events, err := db.ListConsentEvents(context.Background(), "old@example.com")
+		is.NoErr(err)
+		is.Equal(0, len(events))
+	})
+}
+
+func TestDatabase_AnonymizeInactiveSubscribers(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("replaces the address of old inactive subscribers, and records the erasure", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		signup(t, db, "gone@example.com", true)
+		signup(t, db, "here@example.com", true)
+		_, err := db.DeactivateSubscriber(context.Background(), "gone@example.com", model.Consent{Source: "cli"})
+		is.NoErr(err)
+		age(t, db, "gone@example.com", "here@example.com")
+
+		before := time.Now().Add(-24 * time.Hour)
+		count, err := db.AnonymizeInactiveSubscribers(context.Background(), before, false)
+		is.NoErr(err)
+		is.Equal(1, count)
+
+		s, err := db.GetSubscriber(context.Background(), "gone@example.com")
+		is.NoErr(err)
+		is.True(s == nil)
+
+		events, err := db.ListConsentEvents(context.Background(), "gone@example.com")
+		is.NoErr(err)
+		is.Equal(0, len(events))
+
+		subscribers, err := db.ListSubscribers(context.Background(), storage.SubscriberFilter{Active: new(bool)})
+		is.NoErr(err)
+		is.Equal(1, len(subscribers))
+		anonymized := subscribers[0].Email
+		is.True(strings.HasSuffix(anonymized.String(), "@anonymized.invalid"))
+
+		events, err = db.ListConsentEvents(context.Background(), anonymized)
+		is.NoErr(err)
+		is.Equal(4, len(events))
+		is.Equal("", events[0].IP)
+		is.Equal(model.ConsentEventErasure, events[3].Type)
+
+		// Anonymized subscribers are left alone the next time
+		age(t, db, anonymized.String())
+		count, err = db.AnonymizeInactiveSubscribers(context.Background(), before, false)
+		is.NoErr(err)
+		is.Equal(0, count)
+	})
+}
+
+func TestDatabase_DeleteOrphanedConsentEvents(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("deletes old consent events of addresses without a subscriber", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		signup(t, db, "me@example.com", false)
+		signup(t, db, "you@example.com", false)
+		_, err := db.DB.Exec(`delete from newsletter_subscribers where email = 'you@example.com'`)
+		is.NoErr(err)
+		_, err = db.DB.Exec(`update consent_events set created = now() - interval '2 days'`)
+		is.NoErr(err)
+
+		count, err := db.DeleteOrphanedConsentEvents(context.Background(), time.Now().Add(-24*time.Hour), false)
+		is.NoErr(err)
+		is.Equal(1, count)
+		is.Equal(1, countRows(t, db, "consent_events"))
+	})
+}
+
+func TestDatabase_DeleteSequenceDeliveries(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("deletes old deliveries of enrollments that are no longer active", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s := createSequence(t, db, "en")
+		addStep(t, db, s.ID, 0, model.SequenceStepAlways, "First")
+		addStep(t, db, s.ID, 0, model.SequenceStepAlways, "Second")
+		for _, email := range []model.Email{"me@example.com", "you@example.com"} {
+			confirm(t, db, email, "en")
+			_, err := db.AdvanceSequenceEnrollment(context.Background(), getEnrollmentID(t, db, s.ID, email), 0,
+				func(ctx context.Context, d model.SequenceDelivery) error {
+					return nil
+				})
+			is.NoErr(err)
+		}
+		_, err := db.DeactivateSubscriber(context.Background(), "you@example.com", model.Consent{})
+		is.NoErr(err)
+
+		count, err := db.DeleteSequenceDeliveries(context.Background(), time.Now().Add(time.Hour), false)
+		is.NoErr(err)
+		is.Equal(1, count)
+		is.Equal(1, countRows(t, db, "sequence_deliveries"))
+	})
+}
+
+func TestDatabase_DeleteExpiredRateLimits(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("deletes rate limits whose window has ended", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, _, err := db.HitRateLimit(context.Background(), "expired", -time.Minute)
+		is.NoErr(err)
+		_, _, err = db.HitRateLimit(context.Background(), "current", time.Hour)
+		is.NoErr(err)
+
+		count, err := db.DeleteExpiredRateLimits(context.Background(), false)
+		is.NoErr(err)
+		is.Equal(1, count)
+		is.Equal(1, countRows(t, db, "rate_limits"))
+	})
+}
+
+// signup the email address, and confirm it if confirmed is true.
+func signup(t *testing.T, db *storage.Database, email model.Email, confirmed bool) {
+	t.Helper()
+	if _, err := db.SignupForNewsletter(context.Background(), email, "en", model.Consent{Source: "api", IP: "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !confirmed {
+		return
+	}
+	if _, err := db.ConfirmSubscriber(context.Background(), email, model.Consent{Source: "cli"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// age the subscribers with the email addresses by two days.
+func age(t *testing.T, db *storage.Database, emails ...string) {
+	t.Helper()
+	for _, email := range emails {
+		query := `update newsletter_subscribers set created = now() - interval '2 days', updated = now() - interval '2 days' where email = $1`
+		if _, err := db.DB.Exec(query, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countRows(t *testing.T, db *storage.Database, table string) int {
+	t.Helper()
+	var count int
+	if err := db.DB.Get(&count, `select count(*) from `+table); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"canvas/i18n"
+	"canvas/model"
+)
+
+// sequenceKeyPrefix of the scheduled message for the next step of an enrollment, followed by its ID.
+const sequenceKeyPrefix = "sequence_enrollment:"
+
+const (
+	sequenceColumns     = `id, name, locale, active, created, updated`
+	sequenceStepColumns = `id, sequence_id, position, delay_hours, condition, subject, body, created, updated`
+)
+
+// ListSequences with the number of enrollments by status, by name.
+func (d *Database) ListSequences(ctx context.Context) ([]model.SequenceSummary, error) {
+	sequences := []model.SequenceSummary{}
+	query := `
+		select s.id, s.name, s.locale, s.active, s.created, s.updated,
+			count(e.id) as enrollments,
+			count(e.id) filter (where e.status = 'active') as in_progress,
+			count(e.id) filter (where e.status = 'completed') as completed,
+			count(e.id) filter (where e.status = 'stopped') as stopped
+		from sequences s
+			left join sequence_enrollments e on e.sequence_id = s.id
+		group by s.id
+		order by s.name`
+	err := d.DB.SelectContext(ctx, &sequences, query)
+	return sequences, err
+}
+
+// GetSequence by ID. Returns nil if there is no such sequence.
+func (d *Database) GetSequence(ctx context.Context, id int64) (*model.Sequence, error) {
+	var s model.Sequence
+	query := `select ` + sequenceColumns + ` from sequences where id = $1`
+	if err := d.DB.GetContext(ctx, &s, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CreateSequence with the name, locale, and active state of s. Returns nil if the name is taken.
+func (d *Database) CreateSequence(ctx context.Context, s model.Sequence) (*model.Sequence, error) {
+	var created model.Sequence
+	query := `
+		insert into sequences (name, locale, active)
+		values ($1, $2, $3)
+		on conflict (name) do nothing
+		returning ` + sequenceColumns
+	if err := d.DB.GetContext(ctx, &created, query, s.Name, s.Locale, s.Active); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateSequence with the name, locale, and active state of s, by ID.
+// Returns nil if there is no such sequence, or the name is taken by another one.
+func (d *Database) UpdateSequence(ctx context.Context, s model.Sequence) (*model.Sequence, error) {
+	var updated model.Sequence
+	query := `
+		update sequences
+		set name = $2, locale = $3, active = $4, updated = now()
+		where id = $1 and not exists (select from sequences where name = $2 and id != $1)
+		returning ` + sequenceColumns
+	if err := d.DB.GetContext(ctx, &updated, query, s.ID, s.Name, s.Locale, s.Active); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteSequence by ID, with its steps, enrollments, and deliveries. Returns whether there was such a sequence.
+// Scheduled steps of its enrollments are left to find their enrollment gone.
+func (d *Database) DeleteSequence(ctx context.Context, id int64) (bool, error) {
+	result, err := d.DB.ExecContext(ctx, `delete from sequences where id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// ListSequenceStepStats of the steps in the sequence, in order, for the funnel of the sequence.
+func (d *Database) ListSequenceStepStats(ctx context.Context, sequenceID int64) ([]model.SequenceStepStats, error) {
+	stats := []model.SequenceStepStats{}
+	query := `
+		select st.id, st.sequence_id, st.position, st.delay_hours, st.condition, st.subject, st.body,
+			st.created, st.updated,
+			count(d.id) as reached,
+			count(d.id) filter (where not d.skipped) as sent,
+			count(d.id) filter (where d.skipped) as skipped,
+			count(d.opened) as opened
+		from sequence_steps st
+			left join sequence_deliveries d on d.step_id = st.id
+		where st.sequence_id = $1
+		group by st.id
+		order by st.position`
+	err := d.DB.SelectContext(ctx, &stats, query, sequenceID)
+	return stats, err
+}
+
+// AddSequenceStep at the end of its sequence, with the delay, condition, subject, and body of s.
+// Returns nil if there is no such sequence.
+func (d *Database) AddSequenceStep(ctx context.Context, s model.SequenceStep) (*model.SequenceStep, error) {
+	var added model.SequenceStep
+	query := `
+		insert into sequence_steps (sequence_id, position, delay_hours, condition, subject, body)
+		select id, coalesce((select max(position) from sequence_steps where sequence_id = $1), 0) + 1, $2, $3, $4, $5
+		from sequences
+		where id = $1
+		returning ` + sequenceStepColumns
+	err := d.DB.GetContext(ctx, &added, query, s.SequenceID, s.DelayHours, s.Condition, s.Subject, s.Body)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &added, nil
+}
+
+// UpdateSequenceStep with the delay, condition, subject, and body of s, by ID and sequence ID.
+// Returns nil if there is no such step.
+func (d *Database) UpdateSequenceStep(ctx context.Context, s model.SequenceStep) (*model.SequenceStep, error) {
+	var updated model.SequenceStep
+	query := `
+		update sequence_steps
+		set delay_hours = $3, condition = $4, subject = $5, body = $6, updated = now()
+		where id = $1 and sequence_id = $2
+		returning ` + sequenceStepColumns
+	err := d.DB.GetContext(ctx, &updated, query, s.ID, s.SequenceID, s.DelayHours, s.Condition, s.Subject, s.Body)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// MoveSequenceStep one position up or down in its sequence, by swapping positions with the step next to it.
+// Moving the first step up or the last one down does nothing. Returns whether there is such a step.
+func (d *Database) MoveSequenceStep(ctx context.Context, sequenceID, stepID int64, up bool) (bool, error) {
+	neighbour := `select id, position from sequence_steps
+		where sequence_id = $1 and position > (select position from steps where id = $2)
+		order by position
+		limit 1`
+	if up {
+		neighbour = `select id, position from sequence_steps
+			where sequence_id = $1 and position < (select position from steps where id = $2)
+			order by position desc
+			limit 1`
+	}
+
+	// The unique positions are checked at commit, so the two updates can swap them.
+	query := `
+		with steps as (
+			select id, position from sequence_steps where id = $2 and sequence_id = $1
+		), neighbour as (` + neighbour + `
+		), moved as (
+			update sequence_steps s
+			set position = n.position, updated = now()
+			from neighbour n
+			where s.id = $2
+		), swapped as (
+			update sequence_steps s
+			set position = (select position from steps), updated = now()
+			from neighbour n
+			where s.id = n.id
+		)
+		select exists (select from steps)`
+	var found bool
+	err := d.DB.GetContext(ctx, &found, query, sequenceID, stepID)
+	return found, err
+}
+
+// DeleteSequenceStep by ID and sequence ID, with its deliveries. Returns whether there was such a step.
+// Enrollments continue with the step after it.
+func (d *Database) DeleteSequenceStep(ctx context.Context, sequenceID, stepID int64) (bool, error) {
+	result, err := d.DB.ExecContext(ctx, `delete from sequence_steps where id = $1 and sequence_id = $2`,
+		stepID, sequenceID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// RecordSequenceOpen of the delivery with the token, keeping the time of the first open.
+// Returns whether there is such a delivery.
+func (d *Database) RecordSequenceOpen(ctx context.Context, token string) (bool, error) {
+	query := `
+		update sequence_deliveries
+		set opened = coalesce(opened, now())
+		where token = $1 and not skipped`
+	result, err := d.DB.ExecContext(ctx, query, token)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// AdvanceSequenceEnrollment with the ID to its next step, if it's still at the given position,
+// so a message that is received twice doesn't advance it twice.
+// The step is skipped if its condition isn't met, and otherwise send is called with the delivery
+// in the same transaction, so a failing send leaves the enrollment where it was.
+// The step after that is scheduled after its delay, or the enrollment is completed if there is none.
+// Enrollments of subscribers who have unsubscribed are stopped instead.
+func (d *Database) AdvanceSequenceEnrollment(
+	ctx context.Context,
+	id int64,
+	position int,
+	send func(ctx context.Context, delivery model.SequenceDelivery) error,
+) (model.SequenceAdvance, error) {
+	advance := model.SequenceAdvanceNone
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var e struct {
+			SequenceID int64 `db:"sequence_id"`
+			Email      model.Email
+			Status     model.SequenceEnrollmentStatus
+			Position   int
+			Locale     i18n.Locale
+			Active     bool
+			Confirmed  bool
+		}
+		query := `
+			select e.sequence_id, e.email, e.status, e.position, s.locale, s.active, s.confirmed
+			from sequence_enrollments e
+				join newsletter_subscribers s on s.email = e.email
+			where e.id = $1
+			for update of e`
+		if err := tx.GetContext(ctx, &e, query, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		if e.Status != model.SequenceEnrollmentActive || e.Position != position {
+			return nil
+		}
+
+		if !e.Active || !e.Confirmed {
+			advance = model.SequenceAdvanceStopped
+			return setSequenceEnrollmentStatus(ctx, tx, id, model.SequenceEnrollmentStopped)
+		}
+
+		step, err := getNextSequenceStep(ctx, tx, e.SequenceID, e.Position)
+		if err != nil {
+			return err
+		}
+		if step == nil {
+			advance = model.SequenceAdvanceCompleted
+			return setSequenceEnrollmentStatus(ctx, tx, id, model.SequenceEnrollmentCompleted)
+		}
+
+		var openedPrevious bool
+		query = `
+			select coalesce((
+				select opened is not null from sequence_deliveries where enrollment_id = $1 order by id desc limit 1
+			), false)`
+		if err := tx.GetContext(ctx, &openedPrevious, query, id); err != nil {
+			return err
+		}
+
+		token, err := createSecret()
+		if err != nil {
+			return err
+		}
+
+		// A step that was delivered before it was moved isn't delivered again
+		skipped := !step.Condition.Met(openedPrevious)
+		var inserted bool
+		query = `
+			with inserted as (
+				insert into sequence_deliveries (enrollment_id, step_id, token, skipped)
+				values ($1, $2, $3, $4)
+				on conflict (enrollment_id, step_id) do nothing
+				returning id
+			)
+			select exists (select from inserted)`
+		if err := tx.GetContext(ctx, &inserted, query, id, step.ID, token, skipped); err != nil {
+			return err
+		}
+		advance = model.SequenceAdvanceSent
+		if skipped || !inserted {
+			advance = model.SequenceAdvanceSkipped
+		}
+
+		query = `update sequence_enrollments set position = $2, updated = now() where id = $1`
+		if _, err := tx.ExecContext(ctx, query, id, step.Position); err != nil {
+			return err
+		}
+
+		next, err := getNextSequenceStep(ctx, tx, e.SequenceID, step.Position)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			err = setSequenceEnrollmentStatus(ctx, tx, id, model.SequenceEnrollmentCompleted)
+		} else {
+			err = scheduleSequenceStep(ctx, tx, id, step.Position, time.Now().Add(next.Delay()))
+		}
+		if err != nil {
+			return err
+		}
+
+		if advance != model.SequenceAdvanceSent {
+			return nil
+		}
+		return send(ctx, model.SequenceDelivery{Email: e.Email, Locale: e.Locale, Step: *step, Token: token})
+	})
+	if err != nil {
+		return model.SequenceAdvanceNone, err
+	}
+	return advance, nil
+}
+
+// getNextSequenceStep after the position in the sequence. Returns nil if there is none.
+func getNextSequenceStep(ctx context.Context, tx *sqlx.Tx, sequenceID int64, position int) (*model.SequenceStep, error) {
+	var s model.SequenceStep
+	query := `
+		select ` + sequenceStepColumns + `
+		from sequence_steps
+		where sequence_id = $1 and position > $2
+		order by position
+		limit 1`
+	if err := tx.GetContext(ctx, &s, query, sequenceID, position); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func setSequenceEnrollmentStatus(ctx context.Context, tx *sqlx.Tx, id int64, status model.SequenceEnrollmentStatus) error {
+	_, err := tx.ExecContext(ctx, `update sequence_enrollments set status = $2, updated = now() where id = $1`,
+		id, status)
+	return err
+}
+
+// scheduleSequenceStep after the position of the enrollment at the given time.
+func scheduleSequenceStep(ctx context.Context, tx *sqlx.Tx, id int64, position int, at time.Time) error {
+	m := model.Message{
+		"job":           model.JobAdvanceSequenceEnrollment,
+		"enrollment_id": strconv.FormatInt(id, 10),
+		"position":      strconv.Itoa(position),
+	}
+	return scheduleMessage(ctx, tx, sequenceKeyPrefix+strconv.FormatInt(id, 10), m, at)
+}
+
+// enrollInSequences the confirmed, active subscribers with the email addresses, in all active sequences
+// in their locale they haven't been enrolled in before. The first step of each is scheduled after its delay.
+func enrollInSequences(ctx context.Context, tx *sqlx.Tx, emails ...model.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	addresses := make([]string, len(emails))
+	for i, email := range emails {
+		addresses[i] = email.String()
+	}
+
+	query := `
+		with enrolled as (
+			insert into sequence_enrollments (sequence_id, email)
+			select q.id, s.email
+			from newsletter_subscribers s
+			join sequences q on q.active and q.locale = s.locale
+			where s.email = any($1::citext[]) and s.confirmed and s.active
+			on conflict (sequence_id, email) do nothing
+			returning id, sequence_id
+		)
+		select e.id, coalesce((
+			select delay_hours from sequence_steps s where s.sequence_id = e.sequence_id order by position limit 1
+		), 0) as delay_hours
+		from enrolled e`
+	var enrollments []struct {
+		ID         int64
+		DelayHours int `db:"delay_hours"`
+	}
+	if err := tx.SelectContext(ctx, &enrollments, query, addresses); err != nil {
+		return err
+	}
+	for _, e := range enrollments {
+		at := time.Now().Add(time.Duration(e.DelayHours) * time.Hour)
+		if err := scheduleSequenceStep(ctx, tx, e.ID, 0, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopSequenceEnrollments of the subscriber with the email address, and cancel their scheduled steps.
+func stopSequenceEnrollments(ctx context.Context, tx *sqlx.Tx, email model.Email) error {
+	query := `
+		with stopped as (
+			update sequence_enrollments
+			set status = 'stopped', updated = now()
+			where email = $1 and status = 'active'
+			returning id
+		)
+		delete from scheduled_messages
+		where key in (select '` + sequenceKeyPrefix + `' || id from stopped)`
+	_, err := tx.ExecContext(ctx, query, email)
+	return err
+}
@@ -0,0 +1,332 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/i18n"
+	"canvas/integrationtest"
+	"canvas/model"
+	"canvas/storage"
+)
+
+func TestDatabase_CreateSequence(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("creates sequences with unique names, and updates them", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s, err := db.CreateSequence(context.Background(), model.Sequence{Name: "Welcome", Locale: "da"})
+		is.NoErr(err)
+		is.True(s != nil)
+		is.Equal("Welcome", s.Name)
+		is.Equal(i18n.Locale("da"), s.Locale)
+		is.True(!s.Active)
+
+		taken, err := db.CreateSequence(context.Background(), model.Sequence{Name: "Welcome", Locale: "en"})
+		is.NoErr(err)
+		is.True(taken == nil)
+
+		other, err := db.CreateSequence(context.Background(), model.Sequence{Name: "Other", Locale: "en"})
+		is.NoErr(err)
+
+		updated, err := db.UpdateSequence(context.Background(), model.Sequence{ID: other.ID, Name: "Welcome", Locale: "en"})
+		is.NoErr(err)
+		is.True(updated == nil)
+
+		updated, err = db.UpdateSequence(context.Background(),
+			model.Sequence{ID: s.ID, Name: "Welcome", Locale: "de", Active: true})
+		is.NoErr(err)
+		is.Equal(i18n.Locale("de"), updated.Locale)
+		is.True(updated.Active)
+
+		sequences, err := db.ListSequences(context.Background())
+		is.NoErr(err)
+		is.Equal(2, len(sequences))
+		is.Equal("Other", sequences[0].Name)
+		is.Equal("Welcome", sequences[1].Name)
+	})
+}
+
+func TestDatabase_MoveSequenceStep(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("swaps positions with the neighbouring step", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s := createSequence(t, db, "en")
+		first := addStep(t, db, s.ID, 0, model.SequenceStepAlways, "First")
+		second := addStep(t, db, s.ID, 0, model.SequenceStepAlways, "Second")
+		is.Equal(1, first.Position)
+		is.Equal(2, second.Position)
+
+		found, err := db.MoveSequenceStep(context.Background(), s.ID, second.ID, true)
+		is.NoErr(err)
+		is.True(found)
+
+		steps, err := db.ListSequenceStepStats(context.Background(), s.ID)
+		is.NoErr(err)
+		is.Equal("Second", steps[0].Subject)
+		is.Equal("First", steps[1].Subject)
+
+		// Moving the first step up does nothing
+		found, err = db.MoveSequenceStep(context.Background(), s.ID, second.ID, true)
+		is.NoErr(err)
+		is.True(found)
+
+		found, err = db.MoveSequenceStep(context.Background(), s.ID, 123, true)
+		is.NoErr(err)
+		is.True(!found)
+	})
+}
+
+func TestDatabase_AdvanceSequenceEnrollment(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("enrolls on confirmation, sends the steps in order, and completes", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s := createSequence(t, db, "da")
+		createSequence(t, db, "en")
+		addStep(t, db, s.ID, 1, model.SequenceStepAlways, "First")
+		addStep(t, db, s.ID, 2, model.SequenceStepIfOpened, "Only if opened")
+		addStep(t, db, s.ID, 3, model.SequenceStepIfNotOpened, "Only if not opened")
+		confirm(t, db, "me@example.com", "da")
+
+		id := getEnrollmentID(t, db, s.ID, "me@example.com")
+		is.Equal(1, countRows(t, db, "sequence_enrollments"))
+		is.Equal(1, countScheduledMessages(t, db, "sequence_enrollment:"))
+
+		var deliveries []model.SequenceDelivery
+		send := func(ctx context.Context, d model.SequenceDelivery) error {
+			deliveries = append(deliveries, d)
+			return nil
+		}
+
+		advance, err := db.AdvanceSequenceEnrollment(context.Background(), id, 0, send)
+		is.NoErr(err)
+		is.Equal(model.SequenceAdvanceSent, advance)
+		is.Equal(1, len(deliveries))
+		is.Equal("First", deliveries[0].Step.Subject)
+		is.Equal(model.Email("me@example.com"), deliveries[0].Email)
+		is.Equal(i18n.Locale("da"), deliveries[0].Locale)
+
+		// Receiving the same message again does nothing
+		advance, err = db.AdvanceSequenceEnrollment(context.Background(), id, 0, send)
+		is.NoErr(err)
+		is.Equal(model.SequenceAdvanceNone, advance)
+
+		// Not opened, so the second step is skipped and the third sent
+		advance, err = db.AdvanceSequenceEnrollment(context.Background(), id, 1, send)
+		is.NoErr(err)
+		is.Equal(model.SequenceAdvanceSkipped, advance)
+
+		advance, err = db.AdvanceSequenceEnrollment(context.Background(), id, 2, send)
+		is.NoErr(err)
+		is.Equal(model.SequenceAdvanceSent, advance)
+		is.Equal("Only if not opened", deliveries[1].Step.Subject)
+
+		found, err := db.RecordSequenceOpen(context.Background(), deliveries[1].Token)
+		is.NoErr(err)
+		is.True(found)
+
+		sequences, err := db.ListSequences(context.Background())
+		is.NoErr(err)
+		is.Equal(1, sequences[0].Completed)
+
+		steps, err := db.ListSequenceStepStats(context.Background(), s.ID)
+		is.NoErr(err)
+		is.Equal(1, steps[0].Sent)
+		is.Equal(1, steps[1].Skipped)
+		is.Equal(1, steps[2].Sent)
+		is.Equal(1, steps[2].Opened)
+	})
+
+	t.Run("enrolls subscribers confirmed by an admin, and confirmed, active imports", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s := createSequence(t, db, "en")
+		addStep(t, db, s.ID, 0, model.SequenceStepAlways, "First")
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
+		is.NoErr(err)
+		_, err = db.ConfirmSubscriber(context.Background(), "me@example.com", model.Consent{Source: "cli"})
+		is.NoErr(err)
+		getEnrollmentID(t, db, s.ID, "me@example.com")
+
+		// Confirming again doesn't enroll again
+		_, err = db.ConfirmSubscriber(context.Background(), "me@example.com", model.Consent{Source: "cli"})
+		is.NoErr(err)
+
+		_, err = db.ImportSubscribers(context.Background(), []model.Subscriber{
+			{Email: "a@example.com", Locale: "en", Confirmed: true, Active: true},
+			{Email: "b@example.com", Locale: "en", Active: true},
+			{Email: "c@example.com", Locale: "en", Confirmed: true},
+			{Email: "d@example.com", Locale: "da", Confirmed: true, Active: true},
+		}, model.Consent{Source: "import"})
+		is.NoErr(err)
+		getEnrollmentID(t, db, s.ID, "a@example.com")
+
+		is.Equal(2, countRows(t, db, "sequence_enrollments"))
+		// The first steps of the two enrollments, and the confirmation email for b@example.com
+		is.Equal(3, countRows(t, db, "scheduled_messages"))
+	})
+
+	t.Run("sends steps that need an open when the previous one was opened", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s := createSequence(t, db, "en")
+		addStep(t, db, s.ID, 0, model.SequenceStepAlways, "First")
+		addStep(t, db, s.ID, 0, model.SequenceStepIfOpened, "Only if opened")
+		confirm(t, db, "me@example.com", "en")
+		id := getEnrollmentID(t, db, s.ID, "me@example.com")
+
+		var token string
+		_, err := db.AdvanceSequenceEnrollment(context.Background(), id, 0,
+			func(ctx context.Context, d model.SequenceDelivery) error {
+				token = d.Token
+				return nil
+			})
+		is.NoErr(err)
+
+		_, err = db.RecordSequenceOpen(context.Background(), token)
+		is.NoErr(err)
+
+		advance, err := db.AdvanceSequenceEnrollment(context.Background(), id, 1,
+			func(ctx context.Context, d model.SequenceDelivery) error {
+				return nil
+			})
+		is.NoErr(err)
+		is.Equal(model.SequenceAdvanceSent, advance)
+	})
+
+	t.Run("leaves the enrollment where it was if sending fails", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s := createSequence(t, db, "en")
+		addStep(t, db, s.ID, 0, model.SequenceStepAlways, "First")
+		confirm(t, db, "me@example.com", "en")
+		id := getEnrollmentID(t, db, s.ID, "me@example.com")
+
+		_, err := db.AdvanceSequenceEnrollment(context.Background(), id, 0,
+			func(ctx context.Context, d model.SequenceDelivery) error {
+				return errors.New("wire is cut")
+			})
+		is.True(err != nil)
+		is.Equal(0, countRows(t, db, "sequence_deliveries"))
+
+		advance, err := db.AdvanceSequenceEnrollment(context.Background(), id, 0,
+			func(ctx context.Context, d model.SequenceDelivery) error {
+				return nil
+			})
+		is.NoErr(err)
+		is.Equal(model.SequenceAdvanceSent, advance)
+	})
+
+	t.Run("stops enrollments on unsubscribe", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s := createSequence(t, db, "en")
+		addStep(t, db, s.ID, 0, model.SequenceStepAlways, "First")
+		confirm(t, db, "me@example.com", "en")
+		id := getEnrollmentID(t, db, s.ID, "me@example.com")
+		is.Equal(1, countScheduledMessages(t, db, "sequence_enrollment:"))
+
+		_, err := db.DeactivateSubscriber(context.Background(), "me@example.com", model.Consent{})
+		is.NoErr(err)
+		is.Equal(0, countScheduledMessages(t, db, "sequence_enrollment:"))
+
+		advance, err := db.AdvanceSequenceEnrollment(context.Background(), id, 0,
+			func(ctx context.Context, d model.SequenceDelivery) error {
+				return errors.New("should not be called")
+			})
+		is.NoErr(err)
+		is.Equal(model.SequenceAdvanceNone, advance)
+
+		sequences, err := db.ListSequences(context.Background())
+		is.NoErr(err)
+		is.Equal(1, sequences[0].Stopped)
+	})
+}
+
+// createSequence that is active, for subscribers in the locale.
+func createSequence(t *testing.T, db *storage.Database, locale i18n.Locale) *model.Sequence {
+	t.Helper()
+	s, err := db.CreateSequence(context.Background(),
+		model.Sequence{Name: "Welcome " + string(locale), Locale: locale, Active: true})
+	if err != nil || s == nil {
+		t.Fatal("error creating sequence", err)
+	}
+	return s
+}
+
+func addStep(
+	t *testing.T,
+	db *storage.Database,
+	sequenceID int64,
+	delayHours int,
+	condition model.SequenceStepCondition,
+	subject string,
+) *model.SequenceStep {
+	t.Helper()
+	s, err := db.AddSequenceStep(context.Background(), model.SequenceStep{
+		SequenceID: sequenceID,
+		DelayHours: delayHours,
+		Condition:  condition,
+		Subject:    subject,
+		Body:       "Hi!",
+	})
+	if err != nil || s == nil {
+		t.Fatal("error adding step", err)
+	}
+	return s
+}
+
+// confirm a new subscriber with the confirmation token, so they enter the active sequences in their locale.
+func confirm(t *testing.T, db *storage.Database, email model.Email, locale i18n.Locale) {
+	t.Helper()
+	token, err := db.SignupForNewsletter(context.Background(), email, locale, model.Consent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.ConfirmNewsletterSignup(context.Background(), token, model.Consent{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countScheduledMessages with keys starting with the given prefix.
+func countScheduledMessages(t *testing.T, db *storage.Database, prefix string) int {
+	t.Helper()
+	var count int
+	if err := db.DB.Get(&count, `select count(*) from scheduled_messages where starts_with(key, $1)`, prefix); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func getEnrollmentID(t *testing.T, db *storage.Database, sequenceID int64, email model.Email) int64 {
+	t.Helper()
+	var id int64
+	query := `select id from sequence_enrollments where sequence_id = $1 and email = $2`
+	if err := db.DB.Get(&id, query, sequenceID, email); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
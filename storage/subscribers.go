@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"canvas/i18n"
+	"canvas/model"
+)
+
+// SubscriberFilter for ListSubscribers and ExportSubscribers. Nil and empty fields match any value.
+type SubscriberFilter struct {
+	Confirmed *bool
+	Active    *bool
+	Locale    i18n.Locale
+	// Limit the number of subscribers returned. Zero means no limit.
+	Limit int
+}
+
+// subscriberColumns selected into model.Subscriber.
+const subscriberColumns = `email, locale, confirmed, active, reminded, created, updated`
+
+// ListSubscribers matching the filter, oldest first.
+func (d *Database) ListSubscribers(ctx context.Context, filter SubscriberFilter) ([]model.Subscriber, error) {
+	query, args := createSubscribersQuery(filter)
+	subscribers := []model.Subscriber{}
+	err := d.DB.SelectContext(ctx, &subscribers, query, args...)
+	return subscribers, err
+}
+
+// ExportSubscribers matching the filter, oldest first, passing them to fn one at a time as they are read,
+// so memory use doesn't grow with the number of subscribers. Stops at the first error from fn.
+func (d *Database) ExportSubscribers(
+	ctx context.Context,
+	filter SubscriberFilter,
+	fn func(model.Subscriber) error,
+) error {
+	query, args := createSubscribersQuery(filter)
+	rows, err := d.DB.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var s model.Subscriber
+		if err := rows.StructScan(&s); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// createSubscribersQuery for the filter, returning the query and its arguments.
+func createSubscribersQuery(filter SubscriberFilter) (string, []any) {
+	var conditions []string
+	var args []any
+	if filter.Confirmed != nil {
+		args = append(args, *filter.Confirmed)
+		conditions = append(conditions, fmt.Sprintf("confirmed = $%v", len(args)))
+	}
+	if filter.Active != nil {
+		args = append(args, *filter.Active)
+		conditions = append(conditions, fmt.Sprintf("active = $%v", len(args)))
+	}
+	if filter.Locale != "" {
+		args = append(args, filter.Locale)
+		conditions = append(conditions, fmt.Sprintf("locale = $%v", len(args)))
+	}
+
+	query := `select ` + subscriberColumns + ` from newsletter_subscribers`
+	if len(conditions) > 0 {
+		query += ` where ` + strings.Join(conditions, " and ")
+	}
+	query += ` order by created, email`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" limit $%v", len(args))
+	}
+	return query, args
+}
+
+// GetSubscriber by email address. Returns nil if there is no such subscriber.
+func (d *Database) GetSubscriber(ctx context.Context, email model.Email) (*model.Subscriber, error) {
+	return getSubscriber(ctx, d.DB, `select `+subscriberColumns+` from newsletter_subscribers where email = $1`, email)
+}
+
+// ConfirmSubscriber by email address, without a confirmation token, recording the consent.
+// If they weren't confirmed before, they enter the active sequences in their locale, like with ConfirmNewsletterSignup.
+// Returns the updated subscriber, or nil if there is no such subscriber.
+func (d *Database) ConfirmSubscriber(ctx context.Context, email model.Email, consent model.Consent) (*model.Subscriber, error) {
+	query := `
+		with previous as (
+			select email, confirmed from newsletter_subscribers where email = $1 for update
+		)
+		update newsletter_subscribers s
+		set confirmed = true, updated = now()
+		from previous
+		where s.email = previous.email
+		returning s.email, s.locale, s.confirmed, s.active, s.reminded, s.created, s.updated,
+			previous.confirmed as was_confirmed`
+	var s *model.Subscriber
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var row struct {
+			model.Subscriber
+			WasConfirmed bool `db:"was_confirmed"`
+		}
+		if err := tx.GetContext(ctx, &row, query, email); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		s = &row.Subscriber
+		if !row.WasConfirmed {
+			if err := enrollInSequences(ctx, tx, s.Email); err != nil {
+				return err
+			}
+		}
+		return insertConsentEvent(ctx, tx, s.Email, model.ConsentEventConfirmation, consent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// DeactivateSubscriber by email address, so they get no more emails, recording it as an unsubscribe.
+// Their sequence enrollments are stopped. Returns the updated subscriber, or nil if there is no such subscriber.
+func (d *Database) DeactivateSubscriber(ctx context.Context, email model.Email, consent model.Consent) (*model.Subscriber, error) {
+	query := `
+		update newsletter_subscribers
+		set active = false, updated = now()
+		where email = $1
+		returning ` + subscriberColumns
+	var s *model.Subscriber
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if s, err = getSubscriber(ctx, tx, query, email); err != nil || s == nil {
+			return err
+		}
+		if err := stopSequenceEnrollments(ctx, tx, s.Email); err != nil {
+			return err
+		}
+		return insertConsentEvent(ctx, tx, s.Email, model.ConsentEventUnsubscribe, consent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// confirmationEmailKeyPrefix of scheduled confirmation emails for imported subscribers, followed by the
+// lowercased email address.
+const confirmationEmailKeyPrefix = "confirmation_email:"
+
+// ImportSubscribers that don't exist already, in a single statement, so call it with batches of a few hundred.
+// Existing subscribers are left untouched, and so are later duplicates in the batch.
+// Imported subscribers get a signup consent event, and a confirmation event if they are confirmed.
+// Confirmed, active subscribers enter the active sequences in their locale, and unconfirmed, active subscribers
+// get a confirmation email scheduled for sending right away, all in the same transaction. So if the import
+// fails, nobody is imported without their confirmation email.
+// Returns the confirmation tokens of the imported subscribers, by email address.
+func (d *Database) ImportSubscribers(
+	ctx context.Context,
+	subscribers []model.Subscriber,
+	consent model.Consent,
+) (map[model.Email]string, error) {
+	tokens := map[model.Email]string{}
+	if len(subscribers) == 0 {
+		return tokens, nil
+	}
+
+	var values []string
+	var args []any
+	for _, s := range subscribers {
+		token, err := createSecret()
+		if err != nil {
+			return nil, err
+		}
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%v, $%v, $%v, $%v, $%v)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, s.Email, token, s.Locale, s.Confirmed, s.Active)
+	}
+
+	n := len(args)
+	args = append(args, consent.Source, consent.IP, consent.UserAgent, consent.WordingVersion)
+	consentValues := fmt.Sprintf("$%v, $%v, $%v, $%v", n+1, n+2, n+3, n+4)
+
+	// The consent events are inserted in the same statement, and so in the same transaction
+	query := `
+		with inserted as (
+			insert into newsletter_subscribers (email, token, locale, confirmed, active)
+			values ` + strings.Join(values, ", ") + `
+			on conflict (email) do nothing
+			returning email, token, locale, confirmed, active
+		), events as (
+			insert into consent_events (email, type, source, ip, user_agent, wording_version)
+			select email, 'signup', ` + consentValues + ` from inserted
+			union all
+			select email, 'confirmation', ` + consentValues + ` from inserted where confirmed
+		), confirmations as (
+			insert into scheduled_messages (key, message, due)
+			select '` + confirmationEmailKeyPrefix + `' || lower(email::text), jsonb_build_object(
+				'job', '` + model.JobConfirmationEmail + `', 'email', email::text, 'locale', locale, 'token', token
+			), now()
+			from inserted where active and not confirmed
+			on conflict (key) do update set
+				message = excluded.message,
+				due = excluded.due
+		)
+		select email, token, confirmed from inserted`
+
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var rows []struct {
+			Email     model.Email
+			Token     string
+			Confirmed bool
+		}
+		if err := tx.SelectContext(ctx, &rows, query, args...); err != nil {
+			return err
+		}
+		var confirmed []model.Email
+		for _, row := range rows {
+			tokens[row.Email] = row.Token
+			if row.Confirmed {
+				confirmed = append(confirmed, row.Email)
+			}
+		}
+		return enrollInSequences(ctx, tx, confirmed...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// getSubscriber from a query returning subscriberColumns. Returns nil if there are no rows.
+func getSubscriber(ctx context.Context, q sqlx.QueryerContext, query string, args ...any) (*model.Subscriber, error) {
+	var s model.Subscriber
+	if err := sqlx.GetContext(ctx, q, &s, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
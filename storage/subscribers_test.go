@@ -0,0 +1,185 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/integrationtest"
+	"canvas/model"
+	"canvas/storage"
+)
+
+func TestDatabase_ListSubscribers(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("lists subscribers matching the filter, oldest first", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		tokens, err := db.ImportSubscribers(context.Background(), []model.Subscriber{
+			{Email: "a@example.com", Locale: "en", Confirmed: true, Active: true},
+			{Email: "b@example.com", Locale: "da", Active: true},
+			{Email: "c@example.com", Locale: "de", Confirmed: true},
+		}, model.Consent{})
+		is.NoErr(err)
+		is.Equal(3, len(tokens))
+
+		subscribers, err := db.ListSubscribers(context.Background(), storage.SubscriberFilter{})
+		is.NoErr(err)
+		is.Equal(3, len(subscribers))
+		is.Equal(model.Email("a@example.com"), subscribers[0].Email)
+
+		confirmed, active := true, true
+		subscribers, err = db.ListSubscribers(context.Background(),
+			storage.SubscriberFilter{Confirmed: &confirmed, Active: &active})
+		is.NoErr(err)
+		is.Equal(1, len(subscribers))
+		is.Equal(model.Email("a@example.com"), subscribers[0].Email)
+
+		subscribers, err = db.ListSubscribers(context.Background(), storage.SubscriberFilter{Limit: 2})
+		is.NoErr(err)
+		is.Equal(2, len(subscribers))
+
+		subscribers, err = db.ListSubscribers(context.Background(), storage.SubscriberFilter{Locale: "de"})
+		is.NoErr(err)
+		is.Equal(1, len(subscribers))
+		is.Equal(model.Email("c@example.com"), subscribers[0].Email)
+	})
+}
+
+func TestDatabase_ExportSubscribers(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("passes subscribers matching the filter one at a time, and stops on errors", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.ImportSubscribers(context.Background(), []model.Subscriber{
+			{Email: "a@example.com", Locale: "en", Confirmed: true, Active: true},
+			{Email: "b@example.com", Locale: "da", Active: true},
+			{Email: "c@example.com", Locale: "de", Confirmed: true, Active: true},
+		}, model.Consent{})
+		is.NoErr(err)
+
+		var emails []model.Email
+		confirmed := true
+		err = db.ExportSubscribers(context.Background(), storage.SubscriberFilter{Confirmed: &confirmed},
+			func(s model.Subscriber) error {
+				emails = append(emails, s.Email)
+				return nil
+			})
+		is.NoErr(err)
+		is.Equal([]model.Email{"a@example.com", "c@example.com"}, emails)
+
+		stop := errors.New("stop")
+		var count int
+		err = db.ExportSubscribers(context.Background(), storage.SubscriberFilter{}, func(s model.Subscriber) error {
+			count++
+			return stop
+		})
+		is.Equal(stop, err)
+		is.Equal(1, count)
+	})
+}
+
+func TestDatabase_ImportSubscribers(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("leaves existing subscribers and later duplicates untouched", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "da", model.Consent{})
+		is.NoErr(err)
+
+		tokens, err := db.ImportSubscribers(context.Background(), []model.Subscriber{
+			{Email: "me@example.com", Locale: "en", Confirmed: true, Active: true},
+			{Email: "you@example.com", Locale: "en", Active: true},
+			{Email: "you@example.com", Locale: "da", Active: true},
+		}, model.Consent{})
+		is.NoErr(err)
+		is.Equal(1, len(tokens))
+		is.Equal(64, len(tokens["you@example.com"]))
+
+		s, err := db.GetSubscriber(context.Background(), "me@example.com")
+		is.NoErr(err)
+		is.Equal("da", string(s.Locale))
+		is.True(!s.Confirmed)
+	})
+
+	t.Run("schedules confirmation emails for unconfirmed, active subscribers", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		tokens, err := db.ImportSubscribers(context.Background(), []model.Subscriber{
+			{Email: "A@example.com", Locale: "da", Active: true},
+			{Email: "b@example.com", Locale: "en", Confirmed: true, Active: true},
+			{Email: "c@example.com", Locale: "en"},
+		}, model.Consent{})
+		is.NoErr(err)
+		is.Equal(3, len(tokens))
+		is.Equal(1, countRows(t, db, "scheduled_messages"))
+
+		var sent []model.Message
+		_, err = db.SendDueScheduledMessages(context.Background(), 10, func(ctx context.Context, m model.Message) error {
+			sent = append(sent, m)
+			return nil
+		})
+		is.NoErr(err)
+		is.Equal([]model.Message{{
+			"job":    "confirmation_email",
+			"email":  "A@example.com",
+			"locale": "da",
+			"token":  tokens["A@example.com"],
+		}}, sent)
+	})
+}
+
+func TestDatabase_ConfirmSubscriber(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("confirms by email, and returns nil for unknown subscribers", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
+		is.NoErr(err)
+
+		s, err := db.ConfirmSubscriber(context.Background(), "me@example.com", model.Consent{})
+		is.NoErr(err)
+		is.True(s.Confirmed)
+
+		s, err = db.ConfirmSubscriber(context.Background(), "you@example.com", model.Consent{})
+		is.NoErr(err)
+		is.Equal(nil, s)
+	})
+}
+
+func TestDatabase_DeactivateSubscriber(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("deactivates by email", func(t *testing.T) {
+		is := is.New(t)
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), "me@example.com", "en", model.Consent{})
+		is.NoErr(err)
+
+		s, err := db.DeactivateSubscriber(context.Background(), "me@example.com", model.Consent{})
+		is.NoErr(err)
+		is.True(!s.Active)
+
+		s, err = db.GetSubscriber(context.Background(), "me@example.com")
+		is.NoErr(err)
+		is.True(!s.Active)
+	})
+}
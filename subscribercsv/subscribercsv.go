@@ -0,0 +1,340 @@
+// Package subscribercsv imports and exports newsletter subscribers as CSV, streaming row by row,
+// so files with hundreds of thousands of rows are handled in bounded memory.
+package subscribercsv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"canvas/i18n"
+	"canvas/model"
+	"canvas/storage"
+)
+
+// ErrStore is returned from Importer.Import when storing subscribers fails, as opposed to errors in the file.
+var ErrStore = errors.New("error storing subscribers")
+
+// Mode of an import, which decides whether imported subscribers need to confirm their address.
+type Mode string
+
+const (
+	// ModeConsented imports subscribers as confirmed, for lists where everyone has already consented.
+	ModeConsented Mode = "consented"
+	// ModeConfirm imports subscribers as unconfirmed, and the store schedules a confirmation email for each of them
+	// in the same transaction.
+	ModeConfirm Mode = "confirm"
+)
+
+// Columns maps subscriber fields to column names in the CSV header. Names are matched case-insensitively.
+type Columns struct {
+	// Email column, required. Defaults to "email".
+	Email string
+	// Locale column, optional. Defaults to "locale".
+	Locale string
+}
+
+// ImportOptions for Importer.Import.
+type ImportOptions struct {
+	// BatchSize of rows inserted at a time. Defaults to 500.
+	BatchSize int
+	Columns   Columns
+	// Consent recorded for every imported subscriber. The source defaults to model.ConsentSourceImport.
+	Consent model.Consent
+	// Comma separating fields. Defaults to ','. Spreadsheets in many locales use ';'.
+	Comma rune
+	// MaxErrors kept in Report.Errors. Defaults to 100. Use OnError to get all of them.
+	MaxErrors int
+	Mode      Mode
+	// OnError, if set, is called for every row that isn't imported, as soon as it's known.
+	OnError func(RowError)
+}
+
+// RowError is a row that wasn't imported, and why.
+type RowError struct {
+	// Line in the file, counting the header as line 1.
+	Line   int    `json:"line"`
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+// Report of an import.
+type Report struct {
+	// Rows read, not counting the header.
+	Rows     int `json:"rows"`
+	Imported int `json:"imported"`
+	// Invalid rows, with an invalid or disposable email address, or an invalid locale.
+	Invalid int `json:"invalid"`
+	// Skipped rows, for addresses that are already subscribed or appear earlier in the file.
+	Skipped int `json:"skipped"`
+	// Errors for the first rows that weren't imported, up to ImportOptions.MaxErrors.
+	Errors []RowError `json:"errors"`
+	// ErrorsTruncated is true if there were more errors than kept in Errors.
+	ErrorsTruncated bool `json:"errors_truncated"`
+}
+
+// importStore is implemented by storage.Database.
+type importStore interface {
+	ImportSubscribers(ctx context.Context, subscribers []model.Subscriber, consent model.Consent) (map[model.Email]string, error)
+}
+
+// Importer of subscribers from CSV.
+type Importer struct {
+	store importStore
+}
+
+type NewImporterOptions struct {
+	Store importStore
+}
+
+func NewImporter(opts NewImporterOptions) *Importer {
+	return &Importer{
+		store: opts.Store,
+	}
+}
+
+// row to import, with its line for errors.
+type row struct {
+	line       int
+	subscriber model.Subscriber
+}
+
+// Import subscribers from CSV with a header row. Email addresses are normalized and validated, and locales are
+// matched to the supported ones, falling back to the default locale if there's no locale column or it's empty.
+// Rows are inserted in batches, and existing subscribers are left untouched. Invalid and skipped rows are
+// reported, and don't stop the import. Errors reading the file or from the database stop the import, and the
+// returned report covers the batches imported before the error. Errors from the database wrap ErrStore.
+func (i *Importer) Import(ctx context.Context, r io.Reader, opts ImportOptions) (Report, error) {
+	report := Report{Errors: []RowError{}}
+
+	if opts.Mode != ModeConsented && opts.Mode != ModeConfirm {
+		return report, fmt.Errorf("unknown import mode %q, must be %v or %v", opts.Mode, ModeConsented, ModeConfirm)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = 100
+	}
+	if opts.Columns.Email == "" {
+		opts.Columns.Email = "email"
+	}
+	if opts.Consent.Source == "" {
+		opts.Consent.Source = model.ConsentSourceImport
+	}
+	if opts.Columns.Locale == "" {
+		opts.Columns.Locale = "locale"
+	}
+
+	cr := newCSVReader(r, opts.Comma)
+	emailColumn, localeColumn, err := readHeader(cr, opts.Columns)
+	if err != nil {
+		return report, err
+	}
+
+	addError := func(e RowError) {
+		if opts.OnError != nil {
+			opts.OnError(e)
+		}
+		if len(report.Errors) < opts.MaxErrors {
+			report.Errors = append(report.Errors, e)
+		} else {
+			report.ErrorsTruncated = true
+		}
+	}
+
+	batch := make([]row, 0, opts.BatchSize)
+	// seen addresses, lowercased, with the line they were first seen on, to report duplicates across the whole file
+	seen := map[string]int{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := i.importBatch(ctx, batch, opts, &report, addError); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("error reading CSV: %w", err)
+		}
+		report.Rows++
+		line, _ := cr.FieldPos(0)
+
+		rawEmail := field(record, emailColumn)
+		email := model.Email(rawEmail).Normalize()
+		if !email.IsValid() {
+			report.Invalid++
+			addError(RowError{Line: line, Email: rawEmail, Reason: "invalid email address"})
+			continue
+		}
+		if email.IsDisposable() {
+			report.Invalid++
+			addError(RowError{Line: line, Email: rawEmail, Reason: "disposable email address"})
+			continue
+		}
+
+		locale := i18n.Default
+		if v := field(record, localeColumn); v != "" {
+			var ok bool
+			// Match handles region subtags like "da-DK", and also "da_DK" with the underscore replaced
+			if locale, ok = i18n.Match(strings.ReplaceAll(v, "_", "-")); !ok {
+				report.Invalid++
+				addError(RowError{Line: line, Email: rawEmail, Reason: fmt.Sprintf("unsupported locale %q", v)})
+				continue
+			}
+		}
+
+		key := strings.ToLower(email.String())
+		if firstLine, ok := seen[key]; ok {
+			report.Skipped++
+			addError(RowError{Line: line, Email: rawEmail, Reason: fmt.Sprintf("duplicate of line %v", firstLine)})
+			continue
+		}
+		seen[key] = line
+
+		batch = append(batch, row{line: line, subscriber: model.Subscriber{
+			Email:     email,
+			Locale:    locale,
+			Confirmed: opts.Mode == ModeConsented,
+			Active:    true,
+		}})
+		if len(batch) == opts.BatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// importBatch of rows, reporting the ones that already exist.
+func (i *Importer) importBatch(ctx context.Context, batch []row, opts ImportOptions, report *Report, addError func(RowError)) error {
+	subscribers := make([]model.Subscriber, len(batch))
+	for j, r := range batch {
+		subscribers[j] = r.subscriber
+	}
+
+	tokens, err := i.store.ImportSubscribers(ctx, subscribers, opts.Consent)
+	if err != nil {
+		return fmt.Errorf("%w from line %v: %w", ErrStore, batch[0].line, err)
+	}
+
+	for _, r := range batch {
+		if _, ok := tokens[r.subscriber.Email]; !ok {
+			report.Skipped++
+			addError(RowError{Line: r.line, Email: r.subscriber.Email.String(), Reason: "already subscribed"})
+			continue
+		}
+		report.Imported++
+	}
+	return nil
+}
+
+// exportStore is implemented by storage.Database.
+type exportStore interface {
+	ExportSubscribers(ctx context.Context, filter storage.SubscriberFilter, fn func(model.Subscriber) error) error
+}
+
+// Header of exported CSV files, which Import also understands.
+var Header = []string{"email", "locale", "confirmed", "active", "created", "updated"}
+
+// Export subscribers matching the filter as CSV with a header row, writing each row as it's read.
+func Export(ctx context.Context, w io.Writer, store exportStore, filter storage.SubscriberFilter) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(Header); err != nil {
+		return err
+	}
+	err := store.ExportSubscribers(ctx, filter, func(s model.Subscriber) error {
+		return cw.Write(Row(s))
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Row of a subscriber in an export, in the order of Header.
+func Row(s model.Subscriber) []string {
+	return []string{
+		s.Email.String(),
+		string(s.Locale),
+		strconv.FormatBool(s.Confirmed),
+		strconv.FormatBool(s.Active),
+		s.Created.UTC().Format(time.RFC3339),
+		s.Updated.UTC().Format(time.RFC3339),
+	}
+}
+
+// utf8BOM that spreadsheet programs put at the start of CSV files.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// newCSVReader that skips a byte order mark and allows rows with varying numbers of fields.
+func newCSVReader(r io.Reader, comma rune) *csv.Reader {
+	br := bufio.NewReader(r)
+	if start, _ := br.Peek(len(utf8BOM)); bytes.Equal(start, utf8BOM) {
+		_, _ = br.Discard(len(utf8BOM))
+	}
+	cr := csv.NewReader(br)
+	if comma != 0 {
+		cr.Comma = comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	cr.TrimLeadingSpace = true
+	return cr
+}
+
+// readHeader and return the indexes of the email and locale columns. The locale index is -1 if there is none.
+func readHeader(cr *csv.Reader, columns Columns) (int, int, error) {
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, 0, errors.New("the file is empty, expected a header row")
+		}
+		return 0, 0, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	emailColumn, localeColumn := -1, -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		switch {
+		case strings.EqualFold(name, columns.Email):
+			emailColumn = i
+		case strings.EqualFold(name, columns.Locale):
+			localeColumn = i
+		}
+	}
+	if emailColumn < 0 {
+		return 0, 0, fmt.Errorf("no %q column in the CSV header", columns.Email)
+	}
+	return emailColumn, localeColumn, nil
+}
+
+// field at index i of the record, trimmed, or empty if there is no such field.
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
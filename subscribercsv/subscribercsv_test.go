@@ -0,0 +1,247 @@
+package subscribercsv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"canvas/model"
+	"canvas/storage"
+	"canvas/subscribercsv"
+)
+
+// storeMock keeps subscribers in memory, like the database does.
+type storeMock struct {
+	batches     int
+	consent     model.Consent
+	subscribers []model.Subscriber
+}
+
+func (s *storeMock) ImportSubscribers(
+	ctx context.Context,
+	subscribers []model.Subscriber,
+	consent model.Consent,
+) (map[model.Email]string, error) {
+	s.batches++
+	s.consent = consent
+	tokens := map[model.Email]string{}
+	for _, subscriber := range subscribers {
+		if s.exists(subscriber.Email) {
+			continue
+		}
+		s.subscribers = append(s.subscribers, subscriber)
+		tokens[subscriber.Email] = "token-" + subscriber.Email.String()
+	}
+	return tokens, nil
+}
+
+func (s *storeMock) ExportSubscribers(
+	ctx context.Context,
+	filter storage.SubscriberFilter,
+	fn func(model.Subscriber) error,
+) error {
+	for _, subscriber := range s.subscribers {
+		if filter.Confirmed != nil && *filter.Confirmed != subscriber.Confirmed {
+			continue
+		}
+		if err := fn(subscriber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *storeMock) exists(email model.Email) bool {
+	for _, subscriber := range s.subscribers {
+		if strings.EqualFold(subscriber.Email.String(), email.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestImporter_Import(t *testing.T) {
+	t.Run("imports consented subscribers with mapped columns, and reports the rows it skips", func(t *testing.T) {
+		is := is.New(t)
+
+		store := &storeMock{subscribers: []model.Subscriber{{Email: "existing@example.com"}}}
+		importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: store})
+
+		// Starts with a byte order mark, like from a spreadsheet
+		file := "\ufeffName;E-mail;Language\n" +
+			"Me;  Me@Example.com ;da_DK\n" +
+			"Existing;existing@example.com;\n" +
+			"Again;me@example.com;en\n" +
+			"Nope;notanemail;en\n" +
+			"Klingon;you@example.com;tlh\n" +
+			"You;you@example.com\n" +
+			"Throwaway;me@mailinator.com;en\n"
+		report, err := importer.Import(context.Background(), strings.NewReader(file), subscribercsv.ImportOptions{
+			Columns: subscribercsv.Columns{Email: "e-mail", Locale: "language"},
+			Comma:   ';',
+			Mode:    subscribercsv.ModeConsented,
+		})
+		is.NoErr(err)
+
+		is.Equal(subscribercsv.Report{
+			Rows:     7,
+			Imported: 2,
+			Invalid:  3,
+			Skipped:  2,
+			Errors: []subscribercsv.RowError{
+				{Line: 4, Email: "me@example.com", Reason: "duplicate of line 2"},
+				{Line: 5, Email: "notanemail", Reason: "invalid email address"},
+				{Line: 6, Email: "you@example.com", Reason: `unsupported locale "tlh"`},
+				{Line: 8, Email: "me@mailinator.com", Reason: "disposable email address"},
+				{Line: 3, Email: "existing@example.com", Reason: "already subscribed"},
+			},
+		}, report)
+
+		is.Equal([]model.Subscriber{
+			{Email: "existing@example.com"},
+			{Email: "Me@example.com", Locale: "da", Confirmed: true, Active: true},
+			{Email: "you@example.com", Locale: "en", Confirmed: true, Active: true},
+		}, store.subscribers)
+	})
+
+	t.Run("imports unconfirmed, active subscribers in confirm mode", func(t *testing.T) {
+		is := is.New(t)
+
+		store := &storeMock{}
+		importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: store})
+
+		report, err := importer.Import(context.Background(), strings.NewReader("email\nme@example.com\n"),
+			subscribercsv.ImportOptions{Mode: subscribercsv.ModeConfirm})
+		is.NoErr(err)
+		is.Equal(1, report.Imported)
+		is.Equal([]model.Subscriber{{Email: "me@example.com", Locale: "en", Active: true}}, store.subscribers)
+	})
+
+	t.Run("imports large files in batches, keeping only the first errors", func(t *testing.T) {
+		is := is.New(t)
+
+		store := &storeMock{}
+		importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: store})
+
+		var file bytes.Buffer
+		file.WriteString("email\n")
+		for i := 0; i < 1000; i++ {
+			fmt.Fprintf(&file, "person%v@example.com\nnotanemail%v\n", i, i)
+		}
+
+		var allErrors int
+		report, err := importer.Import(context.Background(), &file, subscribercsv.ImportOptions{
+			BatchSize: 100,
+			MaxErrors: 10,
+			Mode:      subscribercsv.ModeConsented,
+			OnError:   func(subscribercsv.RowError) { allErrors++ },
+		})
+		is.NoErr(err)
+		is.Equal(2000, report.Rows)
+		is.Equal(1000, report.Imported)
+		is.Equal(1000, report.Invalid)
+		is.Equal(10, len(report.Errors))
+		is.True(report.ErrorsTruncated)
+		is.Equal(1000, allErrors)
+		is.Equal(10, store.batches)
+	})
+
+	t.Run("reports duplicates of rows in earlier batches as duplicates", func(t *testing.T) {
+		is := is.New(t)
+
+		store := &storeMock{}
+		importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: store})
+
+		file := "email\nme@example.com\nyou@example.com\nthem@example.com\nMe@example.com\n"
+		report, err := importer.Import(context.Background(), strings.NewReader(file), subscribercsv.ImportOptions{
+			BatchSize: 2,
+			Mode:      subscribercsv.ModeConsented,
+		})
+		is.NoErr(err)
+		is.Equal(3, report.Imported)
+		is.Equal(1, report.Skipped)
+		is.Equal([]subscribercsv.RowError{{Line: 5, Email: "Me@example.com", Reason: "duplicate of line 2"}}, report.Errors)
+	})
+
+	t.Run("errors on a missing email column and an unknown mode", func(t *testing.T) {
+		is := is.New(t)
+
+		importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: &storeMock{}})
+
+		_, err := importer.Import(context.Background(), strings.NewReader("mail\nme@example.com\n"),
+			subscribercsv.ImportOptions{Mode: subscribercsv.ModeConsented})
+		is.Equal(`no "email" column in the CSV header`, err.Error())
+
+		_, err = importer.Import(context.Background(), strings.NewReader(""),
+			subscribercsv.ImportOptions{Mode: "yolo"})
+		is.True(err != nil)
+	})
+
+	t.Run("wraps errors from the store", func(t *testing.T) {
+		is := is.New(t)
+
+		importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: failingStore{}})
+
+		_, err := importer.Import(context.Background(), strings.NewReader("email\nme@example.com\n"),
+			subscribercsv.ImportOptions{Mode: subscribercsv.ModeConsented})
+		is.True(errors.Is(err, subscribercsv.ErrStore))
+		is.Equal("error storing subscribers from line 2: oh no", err.Error())
+	})
+}
+
+func TestExport(t *testing.T) {
+	t.Run("writes subscribers matching the filter as CSV", func(t *testing.T) {
+		is := is.New(t)
+
+		created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		store := &storeMock{subscribers: []model.Subscriber{
+			{Email: "me@example.com", Locale: "da", Confirmed: true, Active: true, Created: created, Updated: created},
+			{Email: "you@example.com", Locale: "en", Active: true, Created: created, Updated: created},
+		}}
+
+		var out bytes.Buffer
+		confirmed := true
+		err := subscribercsv.Export(context.Background(), &out, store, storage.SubscriberFilter{Confirmed: &confirmed})
+		is.NoErr(err)
+		is.Equal("email,locale,confirmed,active,created,updated\n"+
+			"me@example.com,da,true,true,2026-01-02T03:04:05Z,2026-01-02T03:04:05Z\n", out.String())
+	})
+
+	t.Run("can be imported again", func(t *testing.T) {
+		is := is.New(t)
+
+		store := &storeMock{subscribers: []model.Subscriber{{Email: "me@example.com", Locale: "de"}}}
+		var out bytes.Buffer
+		is.NoErr(subscribercsv.Export(context.Background(), &out, store, storage.SubscriberFilter{}))
+
+		store2 := &storeMock{}
+		importer := subscribercsv.NewImporter(subscribercsv.NewImporterOptions{Store: store2})
+		report, err := importer.Import(context.Background(), &out, subscribercsv.ImportOptions{Mode: subscribercsv.ModeConsented})
+		is.NoErr(err)
+		is.Equal(1, report.Imported)
+		is.Equal("de", string(store2.subscribers[0].Locale))
+	})
+
+	t.Run("stops at errors from the store", func(t *testing.T) {
+		is := is.New(t)
+
+		err := subscribercsv.Export(context.Background(), &bytes.Buffer{}, failingStore{}, storage.SubscriberFilter{})
+		is.Equal("oh no", err.Error())
+	})
+}
+
+type failingStore struct{}
+
+func (failingStore) ImportSubscribers(context.Context, []model.Subscriber, model.Consent) (map[model.Email]string, error) {
+	return nil, errors.New("oh no")
+}
+
+func (failingStore) ExportSubscribers(context.Context, storage.SubscriberFilter, func(model.Subscriber) error) error {
+	return errors.New("oh no")
+}
@@ -0,0 +1,22 @@
+package util
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerContextKey struct{}
+
+// ContextWithLogger returns a copy of ctx carrying the logger, for Logger to fetch.
+func ContextWithLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, log)
+}
+
+// Logger from the context, such as the request-scoped logger set by handlers.AddRequestID.
+// Falls back to the default logger.
+func Logger(ctx context.Context) *slog.Logger {
+	if log, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return log
+	}
+	return slog.Default()
+}
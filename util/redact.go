@@ -0,0 +1,217 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// sensitiveKeys are attribute keys with values that are always redacted.
+// An attribute key matches if it contains one of them, ignoring case.
+var sensitiveKeys = []string{"api_key", "apikey", "authorization", "cookie", "password", "secret", "token"}
+
+// maxAnyDepth of nested structs, maps, and slices that are redacted field by field.
+// Deeper values are formatted as strings and redacted as a whole.
+const maxAnyDepth = 5
+
+var (
+	// secretParameterMatcher for secrets in query strings and form bodies, like "token=abc123".
+	secretParameterMatcher = regexp.MustCompile(`(?i)((?:api_?key|password|secret|token)=)[^&\s"']+`)
+
+	// bearerMatcher for bearer tokens in authorization headers.
+	bearerMatcher = regexp.MustCompile(`(?i)(bearer\s+)[^\s"']+`)
+
+	// hexSecretMatcher for long hex strings, like the tokens from storage. Shorter ones like request IDs are kept.
+	hexSecretMatcher = regexp.MustCompile(`\b[0-9a-fA-F]{40,}\b`)
+)
+
+// Redactor masks personal data in free text. It's implemented next to the types that know the format
+// of their data, like model.EmailRedactor for email addresses, so this package doesn't depend on them.
+type Redactor interface {
+	Redact(s string) string
+}
+
+// RedactingHandlerOptions for NewRedactingHandler.
+type RedactingHandlerOptions struct {
+	// Allow attribute keys to be logged as is, for debugging. Values that redact themselves
+	// with a LogValue method, like model.Email, are logged with their String method instead.
+	// Don't use it in production.
+	Allow []string
+	// Keys to redact, in addition to the built-in sensitive keys like "password" and "token".
+	Keys []string
+	// Redactors of personal data in messages and string values, applied after the built-in secret masking.
+	Redactors []Redactor
+}
+
+// RedactingHandler is a slog.Handler that masks personal data and secrets before passing records on.
+// Attributes with sensitive keys are redacted completely, and secret parameters, bearer tokens, long hex
+// strings, and whatever the redactors match are masked wherever they appear in messages and string values.
+// Structs, maps, and slices are redacted field by field, as groups.
+type RedactingHandler struct {
+	allow     []string
+	keys      []string
+	next      slog.Handler
+	redactors []Redactor
+}
+
+// NewRedactingHandler wrapping next.
+func NewRedactingHandler(next slog.Handler, opts RedactingHandlerOptions) *RedactingHandler {
+	keys := slices.Clone(sensitiveKeys)
+	for _, k := range opts.Keys {
+		keys = append(keys, strings.ToLower(k))
+	}
+	return &RedactingHandler{
+		allow:     opts.Allow,
+		keys:      keys,
+		next:      next,
+		redactors: opts.Redactors,
+	}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redactedRecord := slog.NewRecord(r.Time, r.Level, h.redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redactedRecord.AddAttrs(h.redact(a))
+		return true
+	})
+	return h.next.Handle(ctx, redactedRecord)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redactedAttrs = append(redactedAttrs, h.redact(a))
+	}
+	return &RedactingHandler{allow: h.allow, keys: h.keys, next: h.next.WithAttrs(redactedAttrs), redactors: h.redactors}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{allow: h.allow, keys: h.keys, next: h.next.WithGroup(name), redactors: h.redactors}
+}
+
+// redact the attribute, recursing into groups.
+func (h *RedactingHandler) redact(a slog.Attr) slog.Attr {
+	return h.redactDepth(a, 0)
+}
+
+// redactDepth redacts the attribute at the given depth of nested structs, maps, and slices.
+func (h *RedactingHandler) redactDepth(a slog.Attr, depth int) slog.Attr {
+	if slices.Contains(h.allow, a.Key) {
+		if a.Value.Kind() == slog.KindLogValuer {
+			if s, ok := a.Value.Any().(fmt.Stringer); ok {
+				return slog.String(a.Key, s.String())
+			}
+		}
+		return a
+	}
+
+	if h.isSensitive(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.redactString(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		redactedAttrs := make([]slog.Attr, 0, len(attrs))
+		for _, ga := range attrs {
+			redactedAttrs = append(redactedAttrs, h.redactDepth(ga, depth))
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redactedAttrs...)}
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case nil:
+			return slog.Attr{Key: a.Key, Value: v}
+		case error:
+			return slog.String(a.Key, h.redactString(x.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, h.redactString(x.String()))
+		case []byte:
+			return slog.String(a.Key, h.redactString(string(x)))
+		default:
+			return h.redactAny(a.Key, x, depth)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redactAny value that isn't a string, error, or Stringer.
+// Structs, maps, and slices become groups of their exported fields, entries, and elements, which are redacted
+// like attributes, so sensitive keys and personal data in them are caught. Other values, empty ones, and values
+// nested deeper than maxAnyDepth are formatted as strings and redacted.
+func (h *RedactingHandler) redactAny(key string, x any, depth int) slog.Attr {
+	rv := reflect.ValueOf(x)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return slog.Any(key, nil)
+		}
+		rv = rv.Elem()
+	}
+	if depth >= maxAnyDepth {
+		return slog.String(key, h.redactString(fmt.Sprintf("%+v", rv.Interface())))
+	}
+
+	var attrs []slog.Attr
+	switch rv.Kind() {
+	case reflect.Struct:
+		for i := range rv.NumField() {
+			if f := rv.Type().Field(i); f.IsExported() {
+				attrs = append(attrs, slog.Any(f.Name, rv.Field(i).Interface()))
+			}
+		}
+	case reflect.Map:
+		for _, k := range rv.MapKeys() {
+			attrs = append(attrs, slog.Any(fmt.Sprint(k.Interface()), rv.MapIndex(k).Interface()))
+		}
+		slices.SortFunc(attrs, func(a, b slog.Attr) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+	case reflect.Slice, reflect.Array:
+		for i := range rv.Len() {
+			attrs = append(attrs, slog.Any(fmt.Sprint(i), rv.Index(i).Interface()))
+		}
+	}
+	// Handlers drop empty groups, so values without fields or entries are logged formatted instead
+	if len(attrs) == 0 {
+		return slog.String(key, h.redactString(fmt.Sprintf("%+v", rv.Interface())))
+	}
+
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redactedAttrs = append(redactedAttrs, h.redactDepth(a, depth+1))
+	}
+	return slog.Attr{Key: key, Value: slog.GroupValue(redactedAttrs...)}
+}
+
+func (h *RedactingHandler) isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range h.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString masks secrets in s, and then personal data with the redactors.
+func (h *RedactingHandler) redactString(s string) string {
+	s = secretParameterMatcher.ReplaceAllString(s, "${1}"+redacted)
+	s = bearerMatcher.ReplaceAllString(s, "${1}"+redacted)
+	s = hexSecretMatcher.ReplaceAllString(s, redacted)
+	for _, r := range h.redactors {
+		s = r.Redact(s)
+	}
+	return s
+}
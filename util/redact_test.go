@@ -0,0 +1,116 @@
+package util_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"canvas/model"
+	"canvas/util"
+)
+
+func TestRedactingHandler(t *testing.T) {
+	const token = "3f2a1b9c3f2a1b9c3f2a1b9c3f2a1b9c3f2a1b9c3f2a1b9c3f2a1b9c3f2a1b9c"
+
+	newLogger := func(opts util.RedactingHandlerOptions) (*slog.Logger, *bytes.Buffer) {
+		var buf bytes.Buffer
+		opts.Redactors = []util.Redactor{model.EmailRedactor{}}
+		return slog.New(util.NewRedactingHandler(slog.NewTextHandler(&buf, nil), opts)), &buf
+	}
+
+	t.Run("never outputs email addresses, tokens, or passwords", func(t *testing.T) {
+		is := is.New(t)
+
+		log, buf := newLogger(util.RedactingHandlerOptions{})
+		log = log.With(slog.String("password", "hunter2"))
+		log.WithGroup("request").Info("Signed up me@example.com",
+			slog.Any("email", model.Email("me@example.com")),
+			slog.String("token", token),
+			slog.String("response", `{"To":"you@example.com","Message":"Bad"}`),
+			slog.String("url", "/newsletter/confirm?token=abc123&page=2"),
+			slog.String("header", "Bearer abc123"),
+			slog.String("text", "Confirm at https://example.com/confirm?t="+token),
+			util.ErrAttr(errors.New("no user them@example.com")),
+			slog.Group("user", slog.String("api_key", "abc123")),
+		)
+
+		output := buf.String()
+		for _, secret := range []string{"me@", "you@", "them@", "hunter2", "abc123", token} {
+			is.True(!strings.Contains(output, secret)) // secret in output
+		}
+		is.True(strings.Contains(output, `msg="Signed up m***@example.com"`))
+		is.True(strings.Contains(output, "request.email=m***@example.com"))
+		is.True(strings.Contains(output, "password=REDACTED"))
+		is.True(strings.Contains(output, "page=2"))
+		is.True(strings.Contains(output, "request.user.api_key=REDACTED"))
+	})
+
+	t.Run("redacts the fields of structs, maps, and slices", func(t *testing.T) {
+		is := is.New(t)
+
+		type user struct {
+			Name     string
+			Email    model.Email
+			Password string
+			Notes    map[string]string
+			Friends  []string
+			Age      int
+		}
+
+		log, buf := newLogger(util.RedactingHandlerOptions{})
+		log.Info("Hi",
+			slog.Any("user", &user{
+				Name:     "Me",
+				Email:    "me@example.com",
+				Password: "hunter2",
+				Notes:    map[string]string{"api_key": "abc123", "note": "ask you@example.com"},
+				Friends:  []string{"them@example.com"},
+				Age:      42,
+			}),
+			slog.Any("headers", map[string][]string{"Cookie": {"session=abc123"}}),
+			slog.Any("empty", struct{}{}),
+		)
+
+		output := buf.String()
+		for _, secret := range []string{"me@", "you@", "them@", "hunter2", "abc123"} {
+			is.True(!strings.Contains(output, secret)) // secret in output
+		}
+		is.True(strings.Contains(output, "user.Name=Me"))
+		is.True(strings.Contains(output, "user.Email=m***@example.com"))
+		is.True(strings.Contains(output, "user.Password=REDACTED"))
+		is.True(strings.Contains(output, "user.Notes.api_key=REDACTED"))
+		is.True(strings.Contains(output, `user.Notes.note="ask y***@example.com"`))
+		is.True(strings.Contains(output, "user.Friends.0=t***@example.com"))
+		is.True(strings.Contains(output, "user.Age=42"))
+		is.True(strings.Contains(output, "headers.Cookie=REDACTED"))
+		is.True(strings.Contains(output, "empty={}"))
+	})
+
+	t.Run("masks configured attribute keys", func(t *testing.T) {
+		is := is.New(t)
+
+		log, buf := newLogger(util.RedactingHandlerOptions{Keys: []string{"Phone"}})
+		log.Info("Hi", slog.String("phone", "+4512345678"))
+
+		is.True(!strings.Contains(buf.String(), "12345678"))
+	})
+
+	t.Run("keeps short IDs and allowed keys", func(t *testing.T) {
+		is := is.New(t)
+
+		log, buf := newLogger(util.RedactingHandlerOptions{Allow: []string{"email", "text"}})
+		log.Info("Hi",
+			slog.String("request_id", "3f2a1b9c3f2a1b9c3f2a1b9c3f2a1b9c"),
+			slog.Any("email", model.Email("me@example.com")),
+			slog.String("text", "/newsletter/confirm?token=abc123"))
+
+		output := buf.String()
+		is.True(strings.Contains(output, "request_id=3f2a1b9c3f2a1b9c3f2a1b9c3f2a1b9c"))
+		is.True(strings.Contains(output, "email=me@example.com"))
+		is.True(strings.Contains(output, "token=abc123"))
+	})
+}
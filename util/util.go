@@ -1,18 +1,13 @@
 package util
 
 import (
-	"fmt"
 	"log/slog"
-	"net/url"
 	"os"
-	"reflect"
-
-	"github.com/caarlos0/env/v11"
-	dotenv "github.com/maragudk/env"
 )
 
-// InitializeSlog
-func InitializeSlog(env, release string) {
+// InitializeSlog with personal data and secrets redacted, see RedactingHandler.
+// The allow list of attribute keys to log unredacted in opts is only used in the development environment.
+func InitializeSlog(env, release string, opts RedactingHandlerOptions) {
 	// common attributes attached to every log
 	slogAttr := []slog.Attr{
 		slog.Group("environment", slog.String("release", release), slog.String("env", env)),
@@ -20,11 +15,12 @@ func InitializeSlog(env, release string) {
 
 	var logHandler slog.Handler
 	if env == "development" {
-		logHandler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{AddSource: true}).
-			WithAttrs(slogAttr)
+		logHandler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{AddSource: true})
 	} else {
-		logHandler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{AddSource: true}).WithAttrs(slogAttr)
+		logHandler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{AddSource: true})
+		opts.Allow = nil
 	}
+	logHandler = NewRedactingHandler(logHandler, opts).WithAttrs(slogAttr)
 	logger := slog.New(logHandler)
 	slog.SetDefault(logger)
 }
@@ -34,27 +30,3 @@ func InitializeSlog(env, release string) {
 func ErrAttr(err error) slog.Attr {
 	return slog.Any("error", err)
 }
-
-// custom parser for parsing string into net.Addr
-// compatible with env.ParserFunc
-func parseURL(value string) (any, error) {
-	addr, err := url.Parse(value)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse url: %w", err)
-	}
-	return *addr, nil
-}
-
-// Builds config - error handling omitted fore brevity
-func LoadConfig[Config any](c *Config) error {
-	// Loading the environment variables from '.env' file.
-	// ignore the error because on the server we will use the env variables from the OS Environment
-	_ = dotenv.Load()
-
-	return env.ParseWithOptions(
-		c,
-		env.Options{RequiredIfNoDef: true, FuncMap: map[reflect.Type]env.ParserFunc{
-			reflect.TypeOf(url.URL{}): parseURL,
-		}},
-	)
-}
@@ -0,0 +1,53 @@
+package views
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"canvas/model"
+)
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
+// formatTime in UTC, to the second.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// percent of part in whole, rounded to a whole number, or a dash if whole is zero.
+func percent(part, whole int) string {
+	if whole == 0 {
+		return "–"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)/float64(whole)*100)
+}
+
+func conditionLabel(c model.SequenceStepCondition) string {
+	switch c {
+	case model.SequenceStepIfOpened:
+		return "Only if they opened the previous step"
+	case model.SequenceStepIfNotOpened:
+		return "Only if they didn't open the previous step"
+	default:
+		return "Always"
+	}
+}
+
+func sequencePath(id int64) string {
+	return "/admin/sequences/" + strconv.FormatInt(id, 10)
+}
+
+func sequenceStepPath(sequenceID, stepID int64) string {
+	return sequencePath(sequenceID) + "/steps/" + strconv.FormatInt(stepID, 10)
+}
+
+// stepFieldID for the field in the form of the step, unique on the page, which has a form per step.
+func stepFieldID(step model.SequenceStep, field string) string {
+	return "step_" + strconv.FormatInt(step.ID, 10) + "_" + field
+}
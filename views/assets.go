@@ -0,0 +1,44 @@
+package views
+
+import (
+	"encoding/json"
+	"io/fs"
+	"sync"
+)
+
+// assetManifest maps asset paths to fingerprinted asset paths, see LoadAssetManifest.
+var assetManifest = struct {
+	paths map[string]string
+	mutex sync.RWMutex
+}{}
+
+// LoadAssetManifest from manifest.json in fsys, which maps asset paths to fingerprinted asset paths.
+// The manifest is written by the asset build step in cmd/assets.
+func LoadAssetManifest(fsys fs.FS) error {
+	manifestAsBytes, err := fs.ReadFile(fsys, "manifest.json")
+	if err != nil {
+		return err
+	}
+
+	var paths map[string]string
+	if err := json.Unmarshal(manifestAsBytes, &paths); err != nil {
+		return err
+	}
+
+	assetManifest.mutex.Lock()
+	defer assetManifest.mutex.Unlock()
+	assetManifest.paths = paths
+	return nil
+}
+
+// Asset URL for the asset at the given path in the public directory.
+// If the path is in the asset manifest, the URL is to the fingerprinted asset.
+func Asset(path string) string {
+	assetManifest.mutex.RLock()
+	defer assetManifest.mutex.RUnlock()
+
+	if fingerprinted, ok := assetManifest.paths[path]; ok {
+		path = fingerprinted
+	}
+	return "/public/" + path
+}
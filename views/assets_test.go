@@ -0,0 +1,24 @@
+package views_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+
+	"canvas/views"
+)
+
+func TestAsset(t *testing.T) {
+	t.Run("returns fingerprinted paths from the manifest, and other paths as is", func(t *testing.T) {
+		is := is.New(t)
+
+		err := views.LoadAssetManifest(fstest.MapFS{
+			"manifest.json": {Data: []byte(`{"css/tailwind.css": "css/tailwind.12345678.css"}`)},
+		})
+		is.NoErr(err)
+
+		is.Equal("/public/css/tailwind.12345678.css", views.Asset("css/tailwind.css"))
+		is.Equal("/public/images/logo.png", views.Asset("images/logo.png"))
+	})
+}
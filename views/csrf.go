@@ -0,0 +1,4 @@
+package views
+
+// CSRFFieldName is the name of the form field with the CSRF token.
+const CSRFFieldName = "csrf_token"
@@ -1,48 +1,38 @@
 package views
 
-import (
-	g "github.com/maragudk/gomponents"
-	"github.com/maragudk/gomponents-heroicons/solid"
-	. "github.com/maragudk/gomponents/html"
-)
+const (
+	// HoneypotFieldName is the name of a form field that is hidden from people, but that bots fill out.
+	HoneypotFieldName = "website"
+
+	// FormTimeFieldName is the name of a form field with the signed time the form was rendered,
+	// to detect forms submitted faster than a person could.
+	FormTimeFieldName = "form_time"
+
+	// CheckedEmailFieldName is the name of a form field with the address a suggestion was shown for,
+	// so submitting the same address again signs it up as typed.
+	CheckedEmailFieldName = "checked_email"
 
-func FrontPage() g.Node {
-	return Page(
-		"Canvas",
-		"/",
-		H1(g.Text(`Solutions to problems.`)),
-		P(g.Text(`Do you have problems? We also had problems.`)),
-		P(g.Raw(`Then we created the <em>canvas</em> app, and now we don't! 😬`)),
-		H2(g.Text(`Do you want to know more?`)),
-		P(g.Text(`Sign up to our newsletter below.`)),
+	// SuggestionFieldName is the name of the button that signs up with the suggested address instead.
+	SuggestionFieldName = "suggestion"
+
+	// WordingVersionFieldName is the name of a form field with the wording version of the signup form,
+	// recorded in the consent log.
+	WordingVersionFieldName = "wording_version"
+
+	// SignupWordingVersion of the text people agree to when signing up. Change it when the wording changes,
+	// so the consent log shows which wording each person saw. The locale is added to it in the form.
+	SignupWordingVersion = "2026-10-19"
+)
 
-		FormEl(Action("/newsletter/signup"), Method("post"), Class("flex items-center max-w-md"),
-			Label(For("email"), Class("sr-only"), g.Text("Email")),
-			Div(
-				Class("relative rounded-md shadow-sm flex-grow"),
-				Div(Class("absolute inset-y-0 left-0 pl-3 flex items-center pointer-events-none"),
-					solid.Mail(Class("h-5 w-5 text-gray-400")),
-				),
-				Input(
-					Type("email"),
-					Name("email"),
-					ID("email"),
-					AutoComplete("email"),
-					Required(),
-					Placeholder("me@example.com"),
-					TabIndex("1"),
-					Class(
-						"focus:ring-gray-500 focus:border-gray-500 block w-full pl-10 text-sm border-gray-300 rounded-md",
-					),
-				),
-			),
-			Button(
-				Type("submit"),
-				g.Text("Sign up"),
-				Class(
-					"ml-3 inline-flex items-center px-4 py-2 border border-gray-300 shadow-sm text-sm font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 flex-none",
-				),
-			),
-		),
-	)
+// SignupFormProps for FrontPage and SignupForm.
+type SignupFormProps struct {
+	CSRFToken string
+	// Email to fill in the signup form, when re-rendering it after an error.
+	Email string
+	// Error to show below the signup form.
+	Error string
+	// Suggestion for a typo in the domain of Email, to show below the signup form.
+	Suggestion string
+	// FormTime is the signed time the form was first rendered, for the form time field.
+	FormTime string
 }
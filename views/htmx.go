@@ -0,0 +1,9 @@
+package views
+
+// htmxConfig keeps htmx within the content security policy: no inline styles and no eval,
+// and requests only to the app itself.
+const htmxConfig = `{"includeIndicatorStyles":false,"allowEval":false,"allowScriptTags":false,"selfRequestsOnly":true}`
+
+// FormErrorID is the id of the element in forms posted with htmx that error messages are swapped into,
+// so the form stays in place and can be submitted again.
+const FormErrorID = "form-error"
@@ -0,0 +1,13 @@
+package views
+
+// Icons from Heroicons v1, see https://heroicons.com.
+const (
+	globeIcon = `<svg viewBox="0 0 24 24" fill="none" stroke="currentColor" aria-hidden="true" class="h-6 w-6">` +
+		`<path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M3.055 11H5a2 2 0 012 2v1a2 2 0 002 2 ` +
+		`2 2 0 012 2v2.945M8 3.935V5.5A2.5 2.5 0 0010.5 8h.5a2 2 0 012 2 2 2 0 104 0 2 2 0 012-2h1.064M15 20.488V18a2 ` +
+		`2 0 012-2h3.064M21 12a9 9 0 11-18 0 9 9 0 0118 0z"/></svg>`
+
+	mailIcon = `<svg viewBox="0 0 20 20" fill="currentColor" aria-hidden="true" class="h-5 w-5 text-gray-400">` +
+		`<path d="M2.003 5.884L10 9.882l7.997-3.998A2 2 0 0016 4H4a2 2 0 00-1.997 1.884z"/>` + "\n  " +
+		`<path d="M18 8.118l-8 4-8-4V14a2 2 0 002 2h12a2 2 0 002-2V8.118z"/></svg>`
+)
@@ -0,0 +1,123 @@
+package views_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/matryer/is"
+
+	"canvas/i18n"
+	"canvas/model"
+	"canvas/subscribercsv"
+	"canvas/views"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestComponents renders components and compares them with the golden files in testdata.
+// Run with -update to write the golden files after changing components, and check the diff.
+func TestComponents(t *testing.T) {
+	is := is.New(t)
+
+	// Render assets without fingerprints
+	is.NoErr(views.LoadAssetManifest(fstest.MapFS{"manifest.json": {Data: []byte(`{}`)}}))
+
+	now := time.UnixMilli(1700000000000)
+	formTime := "1700000000000.3f2a1b9c"
+	tests := []struct {
+		name      string
+		component templ.Component
+		locale    i18n.Locale
+	}{
+		{"front_page", views.FrontPage(views.SignupFormProps{CSRFToken: "csrf123", FormTime: formTime}), ""},
+		{"front_page_da", views.FrontPage(views.SignupFormProps{CSRFToken: "csrf123", FormTime: formTime}), "da"},
+		{"front_page_error", views.FrontPage(views.SignupFormProps{
+			CSRFToken: "csrf123", Email: "notanemail", Error: "That's not right.", FormTime: formTime,
+		}), ""},
+		{"signup_form", views.SignupForm(views.SignupFormProps{CSRFToken: "csrf123", FormTime: formTime}), ""},
+		{"signup_form_suggestion", views.SignupForm(views.SignupFormProps{
+			CSRFToken: "csrf123", Email: "me@gmial.com", FormTime: formTime, Suggestion: "me@gmail.com",
+		}), ""},
+		{"newsletter_thanks_page", views.NewsletterThanksPage("/newsletter/thanks"), ""},
+		{"newsletter_thanks", views.NewsletterThanks(), ""},
+		{"newsletter_confirm_page", views.NewsletterConfirmPage("/newsletter/confirm", "token123", "csrf123"), ""},
+		{"newsletter_confirm_form", views.NewsletterConfirmForm("token123", "csrf123"), ""},
+		{"newsletter_confirmed_page", views.NewsletterConfirmedPage("/newsletter/confirmed"), ""},
+		{"newsletter_confirmed", views.NewsletterConfirmed(), ""},
+		{"error_page", views.ErrorPage("/oops", "Something went wrong", "Try again.", "req123"), ""},
+		{"error_page_no_id", views.ErrorPage("/oops", "Page not found", "It's gone.", ""), ""},
+		{"error_message", views.ErrorMessage("Try again.", "req123"), ""},
+		{"subscribers_page", views.SubscribersPage(""), ""},
+		{"subscribers_page_error", views.SubscribersPage("Choose a CSV file to import."), ""},
+		{"subscriber_timeline_page", views.SubscriberTimelinePage("me@example.com",
+			&model.Subscriber{Email: "me@example.com", Locale: "da", Confirmed: true, Active: true, Reminded: &now, Created: now, Updated: now},
+			[]model.ConsentEvent{
+				{ID: 1, Email: "me@example.com", Type: model.ConsentEventSignup, Created: now, Consent: model.Consent{
+					Source: "signup_form", IP: "192.0.2.1", UserAgent: "Firefox", WordingVersion: "2026-10-19/da",
+				}},
+				{ID: 2, Email: "me@example.com", Type: model.ConsentEventConfirmation, Created: now, Consent: model.Consent{
+					Source: "confirm_link", IP: "192.0.2.1", UserAgent: "Firefox",
+				}},
+			}), ""},
+		{"subscriber_timeline_page_gone", views.SubscriberTimelinePage("gone@example.com", nil, nil), ""},
+		{"subscriber_import_report_page", views.SubscriberImportReportPage(subscribercsv.Report{
+			Rows: 3, Imported: 1, Invalid: 1, Skipped: 1,
+			Errors: []subscribercsv.RowError{
+				{Line: 3, Email: "notanemail", Reason: "invalid email address"},
+				{Line: 4, Email: "me@example.com", Reason: "already subscribed"},
+			},
+		}, ""), ""},
+		{"sequences_page", views.SequencesPage([]model.SequenceSummary{
+			{
+				Sequence:    model.Sequence{ID: 1, Name: "Welcome", Locale: "da", Active: true, Created: now, Updated: now},
+				Enrollments: 10, InProgress: 4, Completed: 5, Stopped: 1,
+			},
+		}, ""), ""},
+		{"sequences_page_empty_error", views.SequencesPage(nil, "Enter a name for the sequence."), ""},
+		{"sequence_page", views.SequencePage(
+			model.Sequence{ID: 1, Name: "Welcome", Locale: "da", Active: true, Created: now, Updated: now},
+			[]model.SequenceStepStats{
+				{
+					SequenceStep: model.SequenceStep{ID: 2, SequenceID: 1, Position: 1, DelayHours: 24,
+						Condition: model.SequenceStepAlways, Subject: "Hello", Body: "Hi!\n\nWelcome."},
+					Reached: 10, Sent: 10, Opened: 6,
+				},
+				{
+					SequenceStep: model.SequenceStep{ID: 3, SequenceID: 1, Position: 2, DelayHours: 48,
+						Condition: model.SequenceStepIfOpened, Subject: "More", Body: "Here's more."},
+					Reached: 6, Sent: 4, Skipped: 2,
+				},
+			}, ""), ""},
+		{"sequence_page_empty_error", views.SequencePage(
+			model.Sequence{ID: 1, Name: "Welcome", Locale: "en"}, nil, "Choose when to send the step."), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			ctx := context.Background()
+			if test.locale != "" {
+				ctx = i18n.ContextWithLocale(ctx, test.locale)
+			}
+
+			var actual bytes.Buffer
+			is.NoErr(test.component.Render(ctx, &actual))
+
+			path := "testdata/" + test.name + ".html"
+			if *update {
+				is.NoErr(os.WriteFile(path, actual.Bytes(), 0644))
+			}
+
+			expected, err := os.ReadFile(path)
+			is.NoErr(err)
+			is.Equal(string(expected), actual.String())
+		})
+	}
+}